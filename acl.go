@@ -0,0 +1,222 @@
+package varto
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// ACLAction is a set of operations an ACL rule applies to.
+type ACLAction int
+
+const (
+	ACLSubscribe ACLAction = 1 << iota
+	ACLPublish
+
+	// ACLBroadcast applies to broadcasts sent with BroadcastToAllFrom.
+	// Broadcasts have no topic, so the Topic of rules with this action is ignored.
+	ACLBroadcast
+
+	// ACLRemoveConnection applies to connections removed with RemoveConnectionFrom.
+	// The Topic of rules with this action is ignored too.
+	ACLRemoveConnection
+
+	// ACLAll is every operation on topics. It doesn't include ACLBroadcast and ACLRemoveConnection.
+	ACLAll = ACLSubscribe | ACLPublish
+)
+
+// ACLRule allows or denies operations on the topics that match a pattern.
+type ACLRule struct {
+	// Action is the operations the rule applies to.
+	Action ACLAction
+
+	// Topic is the topic pattern of the rule.
+	// "+" matches exactly one level and "#" matches any number of remaining levels.
+	// "{key}" is replaced with the connection attribute with the same key,
+	// e.g. "users/{user}/#". The rule does not apply if the attribute is missing.
+	Topic string
+
+	// Attrs are the attributes a connection must have for the rule to apply.
+	// If an attribute of the connection is a slice, it must contain the value.
+	// If it is empty, the rule applies to every connection.
+	Attrs map[string]any
+
+	// Deny makes the rule deny the operations instead of allowing them.
+	Deny bool
+}
+
+type ACLOptions struct {
+	// Rules are evaluated in order and the first matching rule decides.
+	Rules []ACLRule
+
+	// DenyByDefault denies the operations that no rule matches.
+	// Otherwise they are allowed.
+	DenyByDefault bool
+}
+
+// ACL is a middleware that checks subscribe, publish, broadcast and remove permissions.
+// Publish, broadcast and remove permissions are checked for the operations of PublishFrom,
+// BroadcastToAllFrom and RemoveConnectionFrom; the operations of Publish, BroadcastToAll
+// and RemoveConnection are not made by a connection and are always allowed.
+// In-process subscribers, such as those of SubscribeChan, are trusted and always allowed too.
+type ACL struct {
+	BaseMiddleware
+	attrs AttrGetter
+	opts  ACLOptions
+}
+
+var aclTemplate = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// NewACL returns a new ACL middleware. The attributes of connections are read from attrs,
+// which is usually the Varto instance the middleware is used with.
+// If attrs is nil, only the attributes of AttributedConnections are used.
+func NewACL(attrs AttrGetter, opts ACLOptions) *ACL {
+	return &ACL{
+		attrs: attrs,
+		opts:  opts,
+	}
+}
+
+// Allowed reports whether the connection is allowed to perform the action on the topic.
+// If the topic is a pattern, such as the filter of a wildcard subscription, it is denied
+// if a deny rule matches any topic the pattern matches, and allowed by an allow rule
+// only if the rule matches every topic the pattern matches.
+func (a *ACL) Allowed(conn Connection, action ACLAction, topic string) bool {
+	if _, ok := conn.(*localConnection); ok {
+		return true
+	}
+
+	attrs := a.attrsOf(conn)
+	hasTopic := action&(ACLBroadcast|ACLRemoveConnection) == 0
+	filter := hasTopic && isTopicPattern(topic)
+
+	for _, rule := range a.opts.Rules {
+		if rule.Action&action == 0 || !aclAttrsMatch(rule.Attrs, attrs) {
+			continue
+		}
+
+		if hasTopic {
+			pattern, ok := aclExpandTopic(rule.Topic, attrs)
+			if !ok {
+				continue
+			}
+
+			if filter {
+				if rule.Deny && topicPatternsOverlap(pattern, topic) {
+					return false
+				}
+
+				if !rule.Deny && topicPatternCovers(pattern, topic) {
+					return true
+				}
+
+				continue
+			}
+
+			if !matchTopic(pattern, topic) {
+				continue
+			}
+		}
+
+		return !rule.Deny
+	}
+
+	return !a.opts.DenyByDefault
+}
+
+func (a *ACL) attrsOf(conn Connection) map[string]any {
+	if a.attrs != nil {
+		return a.attrs.Attrs(conn)
+	}
+
+	if c, ok := conn.(AttributedConnection); ok {
+		return c.Attrs()
+	}
+
+	return nil
+}
+
+func (a *ACL) check(conn Connection, action ACLAction, topic string) error {
+	if !a.Allowed(conn, action, topic) {
+		return ErrAccessDenied
+	}
+
+	return nil
+}
+
+func (a *ACL) OnSubscribe(conn Connection, topic string) error {
+	return a.check(conn, ACLSubscribe, topic)
+}
+
+func (a *ACL) CheckSubscribe(conn Connection, topic string) error {
+	return a.check(conn, ACLSubscribe, topic)
+}
+
+func (a *ACL) OnPublishFrom(conn Connection, topic string, data []byte) error {
+	return a.check(conn, ACLPublish, topic)
+}
+
+func (a *ACL) OnBroadcastFrom(conn Connection, data []byte) error {
+	return a.check(conn, ACLBroadcast, "")
+}
+
+func (a *ACL) OnRemoveConnectionFrom(from Connection, conn Connection) error {
+	return a.check(from, ACLRemoveConnection, "")
+}
+
+// aclExpandTopic replaces the attribute placeholders in a topic pattern.
+// Attribute values that contain wildcards or level separators are rejected
+// so that they can't widen the pattern.
+func aclExpandTopic(pattern string, attrs map[string]any) (string, bool) {
+	ok := true
+
+	expanded := aclTemplate.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		val, found := attrs[placeholder[1:len(placeholder)-1]]
+		if !found {
+			ok = false
+			return placeholder
+		}
+
+		s := fmt.Sprint(val)
+		if s == "" || strings.ContainsAny(s, "+#"+TopicLevelSeparator) {
+			ok = false
+		}
+
+		return s
+	})
+
+	return expanded, ok
+}
+
+func aclAttrsMatch(want map[string]any, attrs map[string]any) bool {
+	for key, val := range want {
+		got, ok := attrs[key]
+		if !ok || !aclAttrMatches(val, got) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func aclAttrMatches(want any, got any) bool {
+	switch got := got.(type) {
+	case []string:
+		for _, item := range got {
+			if reflect.DeepEqual(want, item) {
+				return true
+			}
+		}
+		return false
+	case []any:
+		for _, item := range got {
+			if reflect.DeepEqual(want, item) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return reflect.DeepEqual(want, got)
+}
@@ -0,0 +1,149 @@
+package varto_test
+
+import (
+	"testing"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestACL(t *testing.T) {
+	newVarto := func(opts varto.ACLOptions) *varto.Varto {
+		v := varto.New(nil)
+		v.Use(varto.NewACL(v, opts))
+		return v
+	}
+
+	t.Run("TestACL_WhenNoRuleMatchesAndDenyByDefault_ThenReturnError", func(t *testing.T) {
+		v := newVarto(varto.ACLOptions{DenyByDefault: true})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		err := v.Subscribe(mockConnection, "topic")
+		assert.Equal(t, varto.ErrAccessDenied, err)
+	})
+
+	t.Run("TestACL_WhenNoRuleMatches_ThenAllow", func(t *testing.T) {
+		v := newVarto(varto.ACLOptions{})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		err := v.Subscribe(mockConnection, "topic")
+		assert.Nil(t, err)
+	})
+
+	t.Run("TestACL_WhenTopicTemplateMatchesUser_ThenAllowOnlyOwnTopics", func(t *testing.T) {
+		v := newVarto(varto.ACLOptions{
+			DenyByDefault: true,
+			Rules: []varto.ACLRule{
+				{Action: varto.ACLAll, Topic: "users/{user}/#"},
+			},
+		})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		v.SetAttr(mockConnection, "user", "alice")
+
+		assert.Nil(t, v.Subscribe(mockConnection, "users/alice/inbox"))
+		assert.Equal(t, varto.ErrAccessDenied, v.Subscribe(mockConnection, "users/bob/inbox"))
+	})
+
+	t.Run("TestACL_WhenAttributeContainsWildcard_ThenDeny", func(t *testing.T) {
+		v := newVarto(varto.ACLOptions{
+			DenyByDefault: true,
+			Rules: []varto.ACLRule{
+				{Action: varto.ACLSubscribe, Topic: "users/{user}"},
+			},
+		})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		v.SetAttr(mockConnection, "user", "#")
+
+		err := v.Subscribe(mockConnection, "users/bob")
+		assert.Equal(t, varto.ErrAccessDenied, err)
+	})
+
+	t.Run("TestACL_WhenRuleRequiresRole_ThenCheckAttributes", func(t *testing.T) {
+		v := newVarto(varto.ACLOptions{
+			DenyByDefault: true,
+			Rules: []varto.ACLRule{
+				{Action: varto.ACLPublish, Topic: "news/+", Attrs: map[string]any{"role": "editor"}},
+				{Action: varto.ACLSubscribe, Topic: "news/+"},
+			},
+		})
+		editor := mock.NewMockConnection(gomock.NewController(t))
+		editor.EXPECT().GetId().Return("editor").AnyTimes()
+		v.SetAttr(editor, "role", []string{"reader", "editor"})
+		reader := mock.NewMockConnection(gomock.NewController(t))
+		reader.EXPECT().GetId().Return("reader").AnyTimes()
+		v.SetAttr(reader, "role", []string{"reader"})
+
+		assert.Equal(t, varto.ErrTopicNotFound, v.PublishFrom(editor, "news/today", []byte("data")))
+		assert.Equal(t, varto.ErrAccessDenied, v.PublishFrom(reader, "news/today", []byte("data")))
+	})
+
+	t.Run("TestACL_WhenDenyRuleMatchesFirst_ThenDeny", func(t *testing.T) {
+		v := newVarto(varto.ACLOptions{
+			Rules: []varto.ACLRule{
+				{Action: varto.ACLSubscribe, Topic: "admin/#", Deny: true},
+				{Action: varto.ACLSubscribe, Topic: "#"},
+			},
+		})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		err := v.Subscribe(mockConnection, "admin")
+		assert.Equal(t, varto.ErrAccessDenied, err)
+	})
+
+	t.Run("TestACL_WhenPublishedWithoutConnection_ThenAllow", func(t *testing.T) {
+		v := newVarto(varto.ACLOptions{DenyByDefault: true})
+
+		err := v.Publish("topic", []byte("data"))
+		assert.Equal(t, varto.ErrTopicNotFound, err)
+	})
+	t.Run("TestACL_WhenAttrGetterIsNil_ThenUseConnectionAttrs", func(t *testing.T) {
+		acl := varto.NewACL(nil, varto.ACLOptions{
+			DenyByDefault: true,
+			Rules:         []varto.ACLRule{{Action: varto.ACLSubscribe, Topic: "users/{user}"}},
+		})
+		conn := &attributedConnection{
+			MockConnection: mock.NewMockConnection(gomock.NewController(t)),
+			attrs:          map[string]any{"user": "alice"},
+		}
+
+		assert.True(t, acl.Allowed(conn, varto.ACLSubscribe, "users/alice"))
+		assert.False(t, acl.Allowed(mock.NewMockConnection(gomock.NewController(t)), varto.ACLSubscribe, "users/alice"))
+	})
+	t.Run("TestACL_WhenFilterOverlapsDenyRule_ThenDeny", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		acl := varto.NewACL(v, varto.ACLOptions{
+			Rules: []varto.ACLRule{{Action: varto.ACLSubscribe, Topic: "private/#", Deny: true}},
+		})
+		v.Use(acl)
+		eve := mock.NewMockConnection(gomock.NewController(t))
+		eve.EXPECT().GetId().Return("eve").AnyTimes()
+
+		assert.Equal(t, varto.ErrAccessDenied, v.Subscribe(eve, "#"))
+		assert.Equal(t, varto.ErrAccessDenied, v.Subscribe(eve, "+/secret"))
+		assert.False(t, acl.Allowed(eve, varto.ACLSubscribe, "+"))
+		assert.Nil(t, v.Subscribe(eve, "public/#"))
+	})
+
+	t.Run("TestACL_WhenAllowRuleCoversOnlyPartOfFilter_ThenUseNextRules", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		acl := varto.NewACL(v, varto.ACLOptions{
+			DenyByDefault: true,
+			Rules:         []varto.ACLRule{{Action: varto.ACLSubscribe, Topic: "public/#"}},
+		})
+		v.Use(acl)
+		eve := mock.NewMockConnection(gomock.NewController(t))
+		eve.EXPECT().GetId().Return("eve").AnyTimes()
+
+		assert.Nil(t, v.Subscribe(eve, "public/+"))
+		assert.Nil(t, v.Subscribe(eve, "public/#"))
+		assert.Equal(t, varto.ErrAccessDenied, v.Subscribe(eve, "#"))
+		assert.Equal(t, varto.ErrAccessDenied, v.Subscribe(eve, "+/news"))
+	})
+}
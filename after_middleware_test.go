@@ -0,0 +1,115 @@
+package varto_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+type afterRecorder struct {
+	varto.BaseMiddleware
+	subscribeErrs []error
+	publishes     []varto.PublishReport
+	broadcasts    []varto.PublishReport
+	removed       int
+}
+
+func (m *afterRecorder) AfterSubscribe(conn varto.Connection, topic string, err error) {
+	m.subscribeErrs = append(m.subscribeErrs, err)
+}
+
+func (m *afterRecorder) AfterRemoveConnection(conn varto.Connection, err error) {
+	m.removed++
+}
+
+func (m *afterRecorder) AfterPublish(report varto.PublishReport) {
+	m.publishes = append(m.publishes, report)
+}
+
+func (m *afterRecorder) AfterBroadcastToAll(report varto.PublishReport) {
+	m.broadcasts = append(m.broadcasts, report)
+}
+
+func TestAfterMiddleware(t *testing.T) {
+	t.Run("TestAfterSubscribe_WhenSubscribeIsRejected_ThenReceiveError", func(t *testing.T) {
+		v := varto.New(&varto.Options{AllowedTopics: []string{"topic"}})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		recorder := &afterRecorder{}
+		v.Use(recorder)
+
+		v.Subscribe(mockConnection, "topic")
+		v.Subscribe(mockConnection, "topic2")
+
+		assert.Equal(t, []error{nil, varto.ErrTopicIsNotAllowed}, recorder.subscribeErrs)
+	})
+
+	t.Run("TestAfterSubscribe_WhenMiddlewareRejects_ThenReceiveError", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+
+		recorder := &afterRecorder{}
+		v.Use(varto.OnSubscribeFunc(func(conn varto.Connection, topic string) error {
+			return fmt.Errorf("error")
+		}))
+		v.Use(recorder)
+
+		v.Subscribe(mockConnection, "topic")
+
+		assert.Len(t, recorder.subscribeErrs, 1)
+		assert.NotNil(t, recorder.subscribeErrs[0])
+	})
+
+	t.Run("TestAfterPublish_WhenPublishedFromConnection_ThenReceiveReport", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(nil).AnyTimes()
+
+		recorder := &afterRecorder{}
+		v.Use(recorder)
+
+		v.Subscribe(mockConnection, "topic")
+		v.PublishFrom(mockConnection, "topic", []byte("data"))
+		v.Publish("topic2", []byte("data"))
+
+		assert.Equal(t, []varto.PublishReport{
+			{Topic: "topic", Data: []byte("data"), Id: 1, Connection: mockConnection, Recipients: 1},
+			{Topic: "topic2", Data: []byte("data"), Err: varto.ErrTopicNotFound},
+		}, recorder.publishes)
+	})
+
+	t.Run("TestAfterBroadcastToAll_WhenBroadcast_ThenReceiveReport", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(nil)
+
+		recorder := &afterRecorder{}
+		v.Use(recorder)
+
+		v.AddConnection(mockConnection)
+		v.BroadcastToAll([]byte("data"))
+
+		assert.Equal(t, []varto.PublishReport{{Data: []byte("data"), Recipients: 1}}, recorder.broadcasts)
+	})
+
+	t.Run("TestAfterRemoveConnection_WhenRemoved_ThenCall", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		recorder := &afterRecorder{}
+		v.Use(recorder)
+
+		v.AddConnection(mockConnection)
+		v.RemoveConnection(mockConnection)
+
+		assert.Equal(t, 1, recorder.removed)
+	})
+}
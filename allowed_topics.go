@@ -0,0 +1,190 @@
+package varto
+
+import "sync"
+
+// allowedTopics decides which topics can be subscribed to.
+// A topic is allowed if it is not disallowed and either there is no allowlist
+// or the allowlist contains it.
+type allowedTopics struct {
+	sync.RWMutex
+	allowed    map[string]bool
+	disallowed map[string]bool
+}
+
+func newAllowedTopics(topics []string) *allowedTopics {
+	a := &allowedTopics{
+		disallowed: make(map[string]bool),
+	}
+	a.set(topics)
+
+	return a
+}
+
+func (a *allowedTopics) set(topics []string) {
+	a.allowed = nil
+	a.disallowed = make(map[string]bool)
+
+	if len(topics) > 0 {
+		a.allowed = make(map[string]bool)
+		for _, topic := range topics {
+			a.allowed[topic] = true
+		}
+	}
+}
+
+func (a *allowedTopics) IsAllowed(topic string) bool {
+	a.RLock()
+	defer a.RUnlock()
+
+	return a.isAllowed(topic)
+}
+
+// isAllowed reports whether a topic is allowed. A topic pattern is not allowed if it matches
+// a disallowed topic, and it is only allowed by an allowlist that contains the pattern itself.
+func (a *allowedTopics) isAllowed(topic string) bool {
+	if a.disallowed[topic] {
+		return false
+	}
+
+	if isTopicPattern(topic) {
+		for disallowed := range a.disallowed {
+			if matchSubscription(topic, disallowed) {
+				return false
+			}
+		}
+	}
+
+	return a.allowed == nil || a.allowed[topic]
+}
+
+func (a *allowedTopics) Allow(topic string) {
+	a.Lock()
+	defer a.Unlock()
+
+	delete(a.disallowed, topic)
+	if a.allowed != nil {
+		a.allowed[topic] = true
+	}
+}
+
+func (a *allowedTopics) Disallow(topic string) {
+	a.Lock()
+	defer a.Unlock()
+
+	// The topic is also recorded as disallowed, since allowed patterns may still match it.
+	if a.allowed != nil {
+		delete(a.allowed, topic)
+	}
+	a.disallowed[topic] = true
+}
+
+func (a *allowedTopics) Set(topics []string) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.set(topics)
+}
+
+// AllowTopic allows subscribing to a topic.
+// If all topics are allowed, it only reverts a previous DisallowTopic call.
+func (v *Varto) AllowTopic(topic string) error {
+	if topic == "" {
+		return ErrInvalidTopicName
+	}
+
+	v.allowedTopics.Allow(topic)
+	return nil
+}
+
+// DisallowTopic disallows subscribing to a topic, and to the topic patterns that match it.
+// If Options.UnsubscribeOnDisallow is set, the existing subscribers of the topic
+// and of the patterns are unsubscribed.
+func (v *Varto) DisallowTopic(topic string) error {
+	if topic == "" {
+		return ErrInvalidTopicName
+	}
+
+	v.allowedTopics.Disallow(topic)
+
+	if !v.opts.UnsubscribeOnDisallow {
+		return nil
+	}
+
+	if err := v.unsubscribeAll(topic); err != nil {
+		return err
+	}
+
+	for _, pattern := range v.subscriptions.Topics() {
+		if !isTopicPattern(pattern) || v.allowedTopics.IsAllowed(pattern) {
+			continue
+		}
+
+		if err := v.unsubscribeAll(pattern); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetAllowedTopics replaces the list of allowed topics.
+// If topics is empty, all topics are allowed.
+// If Options.UnsubscribeOnDisallow is set, the subscribers of the topics
+// that are no longer allowed are unsubscribed.
+func (v *Varto) SetAllowedTopics(topics []string) error {
+	v.allowedTopics.Set(topics)
+
+	if !v.opts.UnsubscribeOnDisallow {
+		return nil
+	}
+
+	for _, topic := range v.subscriptions.Topics() {
+		if v.allowedTopics.IsAllowed(topic) {
+			continue
+		}
+
+		if err := v.unsubscribeAll(topic); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unsubscribeAll unsubscribes every subscriber of a topic, including disconnected sessions.
+// The middleware can't reject it, but their after-hooks are still called.
+func (v *Varto) unsubscribeAll(topicName string) error {
+	t, err := v.store.GetTopic(topicName)
+	if err == ErrTopicNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if v.sessions != nil {
+		v.detachSessionsFrom(t, topicName)
+	}
+
+	connections := v.subscriptions.ConnectionsOf(topicName)
+	if len(connections) == 0 && t.IsEmpty() {
+		if err := v.store.RemoveTopic(topicName); err != nil {
+			return err
+		}
+
+		v.emitTopicRemoved(topicName)
+	}
+
+	middlewares := v.middlewareContext.GetForTopic(topicName)
+	for _, conn := range connections {
+		err := v.unsubscribe(conn, t, topicName)
+		runAfterHooks(middlewares, func(m AfterMiddleware) {
+			m.AfterUnsubscribe(conn, topicName, err)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package varto_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAllowedTopics(t *testing.T) {
+	t.Run("TestAllowTopic_WhenTopicIsAllowed_ThenSubscribe", func(t *testing.T) {
+		v := varto.New(&varto.Options{AllowedTopics: []string{"topic"}})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		assert.Equal(t, varto.ErrTopicIsNotAllowed, v.Subscribe(mockConnection, "topic2"))
+
+		v.AllowTopic("topic2")
+		assert.Nil(t, v.Subscribe(mockConnection, "topic2"))
+	})
+
+	t.Run("TestAllowTopic_WhenTopicNameIsEmpty_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		assert.Equal(t, varto.ErrInvalidTopicName, v.AllowTopic(""))
+		assert.Equal(t, varto.ErrInvalidTopicName, v.DisallowTopic(""))
+	})
+
+	t.Run("TestDisallowTopic_WhenAllTopicsAreAllowed_ThenDisallowOnlyTopic", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.DisallowTopic("topic")
+		assert.Equal(t, varto.ErrTopicIsNotAllowed, v.Subscribe(mockConnection, "topic"))
+		assert.Nil(t, v.Subscribe(mockConnection, "topic2"))
+
+		v.AllowTopic("topic")
+		assert.Nil(t, v.Subscribe(mockConnection, "topic"))
+	})
+
+	t.Run("TestDisallowTopic_WhenUnsubscribeOnDisallow_ThenUnsubscribeSubscribers", func(t *testing.T) {
+		v := varto.New(&varto.Options{UnsubscribeOnDisallow: true})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Subscribe(mockConnection, "topic")
+		err := v.DisallowTopic("topic")
+		assert.Nil(t, err)
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic", []byte("data")))
+	})
+
+	t.Run("TestDisallowTopic_WhenNotUnsubscribeOnDisallow_ThenKeepSubscribers", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Subscribe(mockConnection, "topic")
+		v.DisallowTopic("topic")
+
+		members, _ := v.Presence("topic")
+		assert.Len(t, members, 1)
+	})
+
+	t.Run("TestSetAllowedTopics_WhenTopicsAreReplaced_ThenUnsubscribeDisallowedTopics", func(t *testing.T) {
+		v := varto.New(&varto.Options{UnsubscribeOnDisallow: true})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Subscribe(mockConnection, "topic")
+		v.Subscribe(mockConnection, "topic2")
+		err := v.SetAllowedTopics([]string{"topic2"})
+		assert.Nil(t, err)
+
+		members, _ := v.Presence("topic")
+		assert.Empty(t, members)
+		members, _ = v.Presence("topic2")
+		assert.Len(t, members, 1)
+		assert.Equal(t, varto.ErrTopicIsNotAllowed, v.Subscribe(mockConnection, "topic"))
+	})
+
+	t.Run("TestSetAllowedTopics_WhenTopicsAreEmpty_ThenAllowAllTopics", func(t *testing.T) {
+		v := varto.New(&varto.Options{AllowedTopics: []string{"topic"}})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.SetAllowedTopics(nil)
+		assert.Nil(t, v.Subscribe(mockConnection, "topic2"))
+	})
+	t.Run("TestDisallowTopic_WhenSubscribingConcurrently_ThenLeaveNoSubscribers", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			v := varto.New(&varto.Options{UnsubscribeOnDisallow: true})
+			mockConnection := mock.NewMockConnection(gomock.NewController(t))
+			mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				v.Subscribe(mockConnection, "topic")
+			}()
+			v.DisallowTopic("topic")
+			<-done
+
+			members, _ := v.Presence("topic")
+			assert.Empty(t, members)
+			assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic", []byte("data")))
+		}
+	})
+
+	t.Run("TestDisallowTopic_WhenSessionIsDisconnected_ThenRemoveTopicFromSession", func(t *testing.T) {
+		v := varto.New(&varto.Options{UnsubscribeOnDisallow: true, SessionExpiry: time.Minute, SessionQueueSize: 10})
+		mockConnection1 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection1.EXPECT().GetId().Return("id1").AnyTimes()
+		mockConnection2 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection2.EXPECT().GetId().Return("id2").AnyTimes()
+
+		v.AddConnection(mockConnection1)
+		v.ResumeSession(mockConnection1, "session")
+		v.Subscribe(mockConnection1, "topic")
+		v.RemoveConnection(mockConnection1)
+
+		assert.Nil(t, v.DisallowTopic("topic"))
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic", []byte("data")))
+
+		v.AddConnection(mockConnection2)
+		resumed, err := v.ResumeSession(mockConnection2, "session")
+		assert.Nil(t, err)
+		assert.True(t, resumed)
+		assert.Empty(t, v.Subscribers("topic"))
+	})
+	t.Run("TestDisallowTopic_WhenPatternMatchesTopic_ThenDisallowPattern", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.DisallowTopic("private/secret")
+		assert.Equal(t, varto.ErrTopicIsNotAllowed, v.Subscribe(mockConnection, "#"))
+		assert.Equal(t, varto.ErrTopicIsNotAllowed, v.Subscribe(mockConnection, "private/+"))
+		assert.Nil(t, v.Subscribe(mockConnection, "public/#"))
+	})
+
+	t.Run("TestDisallowTopic_WhenUnsubscribeOnDisallow_ThenUnsubscribeMatchingPatterns", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true, UnsubscribeOnDisallow: true})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Subscribe(mockConnection, "#")
+		v.Subscribe(mockConnection, "public/#")
+		assert.Nil(t, v.DisallowTopic("private/secret"))
+
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("private/secret", []byte("data")))
+		assert.Equal(t, []string{"public/#"}, v.Topics())
+	})
+
+	t.Run("TestDisallowTopic_WhenAllowedPatternMatchesTopic_ThenDisallowPattern", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true, UnsubscribeOnDisallow: true, AllowedTopics: []string{"a/+", "a/b"}})
+		mockConnection1 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection1.EXPECT().GetId().Return("id1").AnyTimes()
+		mockConnection2 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection2.EXPECT().GetId().Return("id2").AnyTimes()
+
+		assert.Nil(t, v.Subscribe(mockConnection1, "a/+"))
+		assert.Nil(t, v.DisallowTopic("a/b"))
+
+		assert.Equal(t, varto.ErrTopicIsNotAllowed, v.Subscribe(mockConnection2, "a/+"))
+		assert.Equal(t, varto.ErrTopicIsNotAllowed, v.Subscribe(mockConnection2, "a/b"))
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("a/b", []byte("data")))
+	})
+
+	t.Run("TestSetAllowedTopics_WhenPatternIsNotListed_ThenDisallowIt", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true, AllowedTopics: []string{"a/b", "c/#"}})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		assert.Equal(t, varto.ErrTopicIsNotAllowed, v.Subscribe(mockConnection, "a/+"))
+		assert.Nil(t, v.Subscribe(mockConnection, "c/#"))
+	})
+}
@@ -0,0 +1,117 @@
+package varto
+
+import "sync"
+
+// AttributedConnection is a connection that carries its own attributes,
+// such as the user id, tenant or auth claims of the client.
+type AttributedConnection interface {
+	Connection
+
+	// Attrs returns the attributes of the connection.
+	Attrs() map[string]any
+}
+
+// AttrGetter returns the attributes of a connection.
+// Varto implements it, so it can be passed to middleware that need attributes.
+type AttrGetter interface {
+	Attrs(conn Connection) map[string]any
+}
+
+type attributeStore struct {
+	sync.RWMutex
+	items map[string]map[string]any
+}
+
+func newAttributeStore() *attributeStore {
+	return &attributeStore{
+		items: make(map[string]map[string]any),
+	}
+}
+
+func (s *attributeStore) Set(conn Connection, key string, val any) {
+	s.Lock()
+	defer s.Unlock()
+
+	id := conn.GetId()
+	if _, ok := s.items[id]; !ok {
+		s.items[id] = make(map[string]any)
+	}
+
+	s.items[id][key] = val
+}
+
+func (s *attributeStore) Delete(conn Connection, key string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.items[conn.GetId()], key)
+}
+
+func (s *attributeStore) GetAll(conn Connection) map[string]any {
+	s.RLock()
+	defer s.RUnlock()
+
+	items := s.items[conn.GetId()]
+	attrs := make(map[string]any, len(items))
+	for k, v := range items {
+		attrs[k] = v
+	}
+
+	return attrs
+}
+
+func (s *attributeStore) Remove(conn Connection) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.items, conn.GetId())
+}
+
+// SetAttr sets an attribute of a connection.
+// Attributes are removed when the connection is removed.
+func (v *Varto) SetAttr(conn Connection, key string, val any) error {
+	if conn == nil {
+		return ErrNilConnection
+	}
+
+	v.attributes.Set(conn, key, val)
+	return nil
+}
+
+// DeleteAttr deletes an attribute of a connection.
+func (v *Varto) DeleteAttr(conn Connection, key string) error {
+	if conn == nil {
+		return ErrNilConnection
+	}
+
+	v.attributes.Delete(conn, key)
+	return nil
+}
+
+// Attr returns an attribute of a connection.
+func (v *Varto) Attr(conn Connection, key string) (any, bool) {
+	val, ok := v.Attrs(conn)[key]
+	return val, ok
+}
+
+// Attrs returns a copy of the attributes of a connection.
+// If the connection is an AttributedConnection, its own attributes are included,
+// and attributes set with SetAttr take precedence over them.
+func (v *Varto) Attrs(conn Connection) map[string]any {
+	if conn == nil {
+		return map[string]any{}
+	}
+
+	attrs := make(map[string]any)
+	if c, ok := conn.(AttributedConnection); ok {
+		for k, val := range c.Attrs() {
+			attrs[k] = val
+		}
+	}
+
+	for k, val := range v.attributes.GetAll(conn) {
+		attrs[k] = val
+	}
+
+	return attrs
+}
@@ -0,0 +1,106 @@
+package varto_test
+
+import (
+	"testing"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+type attributedConnection struct {
+	*mock.MockConnection
+	attrs map[string]any
+}
+
+func (c *attributedConnection) Attrs() map[string]any {
+	return c.attrs
+}
+
+func TestAttrs(t *testing.T) {
+	t.Run("TestAttrs_WhenAttrIsSet_ThenReturnIt", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		err := v.SetAttr(mockConnection, "user", "alice")
+		assert.Nil(t, err)
+
+		val, ok := v.Attr(mockConnection, "user")
+		assert.True(t, ok)
+		assert.Equal(t, "alice", val)
+		assert.Equal(t, map[string]any{"user": "alice"}, v.Attrs(mockConnection))
+	})
+
+	t.Run("TestAttrs_WhenConnectionIsNil_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		err := v.SetAttr(nil, "user", "alice")
+		assert.Equal(t, varto.ErrNilConnection, err)
+	})
+
+	t.Run("TestAttrs_WhenAttrIsDeleted_ThenReturnNotFound", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.SetAttr(mockConnection, "user", "alice")
+		v.DeleteAttr(mockConnection, "user")
+
+		_, ok := v.Attr(mockConnection, "user")
+		assert.False(t, ok)
+	})
+
+	t.Run("TestAttrs_WhenConnectionIsAttributed_ThenMergeAttrs", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := &attributedConnection{
+			MockConnection: mock.NewMockConnection(gomock.NewController(t)),
+			attrs:          map[string]any{"user": "alice", "tenant": "acme"},
+		}
+		conn.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.SetAttr(conn, "user", "bob")
+		assert.Equal(t, map[string]any{"user": "bob", "tenant": "acme"}, v.Attrs(conn))
+	})
+
+	t.Run("TestAttrs_WhenConnectionIsNotHashable_ThenKeyAttrsById", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := valueConnection{id: "id", tags: map[string]string{}}
+
+		assert.NotPanics(t, func() {
+			assert.Nil(t, v.AddConnection(conn))
+			assert.Nil(t, v.SetAttr(conn, "user", "alice"))
+			assert.Equal(t, map[string]any{"user": "alice"}, v.Attrs(conn))
+			assert.Nil(t, v.RemoveConnection(conn))
+		})
+		assert.Empty(t, v.Attrs(conn))
+	})
+
+	t.Run("TestAttrs_WhenConnectionIsRemoved_ThenCleanUpAttrs", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.AddConnection(mockConnection)
+		v.SetAttr(mockConnection, "user", "alice")
+		v.RemoveConnection(mockConnection)
+
+		assert.Empty(t, v.Attrs(mockConnection))
+	})
+
+	t.Run("TestAttrs_WhenMiddlewareIsCalled_ThenAttrsAreAvailable", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		mockMiddleware := mock.NewMockMiddleware(gomock.NewController(t))
+		mockMiddleware.EXPECT().OnSubscribe(mockConnection, "topic").DoAndReturn(func(conn varto.Connection, topic string) error {
+			assert.Equal(t, "alice", v.Attrs(conn)["user"])
+			return nil
+		})
+
+		v.Use(mockMiddleware)
+		v.SetAttr(mockConnection, "user", "alice")
+		v.Subscribe(mockConnection, "topic")
+	})
+}
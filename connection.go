@@ -1,7 +1,29 @@
 package varto
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
 type Connection interface {
 	Read() ([]byte, error)
 	Write([]byte) error
 	GetId() string
 }
+
+// reservedIdPrefix starts the ids of the connections Varto makes itself, such as session queues
+// and in-process subscribers. Connections can't use ids starting with it, so they never take
+// the place of one of these in a topic.
+const reservedIdPrefix = "\x00"
+
+func isReservedConnectionId(id string) bool {
+	return strings.HasPrefix(id, reservedIdPrefix)
+}
+
+// NewConnectionId returns a random connection id, for transports whose clients don't choose one.
+func NewConnectionId() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -7,3 +7,22 @@ var ErrConnectionNotFound = errors.New("connection not found")
 var ErrInvalidTopicName = errors.New("invalid topic name")
 var ErrNilConnection = errors.New("connection is nil")
 var ErrTopicIsNotAllowed = errors.New("topic is not allowed")
+var ErrInvalidSessionId = errors.New("invalid session id")
+var ErrSessionsDisabled = errors.New("sessions are disabled")
+var ErrSessionInUse = errors.New("session is in use")
+var ErrSessionNotOwned = errors.New("session belongs to another owner")
+var ErrReservedConnectionId = errors.New("connection id is reserved")
+var ErrAccessDenied = errors.New("access denied")
+var ErrRateLimited = errors.New("rate limited")
+var ErrTooManyConnections = errors.New("too many connections")
+var ErrTooManySubscriptions = errors.New("too many subscriptions for connection")
+var ErrTooManySubscribers = errors.New("too many subscribers for topic")
+var ErrTooManyTopics = errors.New("too many topics")
+var ErrPayloadTooLarge = errors.New("payload too large")
+var ErrReservedTopic = errors.New("topic is reserved for system events")
+var ErrInvalidCommand = errors.New("invalid command")
+var ErrSubscriptionClosed = errors.New("subscription is cancelled")
+var ErrSlowConsumer = errors.New("subscriber buffer is full")
+var ErrUnsupportedType = errors.New("unsupported type")
+var ErrDecode = errors.New("message can't be decoded")
+var ErrInvalidHeartbeatOptions = errors.New("invalid heartbeat options")
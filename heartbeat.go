@@ -0,0 +1,286 @@
+package varto
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultHeartbeatInterval is the interval of heartbeats if HeartbeatOptions.Interval is zero.
+const DefaultHeartbeatInterval = 30 * time.Second
+
+// Pinger is an optional interface for connections that can send a ping of their own protocol,
+// such as a WebSocket ping frame. Heartbeats use it instead of writing HeartbeatOptions.Payload.
+type Pinger interface {
+	Ping() error
+}
+
+// Toucher is an optional interface for connections that record activity, such as the
+// connections returned by Heartbeat.Track.
+type Toucher interface {
+	// Touch records activity on the connection.
+	Touch()
+}
+
+// Touch records activity on a connection if it implements Toucher. Transports call it
+// when they receive data that doesn't pass through Read, such as a WebSocket pong.
+func Touch(conn Connection) {
+	if t, ok := conn.(Toucher); ok {
+		t.Touch()
+	}
+}
+
+// HeartbeatOptions configures a Heartbeat.
+type HeartbeatOptions struct {
+	// Interval is how often connections are checked. Connections that have been idle
+	// for at least Interval are pinged. If it is zero, DefaultHeartbeatInterval is used.
+	// NewHeartbeat also uses it for a negative interval.
+	Interval time.Duration
+
+	// IdleTimeout is how long a connection may be idle before it is removed.
+	// If it is zero, three times Interval is used. NewHeartbeat also uses it for a negative timeout.
+	IdleTimeout time.Duration
+
+	// Payload is written to connections that don't implement Pinger.
+	// If it is nil, they are not pinged and only checked for idleness.
+	Payload []byte
+}
+
+// Heartbeat pings idle connections and removes the ones that stay idle past the idle timeout.
+// It manages the connections returned by Track once they are added to the Varto.
+// Reads of a tracked connection and Touch, such as for a pong, count as activity. Writes and pings
+// don't, so a peer that stopped reading is removed even while messages are written to it.
+type Heartbeat struct {
+	v      *Varto
+	opts   HeartbeatOptions
+	handle *MiddlewareHandle
+
+	mu           sync.Mutex
+	lastActivity map[*trackedConnection]time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewHeartbeat starts a heartbeat for the connections of v.
+// It adds a middleware to v to know which connections are added and removed;
+// the middleware is removed by Stop.
+func NewHeartbeat(v *Varto, opts *HeartbeatOptions) *Heartbeat {
+	h := &Heartbeat{
+		v:            v,
+		lastActivity: make(map[*trackedConnection]time.Time),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	if opts != nil {
+		h.opts = *opts
+	}
+
+	if h.opts.Interval <= 0 {
+		h.opts.Interval = DefaultHeartbeatInterval
+	}
+
+	if h.opts.IdleTimeout <= 0 {
+		h.opts.IdleTimeout = 3 * h.opts.Interval
+	}
+
+	h.handle = v.Use(&heartbeatMiddleware{heartbeat: h})
+	go h.run()
+
+	return h
+}
+
+// StartHeartbeat is like NewHeartbeat, but returns ErrInvalidHeartbeatOptions
+// if the interval or the idle timeout is negative instead of using the defaults.
+func StartHeartbeat(v *Varto, opts *HeartbeatOptions) (*Heartbeat, error) {
+	if opts != nil && (opts.Interval < 0 || opts.IdleTimeout < 0) {
+		return nil, ErrInvalidHeartbeatOptions
+	}
+
+	return NewHeartbeat(v, opts), nil
+}
+
+// Track wraps a connection so that its reads count as activity.
+// Add the returned connection to the Varto, or Serve it, instead of conn.
+// The transports of varto take it as their Wrap option.
+func (h *Heartbeat) Track(conn Connection) Connection {
+	return &trackedConnection{Connection: conn, heartbeat: h}
+}
+
+// Touch records activity on a tracked connection, such as a pong
+// received by a connection whose reads don't return it.
+func (h *Heartbeat) Touch(conn Connection) {
+	t, ok := conn.(*trackedConnection)
+	if !ok || t.heartbeat != h {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.lastActivity[t]; ok {
+		h.lastActivity[t] = time.Now()
+	}
+}
+
+// LastActivity returns the time of the last activity on a tracked connection.
+// It returns false if the connection is not managed by the heartbeat.
+func (h *Heartbeat) LastActivity(conn Connection) (time.Time, bool) {
+	t, ok := conn.(*trackedConnection)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	last, ok := h.lastActivity[t]
+	return last, ok
+}
+
+// Stop stops the heartbeat and removes its middleware. It is safe to call more than once.
+func (h *Heartbeat) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+		h.handle.Remove()
+	})
+
+	<-h.done
+}
+
+func (h *Heartbeat) run() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case now := <-ticker.C:
+			h.check(now)
+		}
+	}
+}
+
+// check removes the connections that are idle past the idle timeout and pings the other idle ones.
+// A connection that can't be pinged is removed as well.
+func (h *Heartbeat) check(now time.Time) {
+	h.mu.Lock()
+	var expired, idle []*trackedConnection
+	for conn, last := range h.lastActivity {
+		switch {
+		case now.Sub(last) >= h.opts.IdleTimeout:
+			expired = append(expired, conn)
+		case now.Sub(last) >= h.opts.Interval:
+			idle = append(idle, conn)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, conn := range idle {
+		if err := h.ping(conn); err != nil {
+			expired = append(expired, conn)
+		}
+	}
+
+	for _, conn := range expired {
+		h.expire(conn)
+	}
+}
+
+// ping pings a connection without counting it as activity.
+func (h *Heartbeat) ping(conn *trackedConnection) error {
+	if p, ok := conn.Connection.(Pinger); ok {
+		return p.Ping()
+	}
+
+	if h.opts.Payload == nil {
+		return nil
+	}
+
+	return conn.Connection.Write(h.opts.Payload)
+}
+
+// expire removes an idle connection and closes it if it can be closed,
+// so that a goroutine blocked reading from it returns.
+func (h *Heartbeat) expire(conn *trackedConnection) {
+	h.untrack(conn)
+	h.v.RemoveConnection(conn)
+
+	if c, ok := conn.Connection.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+func (h *Heartbeat) track(conn *trackedConnection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastActivity[conn] = time.Now()
+}
+
+func (h *Heartbeat) untrack(conn *trackedConnection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.lastActivity, conn)
+}
+
+// heartbeatMiddleware starts and stops managing tracked connections as they are added and removed.
+type heartbeatMiddleware struct {
+	BaseMiddleware
+	heartbeat *Heartbeat
+}
+
+func (m *heartbeatMiddleware) AfterAddConnection(conn Connection, err error) {
+	if t, ok := conn.(*trackedConnection); ok && t.heartbeat == m.heartbeat && err == nil {
+		m.heartbeat.track(t)
+	}
+}
+
+func (m *heartbeatMiddleware) AfterRemoveConnection(conn Connection, err error) {
+	if t, ok := conn.(*trackedConnection); ok && t.heartbeat == m.heartbeat {
+		m.heartbeat.untrack(t)
+	}
+}
+
+// trackedConnection records the reads of a connection as activity.
+// It passes messages, attributes and Close through to the connection.
+type trackedConnection struct {
+	Connection
+	heartbeat *Heartbeat
+}
+
+func (c *trackedConnection) Touch() {
+	c.heartbeat.Touch(c)
+}
+
+func (c *trackedConnection) Read() ([]byte, error) {
+	data, err := c.Connection.Read()
+	if err == nil {
+		c.heartbeat.Touch(c)
+	}
+	return data, err
+}
+
+func (c *trackedConnection) WriteMessage(msg Message) error {
+	return writeMessage(c.Connection, msg)
+}
+
+func (c *trackedConnection) Attrs() map[string]any {
+	if a, ok := c.Connection.(AttributedConnection); ok {
+		return a.Attrs()
+	}
+	return nil
+}
+
+func (c *trackedConnection) Close() error {
+	if closer, ok := c.Connection.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package varto_test
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/internal/testutil"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+type pingerConnection struct {
+	*mock.MockConnection
+	pings   atomic.Int32
+	closed  atomic.Bool
+	pingErr error
+}
+
+func (c *pingerConnection) Ping() error {
+	c.pings.Add(1)
+	return c.pingErr
+}
+
+func (c *pingerConnection) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestHeartbeat(t *testing.T) {
+	t.Run("TestHeartbeat_WhenConnectionIsIdle_ThenPingAndRemoveIt", func(t *testing.T) {
+		v := varto.New(nil)
+		h := varto.NewHeartbeat(v, &varto.HeartbeatOptions{Interval: 10 * time.Millisecond, IdleTimeout: 50 * time.Millisecond, Payload: []byte("ping")})
+		defer h.Stop()
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("ping")).Return(nil).MinTimes(1)
+
+		conn := h.Track(mockConnection)
+		assert.Nil(t, v.AddConnection(conn))
+		testutil.WaitFor(t, func() bool {
+			stats, _ := v.Stats()
+			return stats.Connections == 0
+		})
+
+		_, ok := h.LastActivity(conn)
+		assert.False(t, ok)
+	})
+
+	t.Run("TestHeartbeat_WhenConnectionIsActive_ThenKeepIt", func(t *testing.T) {
+		v := varto.New(nil)
+		h := varto.NewHeartbeat(v, &varto.HeartbeatOptions{Interval: 10 * time.Millisecond, IdleTimeout: 100 * time.Millisecond})
+		defer h.Stop()
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Read().Return([]byte("data"), nil).AnyTimes()
+
+		conn := h.Track(mockConnection)
+		assert.Nil(t, v.AddConnection(conn))
+		for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+			time.Sleep(10 * time.Millisecond)
+			conn.Read()
+		}
+
+		stats, _ := v.Stats()
+		assert.Equal(t, 1, stats.Connections)
+		last, ok := h.LastActivity(conn)
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now(), last, 100*time.Millisecond)
+	})
+
+	t.Run("TestHeartbeat_WhenConnectionIsOnlyWrittenTo_ThenRemoveIt", func(t *testing.T) {
+		v := varto.New(nil)
+		h := varto.NewHeartbeat(v, &varto.HeartbeatOptions{Interval: 10 * time.Millisecond, IdleTimeout: 50 * time.Millisecond})
+		defer h.Stop()
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(nil).AnyTimes()
+
+		conn := h.Track(mockConnection)
+		assert.Nil(t, v.AddConnection(conn))
+		for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+			time.Sleep(10 * time.Millisecond)
+			conn.Write([]byte("data"))
+		}
+
+		stats, _ := v.Stats()
+		assert.Equal(t, 0, stats.Connections)
+	})
+
+	t.Run("TestHeartbeat_WhenConnectionIsPinger_ThenPingAndCloseIt", func(t *testing.T) {
+		v := varto.New(nil)
+		h := varto.NewHeartbeat(v, &varto.HeartbeatOptions{Interval: 10 * time.Millisecond, IdleTimeout: 35 * time.Millisecond, Payload: []byte("ping")})
+		defer h.Stop()
+		pinger := &pingerConnection{MockConnection: mock.NewMockConnection(gomock.NewController(t))}
+		pinger.EXPECT().GetId().Return("id").AnyTimes()
+
+		assert.Nil(t, v.AddConnection(h.Track(pinger)))
+		testutil.WaitFor(t, pinger.closed.Load)
+
+		assert.GreaterOrEqual(t, pinger.pings.Load(), int32(1))
+		stats, _ := v.Stats()
+		assert.Equal(t, 0, stats.Connections)
+	})
+
+	t.Run("TestHeartbeat_WhenPingFails_ThenRemoveConnection", func(t *testing.T) {
+		v := varto.New(nil)
+		h := varto.NewHeartbeat(v, &varto.HeartbeatOptions{Interval: 10 * time.Millisecond, IdleTimeout: time.Minute})
+		defer h.Stop()
+		pinger := &pingerConnection{MockConnection: mock.NewMockConnection(gomock.NewController(t)), pingErr: fmt.Errorf("error")}
+		pinger.EXPECT().GetId().Return("id").AnyTimes()
+
+		assert.Nil(t, v.AddConnection(h.Track(pinger)))
+		testutil.WaitFor(t, func() bool {
+			stats, _ := v.Stats()
+			return stats.Connections == 0
+		})
+
+		assert.Equal(t, int32(1), pinger.pings.Load())
+	})
+
+	t.Run("TestHeartbeat_WhenConnectionIsNotTracked_ThenKeepIt", func(t *testing.T) {
+		v := varto.New(nil)
+		h := varto.NewHeartbeat(v, &varto.HeartbeatOptions{Interval: 10 * time.Millisecond, IdleTimeout: 20 * time.Millisecond})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		assert.Nil(t, v.AddConnection(mockConnection))
+		time.Sleep(50 * time.Millisecond)
+		h.Stop()
+		h.Stop()
+
+		stats, _ := v.Stats()
+		assert.Equal(t, 1, stats.Connections)
+	})
+
+	t.Run("TestHeartbeat_WhenConnectionIsTouched_ThenKeepIt", func(t *testing.T) {
+		v := varto.New(nil)
+		h := varto.NewHeartbeat(v, &varto.HeartbeatOptions{Interval: 10 * time.Millisecond, IdleTimeout: 100 * time.Millisecond})
+		defer h.Stop()
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		conn := h.Track(mockConnection)
+		assert.Nil(t, v.AddConnection(conn))
+		for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+			time.Sleep(10 * time.Millisecond)
+			varto.Touch(conn)
+		}
+
+		stats, _ := v.Stats()
+		assert.Equal(t, 1, stats.Connections)
+	})
+
+	t.Run("TestHeartbeat_WhenIntervalIsNegative_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+
+		h, err := varto.StartHeartbeat(v, &varto.HeartbeatOptions{Interval: -time.Second})
+
+		assert.Nil(t, h)
+		assert.ErrorIs(t, err, varto.ErrInvalidHeartbeatOptions)
+	})
+
+	t.Run("TestHeartbeat_WhenIdleTimeoutIsNegative_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+
+		h, err := varto.StartHeartbeat(v, &varto.HeartbeatOptions{IdleTimeout: -time.Second})
+
+		assert.Nil(t, h)
+		assert.ErrorIs(t, err, varto.ErrInvalidHeartbeatOptions)
+	})
+
+	t.Run("TestHeartbeat_WhenOptionsAreValid_ThenStart", func(t *testing.T) {
+		v := varto.New(nil)
+
+		h, err := varto.StartHeartbeat(v, &varto.HeartbeatOptions{Interval: time.Second})
+
+		assert.Nil(t, err)
+		h.Stop()
+	})
+}
@@ -0,0 +1,137 @@
+package httpapi
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metinorak/varto"
+)
+
+// Caller is the authenticated client of a request. It implements varto.AttributedConnection,
+// so that middleware such as an ACL can check what the caller may publish.
+// It is never subscribed to topics, and writes to it, such as broadcasts, are dropped.
+type Caller struct {
+	Id         string
+	Attributes map[string]any
+}
+
+func (c *Caller) GetId() string {
+	return c.Id
+}
+
+func (c *Caller) Read() ([]byte, error) {
+	return nil, io.EOF
+}
+
+func (c *Caller) Write(data []byte) error {
+	return nil
+}
+
+func (c *Caller) Attrs() map[string]any {
+	return c.Attributes
+}
+
+// callers interns the callers of requests by id, so that the requests of a caller are made
+// by the same connection. A caller is added to varto on its first request, unless a connection
+// with its id exists, and is removed once it has made no request for the ttl, which releases
+// the state middleware keep for it.
+type callers struct {
+	sync.Mutex
+	v       *varto.Varto
+	ttl     time.Duration
+	callers map[string]*callerEntry
+}
+
+type callerEntry struct {
+	caller *Caller
+	// added is the caller added to varto, or nil if a connection with its id owns the state.
+	added    *Caller
+	requests int
+	timer    *time.Timer
+}
+
+func newCallers(v *varto.Varto, ttl time.Duration) *callers {
+	return &callers{
+		v:       v,
+		ttl:     ttl,
+		callers: make(map[string]*callerEntry),
+	}
+}
+
+// acquire returns the interned caller with the id of caller for a request.
+// The interned caller is replaced if the attributes of the caller changed.
+// It returns the error of adding the caller to varto, e.g. of a middleware.
+func (c *callers) acquire(caller *Caller) (*Caller, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.callers[caller.Id]
+	if !ok {
+		entry = &callerEntry{caller: caller}
+		if _, err := c.v.GetConnection(caller.Id); err == varto.ErrConnectionNotFound {
+			if err := c.v.AddConnection(caller); err != nil {
+				return nil, err
+			}
+			entry.added = caller
+		}
+		c.callers[caller.Id] = entry
+	}
+
+	if entry.timer != nil {
+		entry.timer.Stop()
+		entry.timer = nil
+	}
+
+	if !reflect.DeepEqual(entry.caller.Attributes, caller.Attributes) {
+		entry.caller = caller
+	}
+
+	entry.requests++
+	return entry.caller, nil
+}
+
+// release ends a request of a caller and schedules removing it once it is idle.
+func (c *callers) release(caller *Caller) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry := c.callers[caller.Id]
+	entry.requests--
+	if entry.requests > 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(c.ttl, func() {
+		c.Lock()
+		if c.callers[caller.Id] != entry || entry.timer != timer {
+			c.Unlock()
+			return
+		}
+		delete(c.callers, caller.Id)
+		c.Unlock()
+
+		// The caller may have been removed meanwhile, e.g. by an admin.
+		if conn, err := c.v.GetConnection(caller.Id); err == nil && entry.added != nil && conn == varto.Connection(entry.added) {
+			c.v.RemoveConnection(entry.added)
+		}
+	})
+	entry.timer = timer
+}
+
+// BearerAuth returns an authentication function that passes the bearer token
+// of the Authorization header to lookup.
+func BearerAuth(lookup func(token string) (*Caller, error)) func(r *http.Request) (*Caller, error) {
+	return func(r *http.Request) (*Caller, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return nil, ErrUnauthorized
+		}
+
+		return lookup(token)
+	}
+}
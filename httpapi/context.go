@@ -0,0 +1,13 @@
+package httpapi
+
+import "context"
+
+type callerKey struct{}
+
+func withCaller(ctx context.Context, caller *Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+func callerOf(ctx context.Context) *Caller {
+	return ctx.Value(callerKey{}).(*Caller)
+}
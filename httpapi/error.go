@@ -0,0 +1,44 @@
+package httpapi
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/metinorak/varto"
+)
+
+var ErrUnauthorized = errors.New("unauthorized")
+
+// statusCode maps the errors of varto and its middleware to HTTP status codes.
+func statusCode(err error) int {
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, varto.ErrAccessDenied), errors.Is(err, varto.ErrTopicIsNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, varto.ErrTopicNotFound), errors.Is(err, varto.ErrConnectionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, varto.ErrInvalidTopicName), errors.Is(err, varto.ErrReservedTopic):
+		return http.StatusBadRequest
+	case errors.Is(err, varto.ErrPayloadTooLarge), errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, varto.ErrRateLimited):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// retryAfter returns the Retry-After header value of a rate limit error in whole seconds.
+func retryAfter(err error) (string, bool) {
+	var rateLimitErr *varto.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		return "", false
+	}
+
+	return strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))), true
+}
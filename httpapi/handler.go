@@ -0,0 +1,255 @@
+// Package httpapi provides an HTTP API for publishing to varto without a persistent connection,
+// and for inspecting and managing its topics and connections.
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/metinorak/varto"
+)
+
+// DefaultMaxBodySize is the maximum size of a published body if Options.MaxBodySize is zero.
+const DefaultMaxBodySize = 1 << 20
+
+// DefaultCallerTTL is how long the state of a caller is kept after its last request if Options.CallerTTL is zero.
+const DefaultCallerTTL = time.Minute
+
+// AnonymousCaller is the caller of the requests when Options.Authenticate is nil.
+var AnonymousCaller = &Caller{Id: "anonymous"}
+
+// Options configures the HTTP API.
+type Options struct {
+	// Authenticate returns the caller of a request. Errors are answered with
+	// 401 Unauthorized, unless they map to another status code.
+	// If it is nil, every request is made by AnonymousCaller.
+	Authenticate func(r *http.Request) (*Caller, error)
+
+	// AdminRoutes serves the routes for broadcasting, listing topics and subscribers,
+	// and removing connections. They require Authenticate and are answered with
+	// 401 Unauthorized without it. Broadcasts and removals are made on behalf of the caller,
+	// so an ACL can check them with ACLBroadcast and ACLRemoveConnection, and listings
+	// with ACLSubscribe.
+	AdminRoutes bool
+
+	// CallerTTL is how long the state middleware keep for a caller, such as its rate limits,
+	// is kept after its last request. The requests of a caller are made by the same connection
+	// until then. If it is zero, DefaultCallerTTL is used.
+	CallerTTL time.Duration
+
+	// MaxBodySize is the maximum size of a published body.
+	// If it is zero, DefaultMaxBodySize is used.
+	MaxBodySize int64
+
+	// ErrorStatus returns the status code of an error, e.g. of one returned by a middleware.
+	// If it is nil or returns zero, the errors of varto are mapped to their status codes
+	// and any other error is answered with 500 Internal Server Error.
+	ErrorStatus func(err error) int
+}
+
+// TopicInfo describes a topic in the response of GET /topics.
+type TopicInfo struct {
+	Name        string `json:"name"`
+	Subscribers int    `json:"subscribers"`
+}
+
+type handler struct {
+	v       *varto.Varto
+	opts    Options
+	mux     *http.ServeMux
+	callers *callers
+}
+
+// Handler returns an http.Handler that serves the route:
+//
+//	POST   /topics/{name}             publishes the body to a topic
+//
+// and, if Options.AdminRoutes is set, the routes:
+//
+//	POST   /broadcast                 broadcasts the body to all connections
+//	GET    /topics                    lists the topics with subscribers
+//	GET    /topics/{name}/subscribers lists the ids of the subscribers of a topic
+//	DELETE /connections/{id}          removes a connection and closes it if it is an io.Closer
+//
+// Publishes are made on behalf of the caller, so they run through the same middleware
+// as the publishes of connections. Topics and their subscribers are only listed if the caller
+// may subscribe to the topics, as checked by varto.CheckSubscribe. Topic names that contain "/"
+// must be escaped in the subscribers route.
+func Handler(v *varto.Varto, opts *Options) http.Handler {
+	h := &handler{v: v, mux: http.NewServeMux()}
+	if opts != nil {
+		h.opts = *opts
+	}
+
+	if h.opts.MaxBodySize == 0 {
+		h.opts.MaxBodySize = DefaultMaxBodySize
+	}
+
+	if h.opts.CallerTTL == 0 {
+		h.opts.CallerTTL = DefaultCallerTTL
+	}
+
+	h.callers = newCallers(v, h.opts.CallerTTL)
+
+	h.mux.HandleFunc("POST /topics/{name...}", h.publish)
+	if h.opts.AdminRoutes {
+		h.mux.HandleFunc("POST /broadcast", h.admin(h.broadcast))
+		h.mux.HandleFunc("GET /topics", h.admin(h.topics))
+		h.mux.HandleFunc("GET /topics/{name}/subscribers", h.admin(h.subscribers))
+		h.mux.HandleFunc("DELETE /connections/{id}", h.admin(h.removeConnection))
+	}
+
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caller := AnonymousCaller
+	if h.opts.Authenticate != nil {
+		c, err := h.opts.Authenticate(r)
+		if err == nil && c == nil {
+			err = ErrUnauthorized
+		}
+
+		if err != nil {
+			if statusCode(err) == http.StatusInternalServerError {
+				err = ErrUnauthorized
+			}
+			h.writeError(w, err)
+			return
+		}
+
+		caller = c
+	}
+
+	caller, err := h.callers.acquire(caller)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	defer h.callers.release(caller)
+
+	h.mux.ServeHTTP(w, r.WithContext(withCaller(r.Context(), caller)))
+}
+
+// admin rejects the requests to an admin route if callers are not authenticated.
+func (h *handler) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.opts.Authenticate == nil {
+			h.writeError(w, ErrUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (h *handler) publish(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.opts.MaxBodySize))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	err = h.v.PublishMessageFromContext(r.Context(), callerOf(r.Context()), varto.Message{
+		Topic: r.PathValue("name"),
+		Data:  data,
+	})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) broadcast(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.opts.MaxBodySize))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	if err := h.v.BroadcastToAllFrom(callerOf(r.Context()), data); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) topics(w http.ResponseWriter, r *http.Request) {
+	topics := []TopicInfo{}
+	for _, name := range h.v.Topics() {
+		if h.v.CheckSubscribe(callerOf(r.Context()), name) != nil {
+			continue
+		}
+		topics = append(topics, TopicInfo{Name: name, Subscribers: len(h.v.Subscribers(name))})
+	}
+
+	writeJSON(w, http.StatusOK, topics)
+}
+
+func (h *handler) subscribers(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := h.v.CheckSubscribe(callerOf(r.Context()), name); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	subscribers := h.v.Subscribers(name)
+	if len(subscribers) == 0 {
+		h.writeError(w, varto.ErrTopicNotFound)
+		return
+	}
+
+	ids := make([]string, 0, len(subscribers))
+	for _, conn := range subscribers {
+		ids = append(ids, conn.GetId())
+	}
+
+	writeJSON(w, http.StatusOK, ids)
+}
+
+func (h *handler) removeConnection(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.v.GetConnection(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	if err := h.v.RemoveConnectionFrom(callerOf(r.Context()), conn); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	if closer, ok := conn.(io.Closer); ok {
+		closer.Close()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) writeError(w http.ResponseWriter, err error) {
+	status := 0
+	if h.opts.ErrorStatus != nil {
+		status = h.opts.ErrorStatus(err)
+	}
+
+	if status == 0 {
+		status = statusCode(err)
+	}
+
+	if value, ok := retryAfter(err); ok {
+		w.Header().Set("Retry-After", value)
+	}
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,324 @@
+package httpapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/httpapi"
+	"github.com/metinorak/varto/internal/testutil"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestHandler(t *testing.T) {
+	do := func(h http.Handler, method string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	admin := &httpapi.Options{
+		AdminRoutes: true,
+		Authenticate: httpapi.BearerAuth(func(token string) (*httpapi.Caller, error) {
+			return &httpapi.Caller{Id: token, Attributes: map[string]any{"role": token}}, nil
+		}),
+	}
+	adminAuth := http.Header{"Authorization": {"Bearer admin"}}
+
+	t.Run("TestHandler_WhenPublishingToTopic_ThenDeliverBody", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(nil)
+
+		v.Subscribe(mockConnection, "orders/created")
+		rec := do(h, http.MethodPost, "/topics/orders/created", "data", nil)
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("TestHandler_WhenTopicHasNoSubscribers_ThenReturnNotFound", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, nil)
+
+		rec := do(h, http.MethodPost, "/topics/topic", "data", nil)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.JSONEq(t, `{"error":"topic not found"}`, rec.Body.String())
+	})
+
+	t.Run("TestHandler_WhenCallerIsNotAuthenticated_ThenReturnUnauthorized", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, &httpapi.Options{
+			Authenticate: httpapi.BearerAuth(func(token string) (*httpapi.Caller, error) {
+				return &httpapi.Caller{Id: token}, nil
+			}),
+		})
+
+		rec := do(h, http.MethodGet, "/topics", "", nil)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("TestHandler_WhenMiddlewareDeniesCaller_ThenReturnForbidden", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewACL(v, varto.ACLOptions{
+			DenyByDefault: true,
+			Rules: []varto.ACLRule{
+				{Action: varto.ACLAll, Topic: "users/{user}/#"},
+			},
+		}))
+		h := httpapi.Handler(v, &httpapi.Options{
+			Authenticate: httpapi.BearerAuth(func(token string) (*httpapi.Caller, error) {
+				return &httpapi.Caller{Id: token, Attributes: map[string]any{"user": token}}, nil
+			}),
+		})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(nil)
+		v.SetAttr(mockConnection, "user", "alice")
+		v.Subscribe(mockConnection, "users/alice/inbox")
+
+		auth := http.Header{"Authorization": {"Bearer bob"}}
+		rec := do(h, http.MethodPost, "/topics/users/alice/inbox", "data", auth)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		auth = http.Header{"Authorization": {"Bearer alice"}}
+		rec = do(h, http.MethodPost, "/topics/users/alice/inbox", "data", auth)
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("TestHandler_WhenRateLimited_ThenReturnTooManyRequests", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewRateLimiter(varto.RateLimitOptions{
+			PublishPerConnection: varto.RateLimit{Rate: 0.5, Burst: 1},
+		}))
+		h := httpapi.Handler(v, nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(nil)
+		v.Subscribe(mockConnection, "topic")
+
+		do(h, http.MethodPost, "/topics/topic", "data", nil)
+		rec := do(h, http.MethodPost, "/topics/topic", "data", nil)
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("TestHandler_WhenBodyIsTooLarge_ThenReturnRequestEntityTooLarge", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, &httpapi.Options{MaxBodySize: 3})
+
+		rec := do(h, http.MethodPost, "/topics/topic", "data", nil)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("TestHandler_WhenBroadcasting_ThenWriteToAllConnections", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, admin)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(nil)
+		v.AddConnection(mockConnection)
+
+		rec := do(h, http.MethodPost, "/broadcast", "data", adminAuth)
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("TestHandler_WhenListingTopicsAndSubscribers_ThenReturnThem", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, admin)
+		mockConnection1 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection1.EXPECT().GetId().Return("id1").AnyTimes()
+		mockConnection2 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection2.EXPECT().GetId().Return("id2").AnyTimes()
+		v.Subscribe(mockConnection1, "a/b")
+		v.Subscribe(mockConnection1, "topic")
+		v.Subscribe(mockConnection2, "topic")
+
+		rec := do(h, http.MethodGet, "/topics", "", adminAuth)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[{"name":"a/b","subscribers":1},{"name":"topic","subscribers":2}]`, rec.Body.String())
+
+		rec = do(h, http.MethodGet, "/topics/a%2Fb/subscribers", "", adminAuth)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `["id1"]`, rec.Body.String())
+
+		rec = do(h, http.MethodGet, "/topics/unknown/subscribers", "", adminAuth)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("TestHandler_WhenACLDeniesSubscribe_ThenDoNotListTopic", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewACL(v, varto.ACLOptions{
+			Rules: []varto.ACLRule{{Action: varto.ACLSubscribe, Topic: "private/#", Deny: true}},
+		}))
+		h := httpapi.Handler(v, admin)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		v.Subscribe(mockConnection, "private/topic")
+		v.Subscribe(mockConnection, "topic")
+
+		rec := do(h, http.MethodGet, "/topics", "", adminAuth)
+		assert.JSONEq(t, `[{"name":"topic","subscribers":1}]`, rec.Body.String())
+
+		rec = do(h, http.MethodGet, "/topics/private%2Ftopic/subscribers", "", adminAuth)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("TestHandler_WhenRemovingConnection_ThenKickIt", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, admin)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		v.AddConnection(mockConnection)
+		v.Subscribe(mockConnection, "topic")
+
+		rec := do(h, http.MethodDelete, "/connections/id", "", adminAuth)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		var topics []httpapi.TopicInfo
+		json.Unmarshal(do(h, http.MethodGet, "/topics", "", adminAuth).Body.Bytes(), &topics)
+		assert.Empty(t, topics)
+
+		rec = do(h, http.MethodDelete, "/connections/id", "", adminAuth)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("TestHandler_WhenAdminRoutesAreNotEnabled_ThenDoNotServeThem", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		v.AddConnection(mockConnection)
+
+		assert.Equal(t, http.StatusNotFound, do(h, http.MethodDelete, "/connections/id", "", nil).Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, do(h, http.MethodGet, "/topics", "", nil).Code)
+
+		_, err := v.GetConnection("id")
+		assert.Nil(t, err)
+	})
+
+	t.Run("TestHandler_WhenAdminRoutesHaveNoAuthentication_ThenReturnUnauthorized", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, &httpapi.Options{AdminRoutes: true})
+
+		assert.Equal(t, http.StatusUnauthorized, do(h, http.MethodPost, "/broadcast", "data", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, do(h, http.MethodDelete, "/connections/id", "", nil).Code)
+	})
+
+	t.Run("TestHandler_WhenACLDeniesAdminRoute_ThenReturnForbidden", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewACL(v, varto.ACLOptions{
+			DenyByDefault: true,
+			Rules: []varto.ACLRule{
+				{Action: varto.ACLBroadcast | varto.ACLRemoveConnection, Attrs: map[string]any{"role": "admin"}},
+			},
+		}))
+		h := httpapi.Handler(v, admin)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		v.AddConnection(mockConnection)
+
+		userAuth := http.Header{"Authorization": {"Bearer user"}}
+		assert.Equal(t, http.StatusForbidden, do(h, http.MethodPost, "/broadcast", "data", userAuth).Code)
+		assert.Equal(t, http.StatusForbidden, do(h, http.MethodDelete, "/connections/id", "", userAuth).Code)
+
+		assert.Equal(t, http.StatusNoContent, do(h, http.MethodDelete, "/connections/id", "", adminAuth).Code)
+	})
+
+	t.Run("TestHandler_WhenAuthenticatedCallerIsRateLimited_ThenLimitAcrossRequests", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewRateLimiter(varto.RateLimitOptions{
+			PublishPerConnection: varto.RateLimit{Rate: 0.001, Burst: 1},
+		}))
+		h := httpapi.Handler(v, &httpapi.Options{
+			Authenticate: admin.Authenticate,
+			CallerTTL:    time.Hour,
+		})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(nil)
+		v.Subscribe(mockConnection, "topic")
+
+		auth := http.Header{"Authorization": {"Bearer alice"}}
+		assert.Equal(t, http.StatusNoContent, do(h, http.MethodPost, "/topics/topic", "data", auth).Code)
+		assert.Equal(t, http.StatusTooManyRequests, do(h, http.MethodPost, "/topics/topic", "data", auth).Code)
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	t.Run("TestHandler_WhenCallerMakesRequest_ThenAddItUntilIdle", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, &httpapi.Options{
+			Authenticate: admin.Authenticate,
+			CallerTTL:    time.Millisecond,
+		})
+
+		auth := http.Header{"Authorization": {"Bearer alice"}}
+		assert.Equal(t, http.StatusNotFound, do(h, http.MethodPost, "/topics/topic", "data", auth).Code)
+
+		testutil.WaitFor(t, func() bool {
+			_, err := v.GetConnection("alice")
+			return err == varto.ErrConnectionNotFound
+		})
+	})
+
+	t.Run("TestHandler_WhenConnectionHasCallerId_ThenDoNotRemoveIt", func(t *testing.T) {
+		v := varto.New(nil)
+		h := httpapi.Handler(v, &httpapi.Options{
+			Authenticate: admin.Authenticate,
+			CallerTTL:    time.Millisecond,
+		})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("alice").AnyTimes()
+		v.AddConnection(mockConnection)
+
+		auth := http.Header{"Authorization": {"Bearer alice"}}
+		do(h, http.MethodPost, "/topics/topic", "data", auth)
+		time.Sleep(10 * time.Millisecond)
+
+		conn, err := v.GetConnection("alice")
+		assert.Nil(t, err)
+		assert.Equal(t, mockConnection, conn)
+	})
+
+	t.Run("TestHandler_WhenCallerIsIdle_ThenReleaseItsState", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewRateLimiter(varto.RateLimitOptions{
+			PublishPerConnection: varto.RateLimit{Rate: 0.001, Burst: 1},
+		}))
+		h := httpapi.Handler(v, &httpapi.Options{
+			Authenticate: admin.Authenticate,
+			CallerTTL:    time.Millisecond,
+		})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(nil).Times(2)
+		v.Subscribe(mockConnection, "topic")
+
+		auth := http.Header{"Authorization": {"Bearer alice"}}
+		assert.Equal(t, http.StatusNoContent, do(h, http.MethodPost, "/topics/topic", "data", auth).Code)
+		testutil.WaitFor(t, func() bool {
+			return do(h, http.MethodPost, "/topics/topic", "data", auth).Code == http.StatusNoContent
+		})
+		time.Sleep(10 * time.Millisecond)
+	})
+}
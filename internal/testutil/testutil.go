@@ -0,0 +1,20 @@
+// Package testutil provides helpers shared by the tests of the transports.
+package testutil
+
+import (
+	"testing"
+	"time"
+)
+
+// WaitFor waits until cond returns true and fails the test if it doesn't within a second.
+func WaitFor(t testing.TB, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not met")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,198 @@
+package varto
+
+import "sync"
+
+// LimitsOptions configures the Limits middleware. Zero values mean no limit.
+type LimitsOptions struct {
+	// MaxConnections is the maximum number of connections.
+	MaxConnections int
+
+	// MaxSubscriptionsPerConnection is the maximum number of topics a connection can subscribe to.
+	MaxSubscriptionsPerConnection int
+
+	// MaxSubscribersPerTopic is the maximum number of subscribers of a topic.
+	MaxSubscribersPerTopic int
+
+	// MaxTopics is the maximum number of topics with subscribers.
+	MaxTopics int
+
+	// MaxPayloadBytes is the maximum size of published and broadcast messages.
+	MaxPayloadBytes int
+}
+
+// Limits is a middleware that enforces quotas on connections, subscriptions and payloads.
+// A connection or subscription is counted as soon as it is allowed, so that concurrent
+// operations can't exceed a limit together, and released by the AfterMiddleware hooks
+// if the operation fails, so that operations rejected by other middleware are not counted.
+type Limits struct {
+	BaseMiddleware
+	sync.Mutex
+	opts          LimitsOptions
+	connections   map[string]bool
+	subscriptions map[string]map[string]bool
+	topics        map[string]map[string]bool
+
+	// pendingConnections and pendingSubscriptions are counted but not confirmed by an after-hook yet.
+	pendingConnections   map[string]bool
+	pendingSubscriptions map[subscriptionKey]bool
+}
+
+type subscriptionKey struct {
+	id    string
+	topic string
+}
+
+// NewLimits returns a new Limits middleware.
+func NewLimits(opts LimitsOptions) *Limits {
+	return &Limits{
+		opts:          opts,
+		connections:   make(map[string]bool),
+		subscriptions: make(map[string]map[string]bool),
+		topics:        make(map[string]map[string]bool),
+
+		pendingConnections:   make(map[string]bool),
+		pendingSubscriptions: make(map[subscriptionKey]bool),
+	}
+}
+
+func (l *Limits) OnAddConnection(conn Connection) error {
+	l.Lock()
+	defer l.Unlock()
+
+	id := conn.GetId()
+	if l.connections[id] {
+		return nil
+	}
+
+	if l.opts.MaxConnections > 0 && len(l.connections) >= l.opts.MaxConnections {
+		return ErrTooManyConnections
+	}
+
+	l.connections[id] = true
+	l.pendingConnections[id] = true
+	return nil
+}
+
+func (l *Limits) AfterAddConnection(conn Connection, err error) {
+	l.Lock()
+	defer l.Unlock()
+
+	id := conn.GetId()
+	if !l.pendingConnections[id] {
+		return
+	}
+
+	delete(l.pendingConnections, id)
+	if err != nil {
+		delete(l.connections, id)
+	}
+}
+
+func (l *Limits) AfterRemoveConnection(conn Connection, err error) {
+	if err != nil {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	id := conn.GetId()
+	delete(l.connections, id)
+	delete(l.pendingConnections, id)
+	for topic := range l.subscriptions[id] {
+		l.removeSubscription(id, topic)
+	}
+}
+
+func (l *Limits) OnSubscribe(conn Connection, topic string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	id := conn.GetId()
+	if l.subscriptions[id][topic] {
+		return nil
+	}
+
+	if l.opts.MaxSubscriptionsPerConnection > 0 && len(l.subscriptions[id]) >= l.opts.MaxSubscriptionsPerConnection {
+		return ErrTooManySubscriptions
+	}
+
+	if l.opts.MaxSubscribersPerTopic > 0 && len(l.topics[topic]) >= l.opts.MaxSubscribersPerTopic {
+		return ErrTooManySubscribers
+	}
+
+	if _, ok := l.topics[topic]; !ok && l.opts.MaxTopics > 0 && len(l.topics) >= l.opts.MaxTopics {
+		return ErrTooManyTopics
+	}
+
+	l.addSubscription(id, topic)
+	l.pendingSubscriptions[subscriptionKey{id, topic}] = true
+	return nil
+}
+
+func (l *Limits) AfterSubscribe(conn Connection, topic string, err error) {
+	l.Lock()
+	defer l.Unlock()
+
+	key := subscriptionKey{conn.GetId(), topic}
+	if !l.pendingSubscriptions[key] {
+		return
+	}
+
+	delete(l.pendingSubscriptions, key)
+	if err != nil {
+		l.removeSubscription(key.id, topic)
+	}
+}
+
+func (l *Limits) addSubscription(id string, topic string) {
+	if _, ok := l.subscriptions[id]; !ok {
+		l.subscriptions[id] = make(map[string]bool)
+	}
+	l.subscriptions[id][topic] = true
+
+	if _, ok := l.topics[topic]; !ok {
+		l.topics[topic] = make(map[string]bool)
+	}
+	l.topics[topic][id] = true
+}
+
+func (l *Limits) AfterUnsubscribe(conn Connection, topic string, err error) {
+	if err != nil {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.removeSubscription(conn.GetId(), topic)
+}
+
+func (l *Limits) removeSubscription(id string, topic string) {
+	delete(l.pendingSubscriptions, subscriptionKey{id, topic})
+	delete(l.subscriptions[id], topic)
+	if len(l.subscriptions[id]) == 0 {
+		delete(l.subscriptions, id)
+	}
+
+	delete(l.topics[topic], id)
+	if len(l.topics[topic]) == 0 {
+		delete(l.topics, topic)
+	}
+}
+
+func (l *Limits) OnPublish(topic string, data []byte) error {
+	return l.checkPayload(data)
+}
+
+func (l *Limits) OnBroadcastToAll(data []byte) error {
+	return l.checkPayload(data)
+}
+
+func (l *Limits) checkPayload(data []byte) error {
+	if l.opts.MaxPayloadBytes > 0 && len(data) > l.opts.MaxPayloadBytes {
+		return ErrPayloadTooLarge
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package varto_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestLimits(t *testing.T) {
+	newConnection := func(t *testing.T, id string) *mock.MockConnection {
+		conn := mock.NewMockConnection(gomock.NewController(t))
+		conn.EXPECT().GetId().Return(id).AnyTimes()
+		return conn
+	}
+
+	t.Run("TestLimits_WhenMaxConnectionsIsReached_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewLimits(varto.LimitsOptions{MaxConnections: 1}))
+		mockConnection1 := newConnection(t, "id1")
+		mockConnection2 := newConnection(t, "id2")
+
+		assert.Nil(t, v.AddConnection(mockConnection1))
+		assert.Equal(t, varto.ErrTooManyConnections, v.AddConnection(mockConnection2))
+
+		v.RemoveConnection(mockConnection1)
+		assert.Nil(t, v.AddConnection(mockConnection2))
+	})
+
+	t.Run("TestLimits_WhenConnectionIsRejectedByAnotherMiddleware_ThenDoNotCountIt", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewLimits(varto.LimitsOptions{MaxConnections: 1}))
+		rejecting := v.Use(varto.OnAddConnectionFunc(func(conn varto.Connection) error {
+			return fmt.Errorf("error")
+		}))
+		mockConnection1 := newConnection(t, "id1")
+		mockConnection2 := newConnection(t, "id2")
+
+		assert.NotNil(t, v.AddConnection(mockConnection1))
+
+		rejecting.Remove()
+		assert.Nil(t, v.AddConnection(mockConnection2))
+	})
+
+	t.Run("TestLimits_WhenConnectionsAreAddedConcurrently_ThenDoNotExceedLimits", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewLimits(varto.LimitsOptions{MaxConnections: 10, MaxSubscribersPerTopic: 5}))
+		// Slow middleware after the limits widen the window between checking a limit and counting.
+		v.Use(&varto.MiddlewareFuncs{
+			AddConnection: func(conn varto.Connection) error {
+				time.Sleep(time.Millisecond)
+				return nil
+			},
+			Subscribe: func(conn varto.Connection, topic string) error {
+				time.Sleep(time.Millisecond)
+				return nil
+			},
+		})
+
+		var added, subscribed atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func(conn varto.Connection) {
+				defer wg.Done()
+
+				if v.AddConnection(conn) != nil {
+					return
+				}
+				added.Add(1)
+
+				if v.Subscribe(conn, "topic") == nil {
+					subscribed.Add(1)
+				}
+			}(newConnection(t, fmt.Sprint("id", i)))
+		}
+		wg.Wait()
+
+		stats, _ := v.Stats()
+		assert.Equal(t, int32(10), added.Load())
+		assert.Equal(t, 10, stats.Connections)
+		assert.Equal(t, int32(5), subscribed.Load())
+		assert.Len(t, v.Subscribers("topic"), 5)
+	})
+
+	t.Run("TestLimits_WhenMaxSubscriptionsPerConnectionIsReached_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewLimits(varto.LimitsOptions{MaxSubscriptionsPerConnection: 1}))
+		mockConnection := newConnection(t, "id")
+
+		assert.Nil(t, v.Subscribe(mockConnection, "topic"))
+		assert.Nil(t, v.Subscribe(mockConnection, "topic"))
+		assert.Equal(t, varto.ErrTooManySubscriptions, v.Subscribe(mockConnection, "topic2"))
+
+		v.Unsubscribe(mockConnection, "topic")
+		assert.Nil(t, v.Subscribe(mockConnection, "topic2"))
+	})
+
+	t.Run("TestLimits_WhenConnectionIsNotHashable_ThenKeyItById", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewLimits(varto.LimitsOptions{MaxConnections: 1, MaxSubscriptionsPerConnection: 1}))
+		conn := valueConnection{id: "id", tags: map[string]string{}}
+
+		assert.NotPanics(t, func() {
+			assert.Nil(t, v.AddConnection(conn))
+			assert.Nil(t, v.Subscribe(conn, "topic"))
+			assert.Equal(t, varto.ErrTooManySubscriptions, v.Subscribe(conn, "topic2"))
+			assert.Nil(t, v.RemoveConnection(conn))
+		})
+	})
+
+	t.Run("TestLimits_WhenMaxSubscribersPerTopicIsReached_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewLimits(varto.LimitsOptions{MaxSubscribersPerTopic: 1}))
+		mockConnection1 := newConnection(t, "id1")
+		mockConnection2 := newConnection(t, "id2")
+
+		assert.Nil(t, v.Subscribe(mockConnection1, "topic"))
+		assert.Equal(t, varto.ErrTooManySubscribers, v.Subscribe(mockConnection2, "topic"))
+		assert.Nil(t, v.Subscribe(mockConnection2, "topic2"))
+	})
+
+	t.Run("TestLimits_WhenMaxTopicsIsReached_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewLimits(varto.LimitsOptions{MaxTopics: 1}))
+		mockConnection1 := newConnection(t, "id1")
+		mockConnection2 := newConnection(t, "id2")
+
+		assert.Nil(t, v.Subscribe(mockConnection1, "topic"))
+		assert.Nil(t, v.Subscribe(mockConnection2, "topic"))
+		assert.Equal(t, varto.ErrTooManyTopics, v.Subscribe(mockConnection1, "topic2"))
+
+		v.AddConnection(mockConnection1)
+		v.AddConnection(mockConnection2)
+		v.RemoveConnection(mockConnection1)
+		v.RemoveConnection(mockConnection2)
+		assert.Nil(t, v.Subscribe(mockConnection1, "topic2"))
+	})
+
+	t.Run("TestLimits_WhenPayloadIsTooLarge_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewLimits(varto.LimitsOptions{MaxPayloadBytes: 4}))
+
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic", []byte("data")))
+		assert.Equal(t, varto.ErrPayloadTooLarge, v.Publish("topic", []byte("data!")))
+		assert.Equal(t, varto.ErrPayloadTooLarge, v.BroadcastToAll([]byte("data!")))
+	})
+}
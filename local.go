@@ -0,0 +1,206 @@
+package varto
+
+import (
+	"context"
+	"io"
+	"iter"
+	"sync"
+)
+
+// OverflowPolicy decides what happens to a message delivered to an in-process
+// subscriber whose buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest drops the oldest buffered message to make room for the new one.
+	OverflowDropOldest OverflowPolicy = iota
+
+	// OverflowDropNewest drops the new message and reports ErrSlowConsumer as a delivery error.
+	OverflowDropNewest
+
+	// OverflowBlock waits until there is room in the buffer.
+	// It holds up the delivery of the topic to its other subscribers meanwhile.
+	OverflowBlock
+)
+
+// DefaultSubscribeBufferSize is the buffer size of the subscriptions made with SubscribeFunc.
+const DefaultSubscribeBufferSize = 64
+
+// localIdPrefix starts the ids of in-process subscribers.
+const localIdPrefix = reservedIdPrefix + "local:"
+
+// localConnection is the connection of an in-process subscriber.
+// It buffers the delivered messages in a channel. It is trusted, so an ACL always allows it.
+type localConnection struct {
+	mu        sync.Mutex
+	id        string
+	ch        chan Message
+	policy    OverflowPolicy
+	closed    bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newLocalConnection(bufSize int, policy OverflowPolicy) *localConnection {
+	if bufSize < 0 {
+		bufSize = 0
+	}
+
+	return &localConnection{
+		id:     localIdPrefix + NewConnectionId(),
+		ch:     make(chan Message, bufSize),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+}
+
+func (c *localConnection) GetId() string {
+	return c.id
+}
+
+func (c *localConnection) Read() ([]byte, error) {
+	<-c.done
+	return nil, io.EOF
+}
+
+func (c *localConnection) Write(data []byte) error {
+	return c.WriteMessage(Message{Data: data})
+}
+
+func (c *localConnection) WriteMessage(msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrSubscriptionClosed
+	}
+
+	switch {
+	case c.policy == OverflowBlock:
+		select {
+		case c.ch <- msg:
+			return nil
+		case <-c.done:
+			return ErrSubscriptionClosed
+		}
+	case c.policy == OverflowDropNewest || cap(c.ch) == 0:
+		// An unbuffered channel has no oldest message to drop either.
+		select {
+		case c.ch <- msg:
+			return nil
+		default:
+			return ErrSlowConsumer
+		}
+	default:
+		for {
+			select {
+			case c.ch <- msg:
+				return nil
+			default:
+			}
+
+			select {
+			case <-c.ch:
+			default:
+			}
+		}
+	}
+}
+
+// close closes the channel once no message is being written to it.
+func (c *localConnection) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.closed = true
+		close(c.ch)
+	})
+}
+
+// SubscribeChan subscribes an in-process subscriber to a topic and returns the channel
+// its messages are delivered to, buffering up to bufSize messages.
+// The policy decides what happens when the buffer is full; it is OverflowDropOldest by default.
+// Calling cancel unsubscribes and closes the channel.
+func (v *Varto) SubscribeChan(topic string, bufSize int, policy ...OverflowPolicy) (<-chan Message, func(), error) {
+	conn, cancel, err := v.subscribeLocal(topic, bufSize, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conn.ch, cancel, nil
+}
+
+// SubscribeSeq is like SubscribeChan, but returns the messages as an iterator.
+// The subscription is cancelled when the iteration stops or ctx is done.
+func (v *Varto) SubscribeSeq(ctx context.Context, topic string, bufSize int, policy ...OverflowPolicy) (iter.Seq[Message], error) {
+	ch, cancel, err := v.SubscribeChan(topic, bufSize, policy...)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, cancel)
+
+	return func(yield func(Message) bool) {
+		defer cancel()
+		defer stop()
+
+		for msg := range ch {
+			if !yield(msg) {
+				return
+			}
+		}
+	}, nil
+}
+
+// SubscribeFunc calls handler with the messages of a topic, one at a time, from its own goroutine.
+// Up to DefaultSubscribeBufferSize messages are buffered for a slow handler,
+// and the policy decides what happens beyond that; it is OverflowDropOldest by default.
+// Calling cancel unsubscribes; the handler is not called anymore after that.
+func (v *Varto) SubscribeFunc(topic string, handler func(msg Message), policy ...OverflowPolicy) (func(), error) {
+	return v.subscribeFunc(topic, policy, func(conn Connection, msg Message) {
+		handler(msg)
+	})
+}
+
+// subscribeFunc is SubscribeFunc with a handler that also gets the connection of the subscriber.
+func (v *Varto) subscribeFunc(topic string, policy []OverflowPolicy, handler func(conn Connection, msg Message)) (func(), error) {
+	conn, cancel, err := v.subscribeLocal(topic, DefaultSubscribeBufferSize, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for msg := range conn.ch {
+			select {
+			case <-conn.done:
+				return
+			default:
+				handler(conn, msg)
+			}
+		}
+	}()
+
+	return cancel, nil
+}
+
+func (v *Varto) subscribeLocal(topic string, bufSize int, policy []OverflowPolicy) (*localConnection, func(), error) {
+	p := OverflowDropOldest
+	if len(policy) > 0 {
+		p = policy[0]
+	}
+
+	conn := newLocalConnection(bufSize, p)
+	if err := v.Subscribe(conn, topic); err != nil {
+		return nil, nil, err
+	}
+
+	cancel := func() {
+		v.Unsubscribe(conn, topic)
+		conn.close()
+	}
+
+	return conn, cancel, nil
+}
@@ -0,0 +1,183 @@
+package varto_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeChan(t *testing.T) {
+	t.Run("TestSubscribeChan_WhenMessageIsPublished_ThenReceiveIt", func(t *testing.T) {
+		v := varto.New(nil)
+		ch, cancel, err := v.SubscribeChan("topic", 1)
+		assert.Nil(t, err)
+		defer cancel()
+
+		v.PublishMessage(varto.Message{Topic: "topic", Data: []byte("data"), Headers: map[string]string{"key": "value"}})
+
+		select {
+		case msg := <-ch:
+			assert.Equal(t, varto.Message{Topic: "topic", Data: []byte("data"), Headers: map[string]string{"key": "value"}, Id: 1}, msg)
+		case <-time.After(time.Second):
+			t.Fatal("message is not delivered")
+		}
+	})
+
+	t.Run("TestSubscribeChan_WhenCancelled_ThenUnsubscribeAndCloseChannel", func(t *testing.T) {
+		v := varto.New(nil)
+		ch, cancel, _ := v.SubscribeChan("topic", 1)
+
+		cancel()
+
+		_, ok := <-ch
+		assert.False(t, ok)
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic", []byte("data")))
+	})
+
+	t.Run("TestSubscribeChan_WhenBufferIsFullAndDropOldest_ThenKeepNewest", func(t *testing.T) {
+		v := varto.New(nil)
+		ch, cancel, _ := v.SubscribeChan("topic", 1)
+		defer cancel()
+
+		v.Publish("topic", []byte("data1"))
+		v.Publish("topic", []byte("data2"))
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Equal(t, []byte("data2"), (<-ch).Data)
+	})
+
+	t.Run("TestSubscribeChan_WhenBufferIsFullAndDropNewest_ThenReportDeliveryError", func(t *testing.T) {
+		errs := make(chan error, 1)
+		v := varto.New(&varto.Options{
+			OnDeliveryError: func(topic string, conn varto.Connection, err error) {
+				errs <- err
+			},
+		})
+		ch, cancel, _ := v.SubscribeChan("topic", 1, varto.OverflowDropNewest)
+		defer cancel()
+
+		v.Publish("topic", []byte("data1"))
+		v.Publish("topic", []byte("data2"))
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Equal(t, []byte("data1"), (<-ch).Data)
+		assert.Equal(t, varto.ErrSlowConsumer, <-errs)
+	})
+
+	t.Run("TestSubscribeChan_WhenBufferIsFullAndBlock_ThenWaitForRoom", func(t *testing.T) {
+		v := varto.New(nil)
+		ch, cancel, _ := v.SubscribeChan("topic", 1, varto.OverflowBlock)
+		defer cancel()
+
+		for i := 0; i < 3; i++ {
+			v.Publish("topic", []byte(fmt.Sprint(i)))
+		}
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, []byte(fmt.Sprint(i)), (<-ch).Data)
+		}
+	})
+
+	t.Run("TestSubscribeChan_WhenMiddlewareRejects_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.OnSubscribeFunc(func(conn varto.Connection, topic string) error {
+			return fmt.Errorf("error")
+		}))
+
+		_, _, err := v.SubscribeChan("topic", 1)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("TestSubscribeChan_WhenACLDeniesByDefault_ThenSubscribe", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewACL(v, varto.ACLOptions{DenyByDefault: true}))
+
+		_, cancel, err := v.SubscribeChan("topic", 1)
+		assert.Nil(t, err)
+		defer cancel()
+	})
+
+	t.Run("TestSubscribeChan_WhenConnectionUsesSubscriberId_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		_, cancel, _ := v.SubscribeChan("topic", 1)
+		defer cancel()
+
+		conn := valueConnection{id: v.Subscribers("topic")[0].GetId()}
+		assert.Equal(t, varto.ErrReservedConnectionId, v.AddConnection(conn))
+		assert.Equal(t, varto.ErrReservedConnectionId, v.Subscribe(conn, "topic"))
+		assert.Len(t, v.Subscribers("topic"), 1)
+	})
+}
+
+func TestSubscribeSeq(t *testing.T) {
+	t.Run("TestSubscribeSeq_WhenLoopBreaks_ThenUnsubscribe", func(t *testing.T) {
+		v := varto.New(nil)
+		seq, err := v.SubscribeSeq(context.Background(), "topic", 2)
+		assert.Nil(t, err)
+
+		v.Publish("topic", []byte("data1"))
+		v.Publish("topic", []byte("data2"))
+
+		var received []string
+		for msg := range seq {
+			received = append(received, string(msg.Data))
+			if len(received) == 2 {
+				break
+			}
+		}
+
+		assert.Equal(t, []string{"data1", "data2"}, received)
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic", []byte("data")))
+	})
+
+	t.Run("TestSubscribeSeq_WhenContextIsDone_ThenStopIteration", func(t *testing.T) {
+		v := varto.New(nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		seq, _ := v.SubscribeSeq(ctx, "topic", 1)
+
+		time.AfterFunc(10*time.Millisecond, cancel)
+		for range seq {
+		}
+
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic", []byte("data")))
+	})
+}
+
+func TestSubscribeFunc(t *testing.T) {
+	t.Run("TestSubscribeFunc_WhenMessageIsPublished_ThenCallHandler", func(t *testing.T) {
+		v := varto.New(nil)
+		received := make(chan varto.Message, 1)
+		cancel, err := v.SubscribeFunc("topic", func(msg varto.Message) {
+			received <- msg
+		})
+		assert.Nil(t, err)
+		defer cancel()
+
+		v.Publish("topic", []byte("data"))
+
+		select {
+		case msg := <-received:
+			assert.Equal(t, []byte("data"), msg.Data)
+		case <-time.After(time.Second):
+			t.Fatal("handler is not called")
+		}
+	})
+
+	t.Run("TestSubscribeFunc_WhenCancelled_ThenStopCallingHandler", func(t *testing.T) {
+		v := varto.New(nil)
+		calls := make(chan varto.Message, 1)
+		cancel, _ := v.SubscribeFunc("topic", func(msg varto.Message) {
+			calls <- msg
+		})
+
+		cancel()
+		v.Publish("topic", []byte("data"))
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Len(t, calls, 0)
+	})
+}
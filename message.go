@@ -0,0 +1,62 @@
+package varto
+
+// Message is a message published to a topic.
+type Message struct {
+	// Topic is the topic the message is published to.
+	Topic string
+
+	// Data is the payload of the message.
+	Data []byte
+
+	// Headers are the metadata of the message. They are not part of the payload,
+	// so they are only seen by middleware and by connections that implement MessageWriter.
+	Headers map[string]string
+
+	// Id is set by Varto when it delivers the message to its topic. Ids increase in the order
+	// messages are published, so a connection that receives a message twice, such as through
+	// a topic and a pattern, can tell. It is zero for messages that topics deliver on their own.
+	Id uint64
+}
+
+// MessageWriter is an optional interface for connections that want to receive
+// whole messages, including their topic and headers, instead of only their data.
+type MessageWriter interface {
+	WriteMessage(msg Message) error
+}
+
+// MessagePublisher is an optional interface for topics that can deliver whole messages.
+// Topics that don't implement it only deliver the data of messages.
+type MessagePublisher interface {
+	PublishMessage(msg Message)
+}
+
+// PublishTransformer is an optional interface for middleware that rewrite published messages.
+// The transformers of the chain run in order before any OnPublishFrom or OnPublish hook,
+// so those hooks check the message as it is delivered.
+type PublishTransformer interface {
+	// TransformPublish can change the data, the headers or the topic of the message.
+	TransformPublish(msg *Message) error
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+
+	c := make(map[string]string, len(headers))
+	for k, v := range headers {
+		c[k] = v
+	}
+
+	return c
+}
+
+// writeMessage writes a message to a connection,
+// using WriteMessage if the connection implements MessageWriter.
+func writeMessage(conn Connection, msg Message) error {
+	if w, ok := conn.(MessageWriter); ok {
+		return w.WriteMessage(msg)
+	}
+
+	return conn.Write(msg.Data)
+}
@@ -0,0 +1,160 @@
+package varto_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+type messageConnection struct {
+	*mock.MockConnection
+	messages chan varto.Message
+}
+
+func (c *messageConnection) WriteMessage(msg varto.Message) error {
+	c.messages <- msg
+	return nil
+}
+
+func TestTransformPublish(t *testing.T) {
+	t.Run("TestTransformPublish_WhenDataIsRewritten_ThenDeliverRewrittenData", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("hello ***")).Return(nil)
+
+		v.Use(varto.TransformPublishFunc(func(msg *varto.Message) error {
+			msg.Data = bytes.ReplaceAll(msg.Data, []byte("secret"), []byte("***"))
+			return nil
+		}))
+
+		v.Subscribe(mockConnection, "topic")
+		err := v.Publish("topic", []byte("hello secret"))
+
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(t, err)
+	})
+
+	t.Run("TestTransformPublish_WhenChained_ThenApplyInOrderBeforeHooks", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data-1-2")).Return(nil)
+
+		var seen []string
+		v.Use(varto.TransformPublishFunc(func(msg *varto.Message) error {
+			msg.Data = append(msg.Data, []byte("-1")...)
+			return nil
+		}))
+		v.Use(varto.OnPublishFunc(func(topic string, data []byte) error {
+			seen = append(seen, string(data))
+			return nil
+		}))
+		v.Use(varto.TransformPublishFunc(func(msg *varto.Message) error {
+			msg.Data = append(msg.Data, []byte("-2")...)
+			return nil
+		}))
+
+		v.Subscribe(mockConnection, "topic")
+		v.Publish("topic", []byte("data"))
+
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, []string{"data-1-2"}, seen)
+	})
+
+	t.Run("TestTransformPublish_WhenLaterTransformerRetargets_ThenCheckFinalTopic", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Use(varto.NewACL(v, varto.ACLOptions{Rules: []varto.ACLRule{{Action: varto.ACLPublish, Topic: "private/#", Deny: true}}}))
+		v.Use(varto.TransformPublishFunc(func(msg *varto.Message) error {
+			msg.Topic = "private/" + msg.Topic
+			return nil
+		}))
+
+		err := v.PublishFrom(mockConnection, "topic", []byte("data"))
+		assert.Equal(t, varto.ErrAccessDenied, err)
+	})
+
+	t.Run("TestTransformPublish_WhenTopicIsRewritten_ThenPublishToNewTopic", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := &messageConnection{
+			MockConnection: mock.NewMockConnection(gomock.NewController(t)),
+			messages:       make(chan varto.Message, 1),
+		}
+		conn.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Use(varto.TransformPublishFunc(func(msg *varto.Message) error {
+			msg.Topic = "v2/" + msg.Topic
+			msg.Headers = map[string]string{"rewritten": "true"}
+			return nil
+		}))
+
+		v.Subscribe(conn, "v2/topic")
+		err := v.Publish("topic", []byte("data"))
+		assert.Nil(t, err)
+
+		select {
+		case msg := <-conn.messages:
+			assert.Equal(t, varto.Message{Topic: "v2/topic", Data: []byte("data"), Headers: map[string]string{"rewritten": "true"}, Id: 1}, msg)
+		case <-time.After(time.Second):
+			t.Fatal("message is not delivered")
+		}
+	})
+
+	t.Run("TestTransformPublish_WhenTransformReturnsError_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+
+		v.Use(varto.TransformPublishFunc(func(msg *varto.Message) error {
+			return fmt.Errorf("error")
+		}))
+
+		assert.NotNil(t, v.Publish("topic", []byte("data")))
+	})
+
+	t.Run("TestTransformPublish_WhenTopicIsCleared_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+
+		v.Use(varto.TransformPublishFunc(func(msg *varto.Message) error {
+			msg.Topic = ""
+			return nil
+		}))
+
+		assert.Equal(t, varto.ErrInvalidTopicName, v.Publish("topic", []byte("data")))
+	})
+}
+
+func TestPublishMessage(t *testing.T) {
+	t.Run("TestPublishMessage_WhenConnectionIsMessageWriter_ThenDeliverHeaders", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := &messageConnection{
+			MockConnection: mock.NewMockConnection(gomock.NewController(t)),
+			messages:       make(chan varto.Message, 1),
+		}
+		conn.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Subscribe(conn, "topic")
+		err := v.PublishMessage(varto.Message{Topic: "topic", Data: []byte("data"), Headers: map[string]string{"key": "value"}})
+		assert.Nil(t, err)
+
+		select {
+		case msg := <-conn.messages:
+			assert.Equal(t, map[string]string{"key": "value"}, msg.Headers)
+		case <-time.After(time.Second):
+			t.Fatal("message is not delivered")
+		}
+	})
+
+	t.Run("TestPublishMessage_WhenTopicNameIsEmpty_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		err := v.PublishMessage(varto.Message{Data: []byte("data")})
+		assert.Equal(t, varto.ErrInvalidTopicName, err)
+	})
+}
@@ -0,0 +1,230 @@
+package varto
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MetricsDurationBuckets are the upper bounds, in seconds, of the duration histograms.
+var MetricsDurationBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Metrics is a middleware that collects metrics about a Varto instance
+// and serves them over HTTP in the Prometheus text exposition format.
+type Metrics struct {
+	BaseMiddleware
+	sync.Mutex
+	varto *Varto
+
+	subscribes       map[string]uint64
+	publishes        map[string]uint64
+	publishedBytes   uint64
+	broadcasts       map[string]uint64
+	broadcastBytes   uint64
+	deliveries       uint64
+	deliveryFailures uint64
+	queueDepths      map[string]int
+	queueTime        *histogram
+	fanoutTime       *histogram
+}
+
+// NewMetrics returns a new Metrics middleware for v. It has to be added to v with Use.
+func NewMetrics(v *Varto) *Metrics {
+	return &Metrics{
+		varto:       v,
+		subscribes:  make(map[string]uint64),
+		publishes:   make(map[string]uint64),
+		broadcasts:  make(map[string]uint64),
+		queueDepths: make(map[string]int),
+		queueTime:   newHistogram(MetricsDurationBuckets),
+		fanoutTime:  newHistogram(MetricsDurationBuckets),
+	}
+}
+
+func (m *Metrics) AfterSubscribe(conn Connection, topic string, err error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.subscribes[metricsResult(err)]++
+}
+
+func (m *Metrics) AfterPublish(report PublishReport) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.publishes[metricsResult(report.Err)]++
+	if report.Err == nil {
+		m.publishedBytes += uint64(len(report.Data))
+	}
+}
+
+func (m *Metrics) AfterBroadcastToAll(report PublishReport) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.broadcasts[metricsResult(report.Err)]++
+	if report.Err == nil {
+		m.broadcastBytes += uint64(len(report.Data))
+	}
+}
+
+func (m *Metrics) OnDelivered(report DeliveryReport) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.deliveries += uint64(report.Recipients)
+	m.deliveryFailures += uint64(report.Failures)
+
+	if report.QueueDepth > 0 {
+		m.queueDepths[report.Topic] = report.QueueDepth
+	} else {
+		delete(m.queueDepths, report.Topic)
+	}
+
+	m.queueTime.Observe(report.QueueTime)
+	m.fanoutTime.Observe(report.Duration)
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if err := m.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Write writes the metrics to w in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	stats, err := m.varto.Stats()
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	queueDepth := 0
+	for _, depth := range m.queueDepths {
+		queueDepth += depth
+	}
+
+	bw := bufio.NewWriter(w)
+	p := metricsPrinter{w: bw}
+
+	p.header("varto_connections", "gauge", "Number of connections.")
+	p.value("varto_connections", "", float64(stats.Connections))
+	p.header("varto_topics", "gauge", "Number of topics with subscribers.")
+	p.value("varto_topics", "", float64(stats.Topics))
+	p.header("varto_subscriptions", "gauge", "Number of subscriptions.")
+	p.value("varto_subscriptions", "", float64(stats.Subscriptions))
+	p.header("varto_subscribes_total", "counter", "Number of subscribe operations.")
+	p.results("varto_subscribes_total", m.subscribes)
+	p.header("varto_publishes_total", "counter", "Number of publish operations.")
+	p.results("varto_publishes_total", m.publishes)
+	p.header("varto_published_bytes_total", "counter", "Number of bytes published.")
+	p.value("varto_published_bytes_total", "", float64(m.publishedBytes))
+	p.header("varto_broadcasts_total", "counter", "Number of broadcast operations.")
+	p.results("varto_broadcasts_total", m.broadcasts)
+	p.header("varto_broadcast_bytes_total", "counter", "Number of bytes broadcast.")
+	p.value("varto_broadcast_bytes_total", "", float64(m.broadcastBytes))
+	p.header("varto_deliveries_total", "counter", "Number of messages written to topic subscribers.")
+	p.value("varto_deliveries_total", "", float64(m.deliveries))
+	p.header("varto_delivery_failures_total", "counter", "Number of messages that couldn't be written to topic subscribers.")
+	p.value("varto_delivery_failures_total", "", float64(m.deliveryFailures))
+	p.header("varto_queue_depth", "gauge", "Number of messages waiting in topic queues.")
+	p.value("varto_queue_depth", "", float64(queueDepth))
+	p.header("varto_queue_duration_seconds", "histogram", "Time messages wait in topic queues.")
+	p.histogram("varto_queue_duration_seconds", m.queueTime)
+	p.header("varto_fanout_duration_seconds", "histogram", "Time it takes to write a message to all the subscribers of a topic.")
+	p.histogram("varto_fanout_duration_seconds", m.fanoutTime)
+
+	if p.err != nil {
+		return p.err
+	}
+
+	return bw.Flush()
+}
+
+func metricsResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "ok"
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+
+	h.sum += seconds
+	h.count++
+}
+
+// metricsPrinter writes metrics and keeps the first write error.
+type metricsPrinter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *metricsPrinter) printf(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+func (p *metricsPrinter) header(name string, kind string, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (p *metricsPrinter) value(name string, labels string, value float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+
+	p.printf("%s%s %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (p *metricsPrinter) results(name string, counts map[string]uint64) {
+	for _, result := range []string{"ok", "error"} {
+		p.value(name, `result="`+result+`"`, float64(counts[result]))
+	}
+}
+
+func (p *metricsPrinter) histogram(name string, h *histogram) {
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		p.value(name+"_bucket", `le="`+strconv.FormatFloat(bound, 'g', -1, 64)+`"`, float64(cumulative))
+	}
+
+	p.value(name+"_bucket", `le="+Inf"`, float64(h.count))
+	p.value(name+"_sum", "", h.sum)
+	p.value(name+"_count", "", float64(h.count))
+}
@@ -0,0 +1,76 @@
+package varto_test
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMetrics(t *testing.T) {
+	scrape := func(t *testing.T, m *varto.Metrics) string {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+		assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+		body, _ := io.ReadAll(rec.Body)
+		return string(body)
+	}
+
+	t.Run("TestMetrics_WhenScraped_ThenExposeGauges", func(t *testing.T) {
+		v := varto.New(nil)
+		metrics := varto.NewMetrics(v)
+		v.Use(metrics)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.AddConnection(mockConnection)
+		v.Subscribe(mockConnection, "topic")
+		v.Subscribe(mockConnection, "topic2")
+
+		body := scrape(t, metrics)
+		assert.Contains(t, body, "# TYPE varto_connections gauge\nvarto_connections 1\n")
+		assert.Contains(t, body, "varto_topics 2\n")
+		assert.Contains(t, body, "varto_subscriptions 2\n")
+		assert.Contains(t, body, "varto_subscribes_total{result=\"ok\"} 2\n")
+	})
+
+	t.Run("TestMetrics_WhenMessagesAreDelivered_ThenCountDeliveriesAndFailures", func(t *testing.T) {
+		v := varto.New(nil)
+		metrics := varto.NewMetrics(v)
+		v.Use(metrics)
+		v.Use(varto.OnPublishFunc(func(topic string, data []byte) error {
+			if topic == "rejected" {
+				return fmt.Errorf("error")
+			}
+			return nil
+		}))
+		mockConnection1 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection1.EXPECT().GetId().Return("id1").AnyTimes()
+		mockConnection1.EXPECT().Write([]byte("data")).Return(nil)
+		mockConnection2 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection2.EXPECT().GetId().Return("id2").AnyTimes()
+		mockConnection2.EXPECT().Write([]byte("data")).Return(fmt.Errorf("error"))
+
+		v.Subscribe(mockConnection1, "topic")
+		v.Subscribe(mockConnection2, "topic")
+		v.Publish("topic", []byte("data"))
+		v.Publish("rejected", []byte("data"))
+		time.Sleep(10 * time.Millisecond)
+
+		body := scrape(t, metrics)
+		assert.Contains(t, body, "varto_publishes_total{result=\"ok\"} 1\nvarto_publishes_total{result=\"error\"} 1\n")
+		assert.Contains(t, body, "varto_published_bytes_total 4\n")
+		assert.Contains(t, body, "varto_deliveries_total 1\n")
+		assert.Contains(t, body, "varto_delivery_failures_total 1\n")
+		assert.Contains(t, body, "varto_fanout_duration_seconds_bucket{le=\"+Inf\"} 1\n")
+		assert.Contains(t, body, "varto_fanout_duration_seconds_count 1\n")
+	})
+}
@@ -1,6 +1,9 @@
 package varto
 
-import "sync"
+import (
+	"sort"
+	"sync"
+)
 
 type Middleware interface {
 	// OnAddConnection is called when a new connection is added.
@@ -22,29 +25,239 @@ type Middleware interface {
 	OnBroadcastToAll(data []byte) error
 }
 
+// PublishFromMiddleware is an optional interface for middleware that need to know
+// which connection a message is published from. It is called by PublishFrom
+// and PublishMessageFrom before the OnPublish hook of the same middleware.
+type PublishFromMiddleware interface {
+	// OnPublishFrom is called when a connection publishes a message to a topic.
+	OnPublishFrom(conn Connection, topic string, data []byte) error
+}
+
+// BroadcastFromMiddleware is an optional interface for middleware that need to know
+// which connection a broadcast is sent from. It is called by BroadcastToAllFrom
+// before the OnBroadcastToAll hook of the same middleware.
+type BroadcastFromMiddleware interface {
+	// OnBroadcastFrom is called when a connection broadcasts a message to everyone.
+	OnBroadcastFrom(conn Connection, data []byte) error
+}
+
+// SubscribeCheckMiddleware is an optional interface for middleware that can check
+// a subscription without side effects. It is called by CheckSubscribe.
+type SubscribeCheckMiddleware interface {
+	// CheckSubscribe reports whether a connection may subscribe to a topic.
+	CheckSubscribe(conn Connection, topic string) error
+}
+
+// RemoveConnectionFromMiddleware is an optional interface for middleware that need to know
+// which connection removes another one. It is called by RemoveConnectionFrom
+// before the OnRemoveConnection hook of the same middleware.
+type RemoveConnectionFromMiddleware interface {
+	// OnRemoveConnectionFrom is called when a connection removes another connection.
+	OnRemoveConnectionFrom(from Connection, conn Connection) error
+}
+
+// AfterMiddleware is an optional interface for middleware that need to know
+// what an operation actually did. Its hooks are called once the operation is done,
+// including when it failed or was rejected by a middleware, with the resulting error.
+type AfterMiddleware interface {
+	// AfterAddConnection is called after a connection is added.
+	AfterAddConnection(conn Connection, err error)
+
+	// AfterRemoveConnection is called after a connection is removed.
+	AfterRemoveConnection(conn Connection, err error)
+
+	// AfterSubscribe is called after a connection subscribes to a topic.
+	AfterSubscribe(conn Connection, topic string, err error)
+
+	// AfterUnsubscribe is called after a connection unsubscribes from a topic.
+	AfterUnsubscribe(conn Connection, topic string, err error)
+
+	// AfterPublish is called after a message is published to a topic.
+	AfterPublish(report PublishReport)
+
+	// AfterBroadcastToAll is called after a message is broadcast to everyone.
+	AfterBroadcastToAll(report PublishReport)
+}
+
+// DeliveryErrorMiddleware is an optional interface for middleware that need to know
+// when a message can't be written to a subscriber of a topic.
+type DeliveryErrorMiddleware interface {
+	// OnDeliveryError is called when writing a message to a subscriber fails.
+	OnDeliveryError(topic string, conn Connection, err error)
+}
+
+// DeliveryMiddleware is an optional interface for middleware that need to know
+// when a message has been delivered to the subscribers of a topic.
+type DeliveryMiddleware interface {
+	// OnDelivered is called after a message is written to all the subscribers of a topic.
+	OnDelivered(report DeliveryReport)
+}
+
+// PublishReport describes the outcome of a publish or a broadcast.
+type PublishReport struct {
+	// Topic is the topic the message was published to, after any PublishTransformer
+	// rewrote it. It is empty for broadcasts.
+	Topic string
+
+	// Data is the published message.
+	Data []byte
+
+	// Headers are the headers of the published message.
+	Headers map[string]string
+
+	// Id is the id of the published message. It is zero if the message was not delivered.
+	Id uint64
+
+	// Connection is the connection the message was published from with PublishFrom.
+	// It is nil otherwise.
+	Connection Connection
+
+	// Recipients is the number of connections the message was sent to.
+	// Messages are delivered to topic subscribers asynchronously, so for publishes
+	// it is the number of subscribers at the time of publishing.
+	Recipients int
+
+	// Err is the error the operation returned.
+	Err error
+}
+
+// MiddlewareOptions configures how a middleware is added to the chain.
+type MiddlewareOptions struct {
+	// Priority orders the middleware chain. Middleware with a higher priority run first,
+	// and middleware with the same priority run in the order they were added.
+	Priority int
+
+	// Topic is a topic pattern that limits the middleware to the matching topics.
+	// "+" matches exactly one level and "#" matches any number of remaining levels.
+	// A middleware with a topic pattern runs for the subscribe, unsubscribe and publish
+	// operations of the matching topics, and for every operation without a topic,
+	// such as AddConnection, RemoveConnection and BroadcastToAll, so that it can
+	// release its state of removed connections. If it is empty, the middleware runs for everything.
+	Topic string
+}
+
+// MiddlewareHandle refers to a middleware added to the chain.
+type MiddlewareHandle struct {
+	context *middlewareContext
+	id      uint64
+}
+
+// Remove removes the middleware from the chain. It is safe to call more than once.
+func (h *MiddlewareHandle) Remove() {
+	if h == nil {
+		return
+	}
+
+	h.context.Remove(h.id)
+}
+
+type middlewareEntry struct {
+	id         uint64
+	middleware Middleware
+	opts       MiddlewareOptions
+}
+
+// middlewareContext holds the middleware chain. The chain is copied on every change,
+// so the slices handed out by its getters are never modified afterwards.
 type middlewareContext struct {
 	sync.RWMutex
-	items []Middleware
+	nextId uint64
+	items  []middlewareEntry
 }
 
 func newMiddlewareContext() *middlewareContext {
 	return &middlewareContext{}
 }
 
-func (c *middlewareContext) Add(middleware Middleware) {
+func (c *middlewareContext) Add(middleware Middleware, opts MiddlewareOptions) *MiddlewareHandle {
 	if middleware == nil {
-		return
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.nextId++
+	entry := middlewareEntry{
+		id:         c.nextId,
+		middleware: middleware,
+		opts:       opts,
 	}
 
+	items := make([]middlewareEntry, 0, len(c.items)+1)
+	items = append(items, c.items...)
+	items = append(items, entry)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].opts.Priority > items[j].opts.Priority
+	})
+	c.items = items
+
+	return &MiddlewareHandle{context: c, id: entry.id}
+}
+
+func (c *middlewareContext) Remove(id uint64) {
 	c.Lock()
 	defer c.Unlock()
 
-	c.items = append(c.items, middleware)
+	items := make([]middlewareEntry, 0, len(c.items))
+	for _, item := range c.items {
+		if item.id != id {
+			items = append(items, item)
+		}
+	}
+	c.items = items
 }
 
+// GetAll returns every middleware in the chain, including the ones limited to topics.
 func (c *middlewareContext) GetAll() []Middleware {
+	return c.filter(func(item middlewareEntry) bool {
+		return true
+	})
+}
+
+// GetForTopic returns the middleware that run for a topic.
+func (c *middlewareContext) GetForTopic(topic string) []Middleware {
+	return c.filter(func(item middlewareEntry) bool {
+		return item.opts.Topic == "" || matchTopic(item.opts.Topic, topic)
+	})
+}
+
+// getEntriesForTopic returns the entries of the middleware that run for a topic.
+func (c *middlewareContext) getEntriesForTopic(topic string) []middlewareEntry {
+	c.RLock()
+	items := c.items
+	c.RUnlock()
+
+	entries := make([]middlewareEntry, 0, len(items))
+	for _, item := range items {
+		if item.opts.Topic == "" || matchTopic(item.opts.Topic, topic) {
+			entries = append(entries, item)
+		}
+	}
+
+	return entries
+}
+
+func middlewaresOf(entries []middlewareEntry) []Middleware {
+	middlewares := make([]Middleware, len(entries))
+	for i, entry := range entries {
+		middlewares[i] = entry.middleware
+	}
+
+	return middlewares
+}
+
+func (c *middlewareContext) filter(include func(item middlewareEntry) bool) []Middleware {
 	c.RLock()
-	defer c.RUnlock()
+	items := c.items
+	c.RUnlock()
+
+	middlewares := make([]Middleware, 0, len(items))
+	for _, item := range items {
+		if include(item) {
+			middlewares = append(middlewares, item.middleware)
+		}
+	}
 
-	return c.items
+	return middlewares
 }
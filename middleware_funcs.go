@@ -0,0 +1,158 @@
+package varto
+
+// BaseMiddleware implements every Middleware and AfterMiddleware hook as a no-op.
+// Embed it to implement only the hooks you need.
+type BaseMiddleware struct{}
+
+func (BaseMiddleware) OnAddConnection(conn Connection) error {
+	return nil
+}
+
+func (BaseMiddleware) OnRemoveConnection(conn Connection) error {
+	return nil
+}
+
+func (BaseMiddleware) OnSubscribe(conn Connection, topic string) error {
+	return nil
+}
+
+func (BaseMiddleware) OnUnsubscribe(conn Connection, topic string) error {
+	return nil
+}
+
+func (BaseMiddleware) OnPublish(topic string, data []byte) error {
+	return nil
+}
+
+func (BaseMiddleware) OnBroadcastToAll(data []byte) error {
+	return nil
+}
+
+func (BaseMiddleware) AfterAddConnection(conn Connection, err error) {}
+
+func (BaseMiddleware) AfterRemoveConnection(conn Connection, err error) {}
+
+func (BaseMiddleware) AfterSubscribe(conn Connection, topic string, err error) {}
+
+func (BaseMiddleware) AfterUnsubscribe(conn Connection, topic string, err error) {}
+
+func (BaseMiddleware) AfterPublish(report PublishReport) {}
+
+func (BaseMiddleware) AfterBroadcastToAll(report PublishReport) {}
+
+// MiddlewareFuncs is a Middleware built from functions.
+// Hooks whose function is nil do nothing.
+type MiddlewareFuncs struct {
+	AddConnection    func(conn Connection) error
+	RemoveConnection func(conn Connection) error
+	Subscribe        func(conn Connection, topic string) error
+	Unsubscribe      func(conn Connection, topic string) error
+	Publish          func(topic string, data []byte) error
+	PublishFrom      func(conn Connection, topic string, data []byte) error
+	BroadcastToAll   func(data []byte) error
+	Transform        func(msg *Message) error
+}
+
+func (m *MiddlewareFuncs) OnAddConnection(conn Connection) error {
+	if m.AddConnection == nil {
+		return nil
+	}
+
+	return m.AddConnection(conn)
+}
+
+func (m *MiddlewareFuncs) OnRemoveConnection(conn Connection) error {
+	if m.RemoveConnection == nil {
+		return nil
+	}
+
+	return m.RemoveConnection(conn)
+}
+
+func (m *MiddlewareFuncs) OnSubscribe(conn Connection, topic string) error {
+	if m.Subscribe == nil {
+		return nil
+	}
+
+	return m.Subscribe(conn, topic)
+}
+
+func (m *MiddlewareFuncs) OnUnsubscribe(conn Connection, topic string) error {
+	if m.Unsubscribe == nil {
+		return nil
+	}
+
+	return m.Unsubscribe(conn, topic)
+}
+
+func (m *MiddlewareFuncs) OnPublish(topic string, data []byte) error {
+	if m.Publish == nil {
+		return nil
+	}
+
+	return m.Publish(topic, data)
+}
+
+func (m *MiddlewareFuncs) OnPublishFrom(conn Connection, topic string, data []byte) error {
+	if m.PublishFrom == nil {
+		return nil
+	}
+
+	return m.PublishFrom(conn, topic, data)
+}
+
+func (m *MiddlewareFuncs) OnBroadcastToAll(data []byte) error {
+	if m.BroadcastToAll == nil {
+		return nil
+	}
+
+	return m.BroadcastToAll(data)
+}
+
+func (m *MiddlewareFuncs) TransformPublish(msg *Message) error {
+	if m.Transform == nil {
+		return nil
+	}
+
+	return m.Transform(msg)
+}
+
+// OnAddConnectionFunc returns a Middleware that only implements OnAddConnection.
+func OnAddConnectionFunc(f func(conn Connection) error) Middleware {
+	return &MiddlewareFuncs{AddConnection: f}
+}
+
+// OnRemoveConnectionFunc returns a Middleware that only implements OnRemoveConnection.
+func OnRemoveConnectionFunc(f func(conn Connection) error) Middleware {
+	return &MiddlewareFuncs{RemoveConnection: f}
+}
+
+// OnSubscribeFunc returns a Middleware that only implements OnSubscribe.
+func OnSubscribeFunc(f func(conn Connection, topic string) error) Middleware {
+	return &MiddlewareFuncs{Subscribe: f}
+}
+
+// OnUnsubscribeFunc returns a Middleware that only implements OnUnsubscribe.
+func OnUnsubscribeFunc(f func(conn Connection, topic string) error) Middleware {
+	return &MiddlewareFuncs{Unsubscribe: f}
+}
+
+// OnPublishFunc returns a Middleware that only implements OnPublish.
+func OnPublishFunc(f func(topic string, data []byte) error) Middleware {
+	return &MiddlewareFuncs{Publish: f}
+}
+
+// OnPublishFromFunc returns a Middleware that only implements OnPublishFrom.
+func OnPublishFromFunc(f func(conn Connection, topic string, data []byte) error) Middleware {
+	return &MiddlewareFuncs{PublishFrom: f}
+}
+
+// OnBroadcastToAllFunc returns a Middleware that only implements OnBroadcastToAll.
+func OnBroadcastToAllFunc(f func(data []byte) error) Middleware {
+	return &MiddlewareFuncs{BroadcastToAll: f}
+}
+
+// TransformPublishFunc returns a Middleware that only implements TransformPublish.
+func TransformPublishFunc(f func(msg *Message) error) Middleware {
+	return &MiddlewareFuncs{Transform: f}
+}
@@ -0,0 +1,86 @@
+package varto_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+type subscribeCounter struct {
+	varto.BaseMiddleware
+	count int
+}
+
+func (m *subscribeCounter) OnSubscribe(conn varto.Connection, topic string) error {
+	m.count++
+	return nil
+}
+
+func TestMiddlewareFuncs(t *testing.T) {
+	t.Run("TestMiddlewareFuncs_WhenFuncIsSet_ThenCallIt", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+
+		v.Use(&varto.MiddlewareFuncs{
+			Subscribe: func(conn varto.Connection, topic string) error {
+				return fmt.Errorf("error")
+			},
+		})
+
+		assert.NotNil(t, v.Subscribe(mockConnection, "topic"))
+	})
+
+	t.Run("TestMiddlewareFuncs_WhenFuncIsNotSet_ThenDoNothing", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Use(&varto.MiddlewareFuncs{})
+
+		assert.Nil(t, v.AddConnection(mockConnection))
+		assert.Nil(t, v.Subscribe(mockConnection, "topic"))
+		assert.Nil(t, v.PublishFrom(mockConnection, "topic", []byte("data")))
+		assert.Nil(t, v.Unsubscribe(mockConnection, "topic"))
+		assert.Nil(t, v.RemoveConnection(mockConnection))
+		assert.Nil(t, v.BroadcastToAll([]byte("data")))
+	})
+
+	t.Run("TestOnPublishFunc_WhenFuncReturnsError_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+
+		v.Use(varto.OnPublishFunc(func(topic string, data []byte) error {
+			return fmt.Errorf("error")
+		}))
+
+		assert.NotNil(t, v.Publish("topic", []byte("data")))
+	})
+
+	t.Run("TestOnBroadcastToAllFunc_WhenFuncReturnsError_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+
+		v.Use(varto.OnBroadcastToAllFunc(func(data []byte) error {
+			return fmt.Errorf("error")
+		}))
+
+		assert.NotNil(t, v.BroadcastToAll([]byte("data")))
+	})
+
+	t.Run("TestBaseMiddleware_WhenEmbedded_ThenOnlyOverriddenHooksRun", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		counter := &subscribeCounter{}
+		v.Use(counter)
+
+		v.AddConnection(mockConnection)
+		v.Subscribe(mockConnection, "topic")
+		v.Unsubscribe(mockConnection, "topic")
+
+		assert.Equal(t, 1, counter.count)
+	})
+}
@@ -0,0 +1,136 @@
+package varto_test
+
+import (
+	"testing"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestUse(t *testing.T) {
+	recordSubscribe := func(calls *[]string, name string) varto.Middleware {
+		return varto.OnSubscribeFunc(func(conn varto.Connection, topic string) error {
+			*calls = append(*calls, name)
+			return nil
+		})
+	}
+
+	t.Run("TestUse_WhenHandleIsRemoved_ThenMiddlewareIsNotCalled", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		var calls []string
+		handle := v.Use(recordSubscribe(&calls, "first"))
+		v.Subscribe(mockConnection, "topic")
+
+		handle.Remove()
+		handle.Remove()
+		v.Subscribe(mockConnection, "topic")
+
+		assert.Equal(t, []string{"first"}, calls)
+	})
+
+	t.Run("TestUse_WhenMiddlewareIsNil_ThenReturnNilHandle", func(t *testing.T) {
+		v := varto.New(nil)
+
+		handle := v.Use(nil)
+		assert.Nil(t, handle)
+		handle.Remove()
+	})
+
+	t.Run("TestUseWithOptions_WhenPrioritiesAreSet_ThenRunInPriorityOrder", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		var calls []string
+		v.Use(recordSubscribe(&calls, "default"))
+		v.UseWithOptions(recordSubscribe(&calls, "low"), varto.MiddlewareOptions{Priority: -1})
+		v.UseWithOptions(recordSubscribe(&calls, "high"), varto.MiddlewareOptions{Priority: 10})
+		v.Use(recordSubscribe(&calls, "default2"))
+
+		v.Subscribe(mockConnection, "topic")
+
+		assert.Equal(t, []string{"high", "default", "default2", "low"}, calls)
+	})
+
+	t.Run("TestUseFor_WhenTopicMatches_ThenRunMiddleware", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		var calls []string
+		v.UseFor("chat/+", recordSubscribe(&calls, "chat"))
+
+		v.Subscribe(mockConnection, "chat/general")
+		v.Subscribe(mockConnection, "news/today")
+
+		assert.Equal(t, []string{"chat"}, calls)
+	})
+
+	t.Run("TestUseFor_WhenOperationHasNoTopic_ThenRunMiddleware", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		mockConnection.EXPECT().Write(gomock.Any()).Return(nil)
+
+		var calls []string
+		v.UseFor("chat/#", &varto.MiddlewareFuncs{
+			AddConnection: func(conn varto.Connection) error {
+				calls = append(calls, "add")
+				return nil
+			},
+			RemoveConnection: func(conn varto.Connection) error {
+				calls = append(calls, "remove")
+				return nil
+			},
+			BroadcastToAll: func(data []byte) error {
+				calls = append(calls, "broadcast")
+				return nil
+			},
+		})
+
+		v.AddConnection(mockConnection)
+		v.BroadcastToAll(nil)
+		v.RemoveConnection(mockConnection)
+
+		assert.Equal(t, []string{"add", "broadcast", "remove"}, calls)
+	})
+
+	t.Run("TestUseFor_WhenTransformerRewritesTopic_ThenRunChainOfNewTopic", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.UseFor("private/#", varto.NewACL(v, varto.ACLOptions{DenyByDefault: true}))
+		v.Use(varto.TransformPublishFunc(func(msg *varto.Message) error {
+			msg.Topic = "private/" + msg.Topic
+			return nil
+		}))
+
+		err := v.PublishFrom(mockConnection, "topic", []byte("data"))
+		assert.Equal(t, varto.ErrAccessDenied, err)
+	})
+
+	t.Run("TestUseFor_WhenTransformersRewriteTopicBackAndForth_ThenRunEachOnce", func(t *testing.T) {
+		v := varto.New(nil)
+		calls := 0
+		v.Use(varto.TransformPublishFunc(func(msg *varto.Message) error {
+			calls++
+			if msg.Topic == "a" {
+				msg.Topic = "b"
+			} else {
+				msg.Topic = "a"
+			}
+			return nil
+		}))
+
+		v.Publish("a", []byte("data"))
+
+		assert.Equal(t, 1, calls)
+	})
+}
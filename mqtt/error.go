@@ -0,0 +1,12 @@
+package mqtt
+
+import "errors"
+
+var ErrMalformedPacket = errors.New("malformed mqtt packet")
+var ErrPacketTooLarge = errors.New("mqtt packet too large")
+var ErrProtocolViolation = errors.New("mqtt protocol violation")
+var ErrUnsupportedProtocol = errors.New("unsupported mqtt protocol")
+var ErrIdentifierRejected = errors.New("mqtt client identifier rejected")
+var ErrUnsupportedQoS = errors.New("unsupported mqtt qos")
+var ErrServerClosed = errors.New("mqtt server closed")
+var ErrInflightFull = errors.New("too many unacknowledged mqtt messages")
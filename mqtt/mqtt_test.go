@@ -0,0 +1,354 @@
+package mqtt_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/metinorak/varto/mqtt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (c *client) send(p mqtt.Packet) {
+	assert.Nil(c.t, mqtt.WritePacket(c.conn, p))
+}
+
+func (c *client) receive() mqtt.Packet {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	p, err := mqtt.ReadPacket(c.reader, 0)
+	if err != nil {
+		c.t.Fatalf("no packet received: %v", err)
+	}
+	return p
+}
+
+func (c *client) connect(p *mqtt.ConnectPacket) *mqtt.ConnackPacket {
+	p.ProtocolName = "MQTT"
+	p.ProtocolLevel = 4
+	c.send(p)
+
+	connack, ok := c.receive().(*mqtt.ConnackPacket)
+	assert.True(c.t, ok)
+	return connack
+}
+
+func (c *client) subscribe(filter string, qos byte) []byte {
+	c.send(&mqtt.SubscribePacket{PacketId: 1, Subscriptions: []mqtt.Subscription{{Filter: filter, QoS: qos}}})
+
+	suback, ok := c.receive().(*mqtt.SubackPacket)
+	assert.True(c.t, ok)
+	return suback.ReturnCodes
+}
+
+func startServer(t *testing.T, v *varto.Varto, opts *mqtt.Options) (*mqtt.Server, func() *client) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	server := mqtt.NewServer(v, opts)
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+
+	dial := func() *client {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		assert.Nil(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		return &client{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	}
+
+	return server, dial
+}
+
+func receiveMessage(t *testing.T, ch <-chan varto.Message) varto.Message {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("message is not published")
+		return varto.Message{}
+	}
+}
+
+func TestServer(t *testing.T) {
+	t.Run("TestServer_WhenClientSubscribesWithWildcard_ThenSendMatchingMessages", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		_, dial := startServer(t, v, nil)
+		c := dial()
+
+		assert.Equal(t, byte(mqtt.ConnackAccepted), c.connect(&mqtt.ConnectPacket{ClientId: "device", CleanSession: true}).ReturnCode)
+		assert.Equal(t, []byte{1}, c.subscribe("sensors/+/temp", 1))
+
+		assert.Nil(t, v.Publish("sensors/kitchen/temp", []byte("21")))
+
+		p := c.receive().(*mqtt.PublishPacket)
+		assert.Equal(t, "sensors/kitchen/temp", p.Topic)
+		assert.Equal(t, []byte("21"), p.Payload)
+		assert.Equal(t, byte(1), p.QoS)
+		assert.NotZero(t, p.PacketId)
+		c.send(&mqtt.PubackPacket{PacketId: p.PacketId})
+	})
+
+	t.Run("TestServer_WhenMessageIsPublishedWithLowerQoS_ThenSendItWithThatQoS", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		_, dial := startServer(t, v, nil)
+		publisher, subscriber := dial(), dial()
+		publisher.connect(&mqtt.ConnectPacket{ClientId: "publisher"})
+		subscriber.connect(&mqtt.ConnectPacket{ClientId: "subscriber"})
+		subscriber.subscribe("sensors/#", 1)
+
+		publisher.send(&mqtt.PublishPacket{Topic: "sensors/a", Payload: []byte("data")})
+
+		p := subscriber.receive().(*mqtt.PublishPacket)
+		assert.Equal(t, &mqtt.PublishPacket{Topic: "sensors/a", Payload: []byte("data")}, p)
+	})
+
+	t.Run("TestServer_WhenClientPublishesWithQoS1_ThenPublishAndAcknowledge", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		ch, cancel, _ := v.SubscribeChan("topic", 1)
+		defer cancel()
+		_, dial := startServer(t, v, nil)
+		c := dial()
+		c.connect(&mqtt.ConnectPacket{ClientId: "device"})
+
+		c.send(&mqtt.PublishPacket{Topic: "topic", QoS: 1, PacketId: 7, Payload: []byte("data")})
+
+		assert.Equal(t, &mqtt.PubackPacket{PacketId: 7}, c.receive())
+		msg := receiveMessage(t, ch)
+		assert.Equal(t, []byte("data"), msg.Data)
+		assert.Equal(t, "1", msg.Headers[mqtt.HeaderQoS])
+	})
+
+	t.Run("TestServer_WhenTopicHasRetainedMessage_ThenSendItOnSubscribe", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		_, dial := startServer(t, v, nil)
+		publisher := dial()
+		publisher.connect(&mqtt.ConnectPacket{ClientId: "publisher"})
+		publisher.send(&mqtt.PublishPacket{Topic: "status/a", QoS: 1, PacketId: 1, Retain: true, Payload: []byte("on")})
+		publisher.send(&mqtt.PublishPacket{Topic: "status/b", QoS: 1, PacketId: 2, Retain: true, Payload: []byte("off")})
+		publisher.send(&mqtt.PublishPacket{Topic: "status/b", QoS: 1, PacketId: 3, Retain: true})
+		publisher.receive()
+		publisher.receive()
+		publisher.receive()
+
+		subscriber := dial()
+		subscriber.connect(&mqtt.ConnectPacket{ClientId: "subscriber"})
+		assert.Equal(t, []byte{0}, subscriber.subscribe("status/+", 0))
+
+		p := subscriber.receive().(*mqtt.PublishPacket)
+		assert.Equal(t, &mqtt.PublishPacket{Topic: "status/a", Retain: true, Payload: []byte("on")}, p)
+
+		subscriber.send(&mqtt.PingreqPacket{})
+		assert.Equal(t, &mqtt.PingrespPacket{}, subscriber.receive())
+	})
+
+	t.Run("TestServer_WhenFilterOverlapsDeniedTopics_ThenDontSendTheirRetainedMessages", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		v.Use(varto.NewACL(v, varto.ACLOptions{
+			Rules: []varto.ACLRule{{Action: varto.ACLSubscribe, Topic: "private/#", Deny: true}},
+		}))
+		_, dial := startServer(t, v, nil)
+		publisher := dial()
+		publisher.connect(&mqtt.ConnectPacket{ClientId: "publisher"})
+		publisher.send(&mqtt.PublishPacket{Topic: "private/secret", QoS: 1, PacketId: 1, Retain: true, Payload: []byte("secret")})
+		publisher.send(&mqtt.PublishPacket{Topic: "public/news", QoS: 1, PacketId: 2, Retain: true, Payload: []byte("news")})
+		publisher.receive()
+		publisher.receive()
+
+		eve := dial()
+		eve.connect(&mqtt.ConnectPacket{ClientId: "eve"})
+		assert.Equal(t, []byte{mqtt.SubackFailure}, eve.subscribe("#", 0))
+		assert.Equal(t, []byte{mqtt.SubackFailure}, eve.subscribe("+/secret", 0))
+		assert.Equal(t, []byte{0}, eve.subscribe("public/#", 0))
+
+		p := eve.receive().(*mqtt.PublishPacket)
+		assert.Equal(t, &mqtt.PublishPacket{Topic: "public/news", Retain: true, Payload: []byte("news")}, p)
+
+		eve.send(&mqtt.PingreqPacket{})
+		assert.Equal(t, &mqtt.PingrespPacket{}, eve.receive())
+	})
+
+	t.Run("TestServer_WhenMaxRetainedIsReached_ThenDontRetainNewTopics", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		_, dial := startServer(t, v, &mqtt.Options{MaxRetained: 1})
+		publisher := dial()
+		publisher.connect(&mqtt.ConnectPacket{ClientId: "publisher"})
+		publisher.send(&mqtt.PublishPacket{Topic: "status/a", QoS: 1, PacketId: 1, Retain: true, Payload: []byte("on")})
+		publisher.send(&mqtt.PublishPacket{Topic: "status/b", QoS: 1, PacketId: 2, Retain: true, Payload: []byte("off")})
+		publisher.send(&mqtt.PublishPacket{Topic: "status/a", QoS: 1, PacketId: 3, Retain: true, Payload: []byte("off")})
+		publisher.receive()
+		publisher.receive()
+		publisher.receive()
+
+		subscriber := dial()
+		subscriber.connect(&mqtt.ConnectPacket{ClientId: "subscriber"})
+		assert.Equal(t, []byte{0}, subscriber.subscribe("status/+", 0))
+
+		p := subscriber.receive().(*mqtt.PublishPacket)
+		assert.Equal(t, &mqtt.PublishPacket{Topic: "status/a", Retain: true, Payload: []byte("off")}, p)
+
+		subscriber.send(&mqtt.PingreqPacket{})
+		assert.Equal(t, &mqtt.PingrespPacket{}, subscriber.receive())
+	})
+
+	t.Run("TestServer_WhenClientDisconnectsAbnormally_ThenPublishWill", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		ch, cancel, _ := v.SubscribeChan("devices/device/status", 1)
+		defer cancel()
+		_, dial := startServer(t, v, nil)
+		c := dial()
+		c.connect(&mqtt.ConnectPacket{ClientId: "device", Will: &mqtt.Will{Topic: "devices/device/status", Message: []byte("offline")}})
+
+		c.conn.Close()
+
+		assert.Equal(t, []byte("offline"), receiveMessage(t, ch).Data)
+	})
+
+	t.Run("TestServer_WhenClientSendsDisconnect_ThenDontPublishWill", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		ch, cancel, _ := v.SubscribeChan("devices/device/status", 1)
+		defer cancel()
+		_, dial := startServer(t, v, nil)
+		c := dial()
+		c.connect(&mqtt.ConnectPacket{ClientId: "device", Will: &mqtt.Will{Topic: "devices/device/status", Message: []byte("offline")}})
+
+		c.send(&mqtt.DisconnectPacket{})
+		time.Sleep(50 * time.Millisecond)
+
+		assert.Empty(t, ch)
+		stats, _ := v.Stats()
+		assert.Equal(t, 0, stats.Connections)
+	})
+
+	t.Run("TestServer_WhenKeepAliveExpires_ThenCloseConnectionAndPublishWill", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		ch, cancel, _ := v.SubscribeChan("will", 1)
+		defer cancel()
+		_, dial := startServer(t, v, nil)
+		c := dial()
+		c.connect(&mqtt.ConnectPacket{ClientId: "device", KeepAlive: 1, Will: &mqtt.Will{Topic: "will", Message: []byte("gone")}})
+
+		select {
+		case msg := <-ch:
+			assert.Equal(t, []byte("gone"), msg.Data)
+		case <-time.After(3 * time.Second):
+			t.Fatal("will is not published")
+		}
+	})
+
+	t.Run("TestServer_WhenClientIdIsInUse_ThenCloseOlderSession", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		_, dial := startServer(t, v, nil)
+		first, second := dial(), dial()
+		first.connect(&mqtt.ConnectPacket{ClientId: "device"})
+
+		assert.Equal(t, byte(mqtt.ConnackAccepted), second.connect(&mqtt.ConnectPacket{ClientId: "device"}).ReturnCode)
+
+		first.conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err := mqtt.ReadPacket(first.reader, 0)
+		assert.NotNil(t, err)
+		stats, _ := v.Stats()
+		assert.Equal(t, 1, stats.Connections)
+	})
+
+	t.Run("TestServer_WhenClientIdIsIdOfOtherConnection_ThenKeepOtherConnection", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		v.AddConnection(mockConnection)
+		v.Subscribe(mockConnection, "topic")
+		_, dial := startServer(t, v, nil)
+		c := dial()
+
+		assert.Equal(t, byte(mqtt.ConnackAccepted), c.connect(&mqtt.ConnectPacket{ClientId: "id", CleanSession: true}).ReturnCode)
+		c.send(&mqtt.DisconnectPacket{})
+
+		time.Sleep(10 * time.Millisecond)
+		assert.Len(t, v.Subscribers("topic"), 1)
+	})
+
+	t.Run("TestServer_WhenClientIdIsGeneratedIdOfOtherClient_ThenKeepOtherSession", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		clientIds := make(chan string, 2)
+		_, dial := startServer(t, v, &mqtt.Options{
+			Authenticate: func(conn varto.Connection, clientId string, username *string, password []byte) error {
+				clientIds <- clientId
+				return nil
+			},
+		})
+		first, second := dial(), dial()
+		first.connect(&mqtt.ConnectPacket{CleanSession: true})
+
+		assert.Equal(t, byte(mqtt.ConnackAccepted), second.connect(&mqtt.ConnectPacket{ClientId: <-clientIds, CleanSession: true}).ReturnCode)
+
+		stats, _ := v.Stats()
+		assert.Equal(t, 2, stats.Connections)
+	})
+
+	t.Run("TestServer_WhenProtocolLevelIsNotSupported_ThenRefuseConnection", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		_, dial := startServer(t, v, nil)
+		c := dial()
+
+		c.send(&mqtt.ConnectPacket{ProtocolName: "MQIsdp", ProtocolLevel: 3, ClientId: "device"})
+
+		assert.Equal(t, &mqtt.ConnackPacket{ReturnCode: mqtt.ConnackUnacceptableProtocol}, c.receive())
+	})
+
+	t.Run("TestServer_WhenAuthenticationFails_ThenRefuseConnection", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		_, dial := startServer(t, v, &mqtt.Options{
+			Authenticate: func(conn varto.Connection, clientId string, username *string, password []byte) error {
+				if username == nil || *username != "user" || !bytes.Equal(password, []byte("secret")) {
+					return errors.New("bad credentials")
+				}
+				return nil
+			},
+		})
+		username := "user"
+
+		assert.Equal(t, byte(mqtt.ConnackNotAuthorized), dial().connect(&mqtt.ConnectPacket{ClientId: "a", Username: &username, Password: []byte("wrong")}).ReturnCode)
+		assert.Equal(t, byte(mqtt.ConnackAccepted), dial().connect(&mqtt.ConnectPacket{ClientId: "b", Username: &username, Password: []byte("secret")}).ReturnCode)
+	})
+
+	t.Run("TestServer_WhenSubscribeIsRejected_ThenReturnFailureCode", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		v.Use(varto.OnSubscribeFunc(func(conn varto.Connection, topic string) error {
+			if topic == "private/#" {
+				return varto.ErrAccessDenied
+			}
+			return nil
+		}))
+		_, dial := startServer(t, v, nil)
+		c := dial()
+		c.connect(&mqtt.ConnectPacket{ClientId: "device"})
+
+		c.send(&mqtt.SubscribePacket{PacketId: 3, Subscriptions: []mqtt.Subscription{{Filter: "private/#", QoS: 1}, {Filter: "public/#", QoS: 2}, {Filter: "bad/#/filter"}}})
+
+		assert.Equal(t, &mqtt.SubackPacket{PacketId: 3, ReturnCodes: []byte{mqtt.SubackFailure, 1, mqtt.SubackFailure}}, c.receive())
+	})
+
+	t.Run("TestServer_WhenClientUnsubscribes_ThenStopSendingMessages", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		_, dial := startServer(t, v, nil)
+		c := dial()
+		c.connect(&mqtt.ConnectPacket{ClientId: "device"})
+		c.subscribe("a/+", 0)
+
+		c.send(&mqtt.UnsubscribePacket{PacketId: 2, Filters: []string{"a/+"}})
+
+		assert.Equal(t, &mqtt.UnsubackPacket{PacketId: 2}, c.receive())
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("a/b", []byte("data")))
+	})
+}
@@ -0,0 +1,516 @@
+// Package mqtt implements an MQTT 3.1.1 front end for varto, with QoS 0 and 1,
+// retained messages and last wills.
+package mqtt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Types of the control packets.
+const (
+	typeConnect     = 1
+	typeConnack     = 2
+	typePublish     = 3
+	typePuback      = 4
+	typeSubscribe   = 8
+	typeSuback      = 9
+	typeUnsubscribe = 10
+	typeUnsuback    = 11
+	typePingreq     = 12
+	typePingresp    = 13
+	typeDisconnect  = 14
+)
+
+// Return codes of CONNACK packets.
+const (
+	ConnackAccepted             = 0x00
+	ConnackUnacceptableProtocol = 0x01
+	ConnackIdentifierRejected   = 0x02
+	ConnackServerUnavailable    = 0x03
+	ConnackNotAuthorized        = 0x05
+)
+
+// SubackFailure is the return code of a rejected subscription in a SUBACK packet.
+const SubackFailure = 0x80
+
+// DefaultMaxPacketSize is the maximum size of a received packet if Options.MaxPacketSize is zero.
+const DefaultMaxPacketSize = 1 << 20
+
+// Packet is an MQTT control packet.
+type Packet interface {
+	encode() []byte
+}
+
+// Will is the last will of a client, published when it disconnects without a DISCONNECT packet.
+type Will struct {
+	Topic   string
+	Message []byte
+	QoS     byte
+	Retain  bool
+}
+
+type ConnectPacket struct {
+	ProtocolName  string
+	ProtocolLevel byte
+	CleanSession  bool
+	KeepAlive     uint16
+	ClientId      string
+	Will          *Will
+	Username      *string
+	Password      []byte
+}
+
+type ConnackPacket struct {
+	SessionPresent bool
+	ReturnCode     byte
+}
+
+type PublishPacket struct {
+	Dup      bool
+	QoS      byte
+	Retain   bool
+	Topic    string
+	PacketId uint16
+	Payload  []byte
+}
+
+type PubackPacket struct {
+	PacketId uint16
+}
+
+// Subscription is a topic filter and the maximum QoS requested for it.
+type Subscription struct {
+	Filter string
+	QoS    byte
+}
+
+type SubscribePacket struct {
+	PacketId      uint16
+	Subscriptions []Subscription
+}
+
+type SubackPacket struct {
+	PacketId    uint16
+	ReturnCodes []byte
+}
+
+type UnsubscribePacket struct {
+	PacketId uint16
+	Filters  []string
+}
+
+type UnsubackPacket struct {
+	PacketId uint16
+}
+
+type PingreqPacket struct{}
+
+type PingrespPacket struct{}
+
+type DisconnectPacket struct{}
+
+// WritePacket encodes a packet and writes it to w.
+func WritePacket(w io.Writer, p Packet) error {
+	_, err := w.Write(p.encode())
+	return err
+}
+
+// ReadPacket reads and decodes a packet from r. The remaining length of the packet
+// may be at most maxSize bytes; if maxSize is zero, DefaultMaxPacketSize is used.
+func ReadPacket(r io.Reader, maxSize int) (Packet, error) {
+	if maxSize == 0 {
+		maxSize = DefaultMaxPacketSize
+	}
+
+	var header [1]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	length, err := readRemainingLength(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if length > maxSize {
+		return nil, ErrPacketTooLarge
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return decodePacket(header[0]>>4, header[0]&0x0F, &decoder{buf: body})
+}
+
+func decodePacket(packetType byte, flags byte, d *decoder) (Packet, error) {
+	if packetType != typePublish && flags != requiredFlags(packetType) {
+		return nil, ErrMalformedPacket
+	}
+
+	var p Packet
+	switch packetType {
+	case typeConnect:
+		p = decodeConnect(d)
+	case typeConnack:
+		flags := d.byte()
+		p = &ConnackPacket{SessionPresent: flags&0x01 != 0, ReturnCode: d.byte()}
+	case typePublish:
+		p = decodePublish(flags, d)
+	case typePuback:
+		p = &PubackPacket{PacketId: d.uint16()}
+	case typeSubscribe:
+		s := &SubscribePacket{PacketId: d.uint16()}
+		for d.err == nil && d.remaining() > 0 {
+			s.Subscriptions = append(s.Subscriptions, Subscription{Filter: d.string(), QoS: d.byte()})
+		}
+		if len(s.Subscriptions) == 0 {
+			return nil, ErrMalformedPacket
+		}
+		p = s
+	case typeSuback:
+		s := &SubackPacket{PacketId: d.uint16()}
+		s.ReturnCodes = d.rest()
+		p = s
+	case typeUnsubscribe:
+		u := &UnsubscribePacket{PacketId: d.uint16()}
+		for d.err == nil && d.remaining() > 0 {
+			u.Filters = append(u.Filters, d.string())
+		}
+		if len(u.Filters) == 0 {
+			return nil, ErrMalformedPacket
+		}
+		p = u
+	case typeUnsuback:
+		p = &UnsubackPacket{PacketId: d.uint16()}
+	case typePingreq:
+		p = &PingreqPacket{}
+	case typePingresp:
+		p = &PingrespPacket{}
+	case typeDisconnect:
+		p = &DisconnectPacket{}
+	default:
+		return nil, ErrMalformedPacket
+	}
+
+	if d.err != nil || d.remaining() > 0 {
+		return nil, ErrMalformedPacket
+	}
+
+	return p, nil
+}
+
+func decodeConnect(d *decoder) *ConnectPacket {
+	c := &ConnectPacket{
+		ProtocolName:  d.string(),
+		ProtocolLevel: d.byte(),
+	}
+
+	flags := d.byte()
+	if flags&0x01 != 0 {
+		d.err = ErrMalformedPacket
+	}
+	c.CleanSession = flags&0x02 != 0
+	c.KeepAlive = d.uint16()
+	c.ClientId = d.string()
+
+	if flags&0x04 != 0 {
+		c.Will = &Will{
+			Topic:   d.string(),
+			Message: d.binary(),
+			QoS:     (flags >> 3) & 0x03,
+			Retain:  flags&0x20 != 0,
+		}
+	}
+
+	if flags&0x80 != 0 {
+		username := d.string()
+		c.Username = &username
+	}
+
+	if flags&0x40 != 0 {
+		c.Password = d.binary()
+	}
+
+	return c
+}
+
+func decodePublish(flags byte, d *decoder) *PublishPacket {
+	p := &PublishPacket{
+		Dup:    flags&0x08 != 0,
+		QoS:    (flags >> 1) & 0x03,
+		Retain: flags&0x01 != 0,
+		Topic:  d.string(),
+	}
+
+	if p.QoS == 3 {
+		d.err = ErrMalformedPacket
+	}
+
+	if p.QoS > 0 {
+		p.PacketId = d.uint16()
+		if p.PacketId == 0 {
+			d.err = ErrMalformedPacket
+		}
+	}
+
+	p.Payload = d.rest()
+	return p
+}
+
+func requiredFlags(packetType byte) byte {
+	switch packetType {
+	case typeSubscribe, typeUnsubscribe:
+		return 0x02
+	default:
+		return 0x00
+	}
+}
+
+func (p *ConnectPacket) encode() []byte {
+	var e encoder
+	e.string(p.ProtocolName)
+	e.byte(p.ProtocolLevel)
+
+	var flags byte
+	if p.CleanSession {
+		flags |= 0x02
+	}
+	if p.Will != nil {
+		flags |= 0x04 | p.Will.QoS<<3
+		if p.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if p.Password != nil {
+		flags |= 0x40
+	}
+	if p.Username != nil {
+		flags |= 0x80
+	}
+	e.byte(flags)
+	e.uint16(p.KeepAlive)
+	e.string(p.ClientId)
+
+	if p.Will != nil {
+		e.string(p.Will.Topic)
+		e.binary(p.Will.Message)
+	}
+	if p.Username != nil {
+		e.string(*p.Username)
+	}
+	if p.Password != nil {
+		e.binary(p.Password)
+	}
+
+	return e.packet(typeConnect<<4, nil)
+}
+
+func (p *ConnackPacket) encode() []byte {
+	var e encoder
+	if p.SessionPresent {
+		e.byte(0x01)
+	} else {
+		e.byte(0x00)
+	}
+	e.byte(p.ReturnCode)
+
+	return e.packet(typeConnack<<4, nil)
+}
+
+func (p *PublishPacket) encode() []byte {
+	header := byte(typePublish<<4) | p.QoS<<1
+	if p.Dup {
+		header |= 0x08
+	}
+	if p.Retain {
+		header |= 0x01
+	}
+
+	var e encoder
+	e.string(p.Topic)
+	if p.QoS > 0 {
+		e.uint16(p.PacketId)
+	}
+
+	return e.packet(header, p.Payload)
+}
+
+func (p *PubackPacket) encode() []byte {
+	var e encoder
+	e.uint16(p.PacketId)
+	return e.packet(typePuback<<4, nil)
+}
+
+func (p *SubscribePacket) encode() []byte {
+	var e encoder
+	e.uint16(p.PacketId)
+	for _, s := range p.Subscriptions {
+		e.string(s.Filter)
+		e.byte(s.QoS)
+	}
+
+	return e.packet(typeSubscribe<<4|0x02, nil)
+}
+
+func (p *SubackPacket) encode() []byte {
+	var e encoder
+	e.uint16(p.PacketId)
+	return e.packet(typeSuback<<4, p.ReturnCodes)
+}
+
+func (p *UnsubscribePacket) encode() []byte {
+	var e encoder
+	e.uint16(p.PacketId)
+	for _, filter := range p.Filters {
+		e.string(filter)
+	}
+
+	return e.packet(typeUnsubscribe<<4|0x02, nil)
+}
+
+func (p *UnsubackPacket) encode() []byte {
+	var e encoder
+	e.uint16(p.PacketId)
+	return e.packet(typeUnsuback<<4, nil)
+}
+
+func (p *PingreqPacket) encode() []byte {
+	return []byte{typePingreq << 4, 0}
+}
+
+func (p *PingrespPacket) encode() []byte {
+	return []byte{typePingresp << 4, 0}
+}
+
+func (p *DisconnectPacket) encode() []byte {
+	return []byte{typeDisconnect << 4, 0}
+}
+
+func readRemainingLength(r io.Reader) (int, error) {
+	length := 0
+	var b [1]byte
+
+	for i := 0; i < 4; i++ {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+
+		length |= int(b[0]&0x7F) << (7 * i)
+		if b[0]&0x80 == 0 {
+			return length, nil
+		}
+	}
+
+	return 0, ErrMalformedPacket
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf.WriteByte(b)
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.buf.Write(binary.BigEndian.AppendUint16(nil, v))
+}
+
+func (e *encoder) string(s string) {
+	e.binary([]byte(s))
+}
+
+func (e *encoder) binary(b []byte) {
+	e.uint16(uint16(len(b)))
+	e.buf.Write(b)
+}
+
+// packet prefixes the encoded variable header and the payload with the fixed header.
+func (e *encoder) packet(header byte, payload []byte) []byte {
+	length := e.buf.Len() + len(payload)
+
+	out := []byte{header}
+	for {
+		b := byte(length & 0x7F)
+		length >>= 7
+		if length > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+
+		if length == 0 {
+			break
+		}
+	}
+
+	out = append(out, e.buf.Bytes()...)
+	return append(out, payload...)
+}
+
+type decoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (d *decoder) remaining() int {
+	return len(d.buf) - d.pos
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || d.remaining() < 1 {
+		d.err = ErrMalformedPacket
+		return 0
+	}
+
+	b := d.buf[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err != nil || d.remaining() < 2 {
+		d.err = ErrMalformedPacket
+		return 0
+	}
+
+	v := binary.BigEndian.Uint16(d.buf[d.pos:])
+	d.pos += 2
+	return v
+}
+
+func (d *decoder) binary() []byte {
+	length := int(d.uint16())
+	if d.err != nil || d.remaining() < length {
+		d.err = ErrMalformedPacket
+		return nil
+	}
+
+	b := append([]byte{}, d.buf[d.pos:d.pos+length]...)
+	d.pos += length
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.binary())
+}
+
+func (d *decoder) rest() []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	b := append([]byte{}, d.buf[d.pos:]...)
+	d.pos = len(d.buf)
+	return b
+}
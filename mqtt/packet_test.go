@@ -0,0 +1,61 @@
+package mqtt_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/metinorak/varto/mqtt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacket(t *testing.T) {
+	t.Run("TestPacket_WhenPacketIsWritten_ThenReadTheSamePacket", func(t *testing.T) {
+		username := "user"
+		packets := []mqtt.Packet{
+			&mqtt.ConnectPacket{ProtocolName: "MQTT", ProtocolLevel: 4, CleanSession: true, KeepAlive: 60, ClientId: "id",
+				Will: &mqtt.Will{Topic: "will", Message: []byte("bye"), QoS: 1, Retain: true}, Username: &username, Password: []byte("pass")},
+			&mqtt.ConnackPacket{SessionPresent: true, ReturnCode: mqtt.ConnackNotAuthorized},
+			&mqtt.PublishPacket{Topic: "a/b", Payload: []byte("data")},
+			&mqtt.PublishPacket{Dup: true, QoS: 1, Retain: true, Topic: "a/b", PacketId: 10, Payload: bytes.Repeat([]byte("x"), 300)},
+			&mqtt.PubackPacket{PacketId: 10},
+			&mqtt.SubscribePacket{PacketId: 1, Subscriptions: []mqtt.Subscription{{Filter: "a/+", QoS: 1}, {Filter: "#"}}},
+			&mqtt.SubackPacket{PacketId: 1, ReturnCodes: []byte{1, mqtt.SubackFailure}},
+			&mqtt.UnsubscribePacket{PacketId: 2, Filters: []string{"a/+", "#"}},
+			&mqtt.UnsubackPacket{PacketId: 2},
+			&mqtt.PingreqPacket{},
+			&mqtt.PingrespPacket{},
+			&mqtt.DisconnectPacket{},
+		}
+
+		for _, p := range packets {
+			var buf bytes.Buffer
+			assert.Nil(t, mqtt.WritePacket(&buf, p))
+
+			read, err := mqtt.ReadPacket(&buf, 0)
+			assert.Nil(t, err)
+			assert.Equal(t, p, read)
+			assert.Zero(t, buf.Len())
+		}
+	})
+
+	t.Run("TestPacket_WhenPacketIsTooLarge_ThenReturnError", func(t *testing.T) {
+		var buf bytes.Buffer
+		mqtt.WritePacket(&buf, &mqtt.PublishPacket{Topic: "a", Payload: make([]byte, 100)})
+
+		_, err := mqtt.ReadPacket(&buf, 10)
+
+		assert.Equal(t, mqtt.ErrPacketTooLarge, err)
+	})
+
+	t.Run("TestPacket_WhenFlagsAreInvalid_ThenReturnError", func(t *testing.T) {
+		_, err := mqtt.ReadPacket(bytes.NewReader([]byte{0x80, 0x05, 0x00, 0x01, 0x00, 0x01, 'a'}), 0)
+
+		assert.Equal(t, mqtt.ErrMalformedPacket, err)
+	})
+
+	t.Run("TestPacket_WhenPublishHasQoS3_ThenReturnError", func(t *testing.T) {
+		_, err := mqtt.ReadPacket(bytes.NewReader([]byte{0x36, 0x05, 0x00, 0x01, 'a', 0x00, 0x01}), 0)
+
+		assert.Equal(t, mqtt.ErrMalformedPacket, err)
+	})
+}
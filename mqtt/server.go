@@ -0,0 +1,306 @@
+package mqtt
+
+import (
+	"cmp"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metinorak/varto"
+)
+
+// HeaderQoS is the message header holding the QoS a message is published with by an MQTT client.
+// Messages are delivered to MQTT subscribers with the lower of it and the QoS of the subscription.
+const HeaderQoS = "mqtt-qos"
+
+// DefaultConnectTimeout is the time a client has to send CONNECT if Options.ConnectTimeout is zero.
+const DefaultConnectTimeout = 10 * time.Second
+
+// DefaultMaxRetained is the maximum number of retained messages if Options.MaxRetained is zero.
+const DefaultMaxRetained = 10000
+
+// Options configures an MQTT server.
+type Options struct {
+	// Authenticate checks the client identifier and the credentials of a CONNECT packet.
+	// It gets the connection of the session, so it can set its attributes with Varto.SetAttr.
+	// If it returns an error, the client gets a CONNACK with ConnackNotAuthorized.
+	Authenticate func(conn varto.Connection, clientId string, username *string, password []byte) error
+
+	// MaxPacketSize is the maximum size of a received packet.
+	// If it is zero, DefaultMaxPacketSize is used.
+	MaxPacketSize int
+
+	// ConnectTimeout is the time a client has to send CONNECT after connecting.
+	// If it is zero, DefaultConnectTimeout is used.
+	ConnectTimeout time.Duration
+
+	// BroadcastTopic is the topic of the PUBLISH packets sent for Varto.BroadcastToAll.
+	// If it is empty, broadcasts are not sent to MQTT clients.
+	BroadcastTopic string
+
+	// MaxRetained is the maximum number of topics with a retained message. Once it is reached,
+	// messages published with the retain flag to other topics are delivered but not retained.
+	// If it is zero, DefaultMaxRetained is used.
+	MaxRetained int
+
+	// Wrap returns the connection added to the Varto in place of a session, such as Heartbeat.Track.
+	// Received packets are recorded as activity with varto.Touch.
+	Wrap func(conn varto.Connection) varto.Connection
+}
+
+// Server serves MQTT 3.1.1 clients. Every client session is a varto connection, so its
+// subscriptions and publishes go through the middleware of the Varto. The id of the connection
+// is made by the server rather than taken from the client identifier, which clients choose.
+// Topic filters with "+" and "#" need a Varto created with Options.WildcardSubscriptions.
+// Sessions are not persisted: messages that are not acknowledged are not sent again
+// when a client reconnects, and CONNACK never reports a present session.
+type Server struct {
+	v    *varto.Varto
+	opts Options
+
+	mu        sync.Mutex
+	sessions  map[string]*session
+	conns     map[net.Conn]bool
+	listeners map[net.Listener]bool
+	closed    bool
+
+	retainedMu sync.RWMutex
+	retained   map[string]retainedMessage
+
+	idPrefix string
+	lastId   atomic.Uint64
+}
+
+type retainedMessage struct {
+	topic   string
+	payload []byte
+	qos     byte
+}
+
+// NewServer returns a server publishing to and subscribing on v.
+func NewServer(v *varto.Varto, opts *Options) *Server {
+	s := &Server{
+		v:         v,
+		sessions:  make(map[string]*session),
+		conns:     make(map[net.Conn]bool),
+		listeners: make(map[net.Listener]bool),
+		retained:  make(map[string]retainedMessage),
+		idPrefix:  "mqtt:" + varto.NewConnectionId() + ":",
+	}
+
+	if opts != nil {
+		s.opts = *opts
+	}
+
+	if s.opts.ConnectTimeout == 0 {
+		s.opts.ConnectTimeout = DefaultConnectTimeout
+	}
+
+	if s.opts.MaxRetained == 0 {
+		s.opts.MaxRetained = DefaultMaxRetained
+	}
+
+	return s
+}
+
+// Serve accepts connections until the listener or the server is closed,
+// and then returns ErrServerClosed.
+func (s *Server) Serve(ln net.Listener) error {
+	if !s.trackListener(ln) {
+		ln.Close()
+		return ErrServerClosed
+	}
+	defer s.untrackListener(ln)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() || errors.Is(err, net.ErrClosed) {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a client until it disconnects, and then closes the connection.
+// It returns nil if the client sends DISCONNECT or closes the connection.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+
+	if !s.track(conn) {
+		return ErrServerClosed
+	}
+	defer s.untrack(conn)
+
+	return newSession(s, conn).serve()
+}
+
+// Close stops the listeners and closes the open connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	listeners := make([]net.Listener, 0, len(s.listeners))
+	for ln := range s.listeners {
+		listeners = append(listeners, ln)
+	}
+	conns := make([]net.Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	var err error
+	for _, ln := range listeners {
+		if lnErr := ln.Close(); err == nil {
+			err = lnErr
+		}
+	}
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+// publish publishes a message from a session and keeps it as the retained message of its topic.
+// A topic without subscribers is not an error.
+func (s *Server) publish(conn varto.Connection, topic string, payload []byte, qos byte, retain bool) error {
+	err := s.v.PublishMessageFrom(conn, varto.Message{
+		Topic:   topic,
+		Data:    payload,
+		Headers: map[string]string{HeaderQoS: strconv.Itoa(int(qos))},
+	})
+	if err != nil && !errors.Is(err, varto.ErrTopicNotFound) {
+		return err
+	}
+
+	if retain {
+		s.retain(topic, payload, qos)
+	}
+
+	return nil
+}
+
+// retain keeps the retained message of a topic. An empty payload clears it.
+// The message is dropped if the topic has none and Options.MaxRetained is reached.
+func (s *Server) retain(topic string, payload []byte, qos byte) {
+	s.retainedMu.Lock()
+	defer s.retainedMu.Unlock()
+
+	if len(payload) == 0 {
+		delete(s.retained, topic)
+		return
+	}
+
+	if _, ok := s.retained[topic]; !ok && len(s.retained) >= s.opts.MaxRetained {
+		return
+	}
+
+	s.retained[topic] = retainedMessage{topic: topic, payload: payload, qos: qos}
+}
+
+// retainedMatching returns the retained messages of the topics matching a filter, sorted by topic.
+func (s *Server) retainedMatching(filter string) []retainedMessage {
+	s.retainedMu.RLock()
+	defer s.retainedMu.RUnlock()
+
+	var messages []retainedMessage
+	for topic, msg := range s.retained {
+		if varto.MatchTopic(filter, topic) {
+			messages = append(messages, msg)
+		}
+	}
+
+	slices.SortFunc(messages, func(a, b retainedMessage) int {
+		return cmp.Compare(a.topic, b.topic)
+	})
+
+	return messages
+}
+
+// nextId returns the id of the varto connection of a session. The ids of a server start
+// with a prefix of their own, so they don't collide with the ids of other servers.
+func (s *Server) nextId() string {
+	return s.idPrefix + strconv.FormatUint(s.lastId.Add(1), 10)
+}
+
+// register makes a session the session of its client identifier. An older session with
+// the same identifier is closed, and register waits until it is finished.
+// Sessions with a client identifier made by the server are not registered.
+func (s *Server) register(sess *session) {
+	if sess.generatedClientId {
+		return
+	}
+
+	s.mu.Lock()
+	old := s.sessions[sess.clientId]
+	s.sessions[sess.clientId] = sess
+	s.mu.Unlock()
+
+	if old != nil {
+		old.conn.Close()
+		<-old.done
+	}
+}
+
+func (s *Server) unregister(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sessions[sess.clientId] == sess {
+		delete(s.sessions, sess.clientId)
+	}
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.conns[conn] = true
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+}
+
+func (s *Server) trackListener(ln net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.listeners[ln] = true
+	return true
+}
+
+func (s *Server) untrackListener(ln net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.listeners, ln)
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
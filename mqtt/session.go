@@ -0,0 +1,377 @@
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metinorak/varto"
+)
+
+const (
+	protocolName  = "MQTT"
+	protocolLevel = 4
+	maxInflight   = 65535
+)
+
+var errDisconnected = errors.New("mqtt client disconnected")
+
+// session is the varto connection of an MQTT client.
+type session struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// wrapped is the connection of the session in the Varto: the session, or the connection
+	// Options.Wrap returned for it. It is set once the client identifier is known.
+	wrapped varto.Connection
+
+	// id is the id of the connection in the Varto. clientId is the client identifier,
+	// which is made by the server if generatedClientId is set.
+	id                string
+	clientId          string
+	generatedClientId bool
+	keepAlive         time.Duration
+	will              *Will
+	disconnected      bool
+	done              chan struct{}
+
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	subscriptions map[string]byte
+	inflight      map[uint16]bool
+	lastPacketId  uint16
+}
+
+func newSession(server *Server, conn net.Conn) *session {
+	return &session{
+		server:        server,
+		conn:          conn,
+		reader:        bufio.NewReader(conn),
+		done:          make(chan struct{}),
+		subscriptions: make(map[string]byte),
+		inflight:      make(map[uint16]bool),
+	}
+}
+
+func (s *session) GetId() string {
+	return s.id
+}
+
+// Read blocks until the session is finished, since the packets of the client are read by serve.
+func (s *session) Read() ([]byte, error) {
+	<-s.done
+	return nil, io.EOF
+}
+
+// Close closes the network connection of the client, which ends the session.
+func (s *session) Close() error {
+	return s.conn.Close()
+}
+
+// Write sends a broadcast to the client on Options.BroadcastTopic.
+func (s *session) Write(data []byte) error {
+	if s.server.opts.BroadcastTopic == "" {
+		return nil
+	}
+
+	return s.writePacket(&PublishPacket{Topic: s.server.opts.BroadcastTopic, Payload: data})
+}
+
+// WriteMessage sends a message to the client with the QoS of the matching subscription.
+func (s *session) WriteMessage(msg varto.Message) error {
+	qos, ok := s.grantedQoS(msg.Topic)
+	if !ok {
+		return nil
+	}
+
+	if value, ok := msg.Headers[HeaderQoS]; ok {
+		if published, err := strconv.Atoi(value); err == nil && published >= 0 && published < int(qos) {
+			qos = byte(published)
+		}
+	}
+
+	return s.publish(msg.Topic, msg.Data, qos, false)
+}
+
+func (s *session) serve() error {
+	s.conn.SetReadDeadline(time.Now().Add(s.server.opts.ConnectTimeout))
+
+	p, err := s.readPacket()
+	if err != nil {
+		return err
+	}
+
+	connect, ok := p.(*ConnectPacket)
+	if !ok {
+		return ErrProtocolViolation
+	}
+
+	if err := s.connect(connect); err != nil {
+		return err
+	}
+
+	s.server.register(s)
+	defer s.server.unregister(s)
+	defer close(s.done)
+
+	if err := s.server.v.AddConnection(s.wrapped); err != nil {
+		s.writePacket(&ConnackPacket{ReturnCode: ConnackServerUnavailable})
+		return err
+	}
+	defer s.finish()
+
+	if err := s.writePacket(&ConnackPacket{ReturnCode: ConnackAccepted}); err != nil {
+		return err
+	}
+
+	for {
+		if s.keepAlive > 0 {
+			s.conn.SetReadDeadline(time.Now().Add(s.keepAlive * 3 / 2))
+		} else {
+			s.conn.SetReadDeadline(time.Time{})
+		}
+
+		p, err := s.readPacket()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if err := s.handle(p); err != nil {
+			if err == errDisconnected {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// connect checks a CONNECT packet and authenticates the client.
+func (s *session) connect(c *ConnectPacket) error {
+	if c.ProtocolName != protocolName || c.ProtocolLevel != protocolLevel {
+		s.writePacket(&ConnackPacket{ReturnCode: ConnackUnacceptableProtocol})
+		return ErrUnsupportedProtocol
+	}
+
+	if c.Will != nil && !validTopic(c.Will.Topic) {
+		return ErrProtocolViolation
+	}
+
+	s.id = s.server.nextId()
+	s.clientId = c.ClientId
+	if s.clientId == "" {
+		if !c.CleanSession {
+			s.writePacket(&ConnackPacket{ReturnCode: ConnackIdentifierRejected})
+			return ErrIdentifierRejected
+		}
+
+		s.clientId = s.id
+		s.generatedClientId = true
+	}
+
+	s.wrapped = s
+	if wrap := s.server.opts.Wrap; wrap != nil {
+		s.wrapped = wrap(s)
+	}
+
+	if authenticate := s.server.opts.Authenticate; authenticate != nil {
+		if err := authenticate(s.wrapped, s.clientId, c.Username, c.Password); err != nil {
+			s.writePacket(&ConnackPacket{ReturnCode: ConnackNotAuthorized})
+			return err
+		}
+	}
+
+	s.keepAlive = time.Duration(c.KeepAlive) * time.Second
+	s.will = c.Will
+	return nil
+}
+
+// finish publishes the will if the client didn't send DISCONNECT, and removes the session
+// from varto. The will is published first, so that middleware release the state of
+// the session after it rather than keeping the state recreated for it.
+func (s *session) finish() {
+	if !s.disconnected && s.will != nil {
+		s.server.publish(s.wrapped, s.will.Topic, s.will.Message, s.will.QoS, s.will.Retain)
+	}
+
+	s.server.v.RemoveConnection(s.wrapped)
+}
+
+func (s *session) handle(p Packet) error {
+	switch p := p.(type) {
+	case *PublishPacket:
+		return s.handlePublish(p)
+	case *PubackPacket:
+		s.mu.Lock()
+		delete(s.inflight, p.PacketId)
+		s.mu.Unlock()
+		return nil
+	case *SubscribePacket:
+		return s.handleSubscribe(p)
+	case *UnsubscribePacket:
+		for _, filter := range p.Filters {
+			s.server.v.Unsubscribe(s.wrapped, filter)
+
+			s.mu.Lock()
+			delete(s.subscriptions, filter)
+			s.mu.Unlock()
+		}
+		return s.writePacket(&UnsubackPacket{PacketId: p.PacketId})
+	case *PingreqPacket:
+		return s.writePacket(&PingrespPacket{})
+	case *DisconnectPacket:
+		s.disconnected = true
+		return errDisconnected
+	default:
+		return ErrProtocolViolation
+	}
+}
+
+func (s *session) handlePublish(p *PublishPacket) error {
+	if p.QoS > 1 {
+		return ErrUnsupportedQoS
+	}
+
+	if !validTopic(p.Topic) {
+		return ErrProtocolViolation
+	}
+
+	if err := s.server.publish(s.wrapped, p.Topic, p.Payload, p.QoS, p.Retain); err != nil {
+		return err
+	}
+
+	if p.QoS == 1 {
+		return s.writePacket(&PubackPacket{PacketId: p.PacketId})
+	}
+
+	return nil
+}
+
+// handleSubscribe subscribes to the filters, acknowledges them with the granted QoS,
+// and then sends the retained messages matching the accepted filters.
+func (s *session) handleSubscribe(p *SubscribePacket) error {
+	codes := make([]byte, len(p.Subscriptions))
+	accepted := make([]Subscription, 0, len(p.Subscriptions))
+
+	for i, sub := range p.Subscriptions {
+		if sub.QoS > 2 {
+			return ErrMalformedPacket
+		}
+		qos := min(sub.QoS, 1)
+
+		// The subscription is recorded first, so messages published right after
+		// subscribing are delivered with its QoS.
+		s.mu.Lock()
+		previous, existed := s.subscriptions[sub.Filter]
+		s.subscriptions[sub.Filter] = qos
+		s.mu.Unlock()
+
+		if err := s.server.v.Subscribe(s.wrapped, sub.Filter); err != nil {
+			s.mu.Lock()
+			if existed {
+				s.subscriptions[sub.Filter] = previous
+			} else {
+				delete(s.subscriptions, sub.Filter)
+			}
+			s.mu.Unlock()
+
+			codes[i] = SubackFailure
+			continue
+		}
+
+		codes[i] = qos
+		accepted = append(accepted, Subscription{Filter: sub.Filter, QoS: qos})
+	}
+
+	if err := s.writePacket(&SubackPacket{PacketId: p.PacketId, ReturnCodes: codes}); err != nil {
+		return err
+	}
+
+	for _, sub := range accepted {
+		for _, msg := range s.server.retainedMatching(sub.Filter) {
+			if err := s.publish(msg.topic, msg.payload, min(sub.QoS, msg.qos), true); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// grantedQoS returns the highest QoS of the subscriptions matching a topic.
+func (s *session) grantedQoS(topic string) (byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var qos byte
+	matched := false
+	for filter, granted := range s.subscriptions {
+		if varto.MatchTopic(filter, topic) {
+			qos = max(qos, granted)
+			matched = true
+		}
+	}
+
+	return qos, matched
+}
+
+func (s *session) publish(topic string, payload []byte, qos byte, retain bool) error {
+	p := &PublishPacket{Topic: topic, Payload: payload, QoS: qos, Retain: retain}
+
+	if qos > 0 {
+		id, err := s.nextPacketId()
+		if err != nil {
+			return err
+		}
+		p.PacketId = id
+	}
+
+	return s.writePacket(p)
+}
+
+// nextPacketId returns a packet identifier that is not used by an unacknowledged message.
+func (s *session) nextPacketId() (uint16, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.inflight) >= maxInflight {
+		return 0, ErrInflightFull
+	}
+
+	for {
+		s.lastPacketId++
+		if s.lastPacketId != 0 && !s.inflight[s.lastPacketId] {
+			s.inflight[s.lastPacketId] = true
+			return s.lastPacketId, nil
+		}
+	}
+}
+
+func (s *session) readPacket() (Packet, error) {
+	p, err := ReadPacket(s.reader, s.server.opts.MaxPacketSize)
+	if err == nil && s.wrapped != nil {
+		varto.Touch(s.wrapped)
+	}
+	return p, err
+}
+
+func (s *session) writePacket(p Packet) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return WritePacket(s.conn, p)
+}
+
+// validTopic reports whether a topic can be published to.
+func validTopic(topic string) bool {
+	return topic != "" && !strings.ContainsAny(topic, "+#")
+}
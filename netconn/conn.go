@@ -0,0 +1,126 @@
+// Package netconn implements varto connections over stream sockets such as TCP and Unix
+// domain sockets. Each message is sent as a frame prefixed by its length as a 4-byte
+// big-endian integer.
+package netconn
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/metinorak/varto"
+)
+
+// DefaultMaxFrameSize is the maximum size of a received frame if Options.MaxFrameSize is zero.
+const DefaultMaxFrameSize = 1 << 20
+
+// Options configures connections.
+type Options struct {
+	// MaxFrameSize is the maximum size of a received frame.
+	// If it is zero, DefaultMaxFrameSize is used.
+	MaxFrameSize int
+
+	// Id returns the id of a connection. If it is nil, a random id is used.
+	Id func(conn net.Conn) string
+
+	// Wrap returns the connection a Listener serves in place of a connection, such as Heartbeat.Track.
+	Wrap func(conn varto.Connection) varto.Connection
+}
+
+// Conn is a varto.Connection over a net.Conn.
+// Read may be called from one goroutine, while Write and Close may be called concurrently.
+type Conn struct {
+	id           string
+	conn         net.Conn
+	reader       *bufio.Reader
+	maxFrameSize int
+
+	writeMu sync.Mutex
+}
+
+// New wraps a net.Conn as a connection.
+func New(conn net.Conn, opts *Options) *Conn {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	c := &Conn{
+		conn:         conn,
+		reader:       bufio.NewReader(conn),
+		maxFrameSize: opts.MaxFrameSize,
+	}
+
+	if c.maxFrameSize == 0 {
+		c.maxFrameSize = DefaultMaxFrameSize
+	}
+
+	if opts.Id != nil {
+		c.id = opts.Id(conn)
+	} else {
+		c.id = varto.NewConnectionId()
+	}
+
+	return c
+}
+
+// Dial connects to an address on a network such as "tcp" or "unix".
+func Dial(network string, address string, opts *Options) (*Conn, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(conn, opts), nil
+}
+
+func (c *Conn) GetId() string {
+	return c.id
+}
+
+// Read returns the payload of the next frame.
+// It returns io.EOF if the peer closed the connection between frames.
+func (c *Conn) Read() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if uint64(size) > uint64(c.maxFrameSize) {
+		return nil, ErrFrameTooLarge
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Write sends data as a single frame.
+func (c *Conn) Write(data []byte) error {
+	if uint64(len(data)) > 0xFFFFFFFF {
+		return ErrFrameTooLarge
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close closes the underlying connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,6 @@
+package netconn
+
+import "errors"
+
+var ErrFrameTooLarge = errors.New("frame too large")
+var ErrListenerClosed = errors.New("listener closed")
@@ -0,0 +1,121 @@
+package netconn
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/metinorak/varto"
+)
+
+// Listener accepts connections and serves each of them with varto.Serve.
+type Listener struct {
+	v    *varto.Varto
+	ln   net.Listener
+	opts *Options
+
+	mu     sync.Mutex
+	conns  map[*Conn]bool
+	closed bool
+}
+
+// Listen listens on an address on a network such as "tcp" or "unix".
+func Listen(v *varto.Varto, network string, address string, opts *Options) (*Listener, error) {
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewListener(v, ln, opts), nil
+}
+
+// NewListener serves the connections accepted by a net.Listener.
+func NewListener(v *varto.Varto, ln net.Listener, opts *Options) *Listener {
+	return &Listener{
+		v:     v,
+		ln:    ln,
+		opts:  opts,
+		conns: make(map[*Conn]bool),
+	}
+}
+
+// Addr returns the address the listener listens on.
+func (l *Listener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// Serve accepts connections until the listener is closed,
+// and then returns ErrListenerClosed.
+func (l *Listener) Serve() error {
+	for {
+		netConn, err := l.ln.Accept()
+		if err != nil {
+			if l.isClosed() || errors.Is(err, net.ErrClosed) {
+				return ErrListenerClosed
+			}
+			return err
+		}
+
+		conn := New(netConn, l.opts)
+		if !l.track(conn) {
+			conn.Close()
+			return ErrListenerClosed
+		}
+
+		go func() {
+			defer l.untrack(conn)
+			defer conn.Close()
+
+			if l.opts != nil && l.opts.Wrap != nil {
+				l.v.Serve(l.opts.Wrap(conn))
+				return
+			}
+
+			l.v.Serve(conn)
+		}()
+	}
+}
+
+// Close stops accepting connections and closes the open ones.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	conns := make([]*Conn, 0, len(l.conns))
+	for conn := range l.conns {
+		conns = append(conns, conn)
+	}
+	l.mu.Unlock()
+
+	err := l.ln.Close()
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+func (l *Listener) track(conn *Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return false
+	}
+
+	l.conns[conn] = true
+	return true
+}
+
+func (l *Listener) untrack(conn *Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.conns, conn)
+}
+
+func (l *Listener) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.closed
+}
@@ -0,0 +1,134 @@
+package netconn_test
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/internal/testutil"
+	"github.com/metinorak/varto/netconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn(t *testing.T) {
+	t.Run("TestConn_WhenFrameIsWritten_ThenReadSamePayload", func(t *testing.T) {
+		client, server := net.Pipe()
+		c1 := netconn.New(client, nil)
+		c2 := netconn.New(server, nil)
+
+		go func() {
+			c1.Write([]byte("data"))
+			c1.Write(nil)
+			c1.Close()
+		}()
+
+		data, err := c2.Read()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("data"), data)
+
+		data, err = c2.Read()
+		assert.Nil(t, err)
+		assert.Empty(t, data)
+
+		_, err = c2.Read()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("TestConn_WhenFrameIsTooLarge_ThenReturnError", func(t *testing.T) {
+		client, server := net.Pipe()
+		c1 := netconn.New(client, nil)
+		c2 := netconn.New(server, &netconn.Options{MaxFrameSize: 3})
+
+		go c1.Write([]byte("data"))
+
+		_, err := c2.Read()
+		assert.Equal(t, netconn.ErrFrameTooLarge, err)
+	})
+}
+
+func TestListener(t *testing.T) {
+	listen := func(t *testing.T, v *varto.Varto, network string, address string) *netconn.Listener {
+		l, err := netconn.Listen(v, network, address, nil)
+		assert.Nil(t, err)
+		t.Cleanup(func() { l.Close() })
+
+		go l.Serve()
+		return l
+	}
+
+	dial := func(t *testing.T, l *netconn.Listener) *netconn.Conn {
+		conn, err := netconn.Dial(l.Addr().Network(), l.Addr().String(), nil)
+		assert.Nil(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		return conn
+	}
+
+	send := func(t *testing.T, conn *netconn.Conn, cmd varto.Command) {
+		data, _ := json.Marshal(cmd)
+		assert.Nil(t, conn.Write(data))
+	}
+
+	subscribed := func(v *varto.Varto) func() bool {
+		return func() bool {
+			stats, _ := v.Stats()
+			return stats.Subscriptions == 1
+		}
+	}
+
+	t.Run("TestListener_WhenTCPClientSubscribes_ThenReceivePublishedData", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := dial(t, listen(t, v, "tcp", "127.0.0.1:0"))
+
+		send(t, conn, varto.Command{Action: varto.ActionSubscribe, Topic: "topic"})
+		testutil.WaitFor(t, subscribed(v))
+		v.Publish("topic", []byte("data"))
+
+		data, err := conn.Read()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("data"), data)
+	})
+
+	t.Run("TestListener_WhenUnixClientPublishes_ThenOtherClientReceives", func(t *testing.T) {
+		v := varto.New(nil)
+		l := listen(t, v, "unix", filepath.Join(t.TempDir(), "varto.sock"))
+		subscriber := dial(t, l)
+		publisher := dial(t, l)
+
+		send(t, subscriber, varto.Command{Action: varto.ActionSubscribe, Topic: "topic"})
+		testutil.WaitFor(t, subscribed(v))
+		send(t, publisher, varto.Command{Action: varto.ActionPublish, Topic: "topic", Data: "data"})
+
+		data, err := subscriber.Read()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("data"), data)
+	})
+
+	t.Run("TestListener_WhenClosed_ThenCloseConnectionsAndStopServing", func(t *testing.T) {
+		v := varto.New(nil)
+		l, err := netconn.Listen(v, "tcp", "127.0.0.1:0", nil)
+		assert.Nil(t, err)
+
+		served := make(chan error, 1)
+		go func() {
+			served <- l.Serve()
+		}()
+
+		conn := dial(t, l)
+		send(t, conn, varto.Command{Action: varto.ActionSubscribe, Topic: "topic"})
+		testutil.WaitFor(t, subscribed(v))
+
+		assert.Nil(t, l.Close())
+		assert.Equal(t, netconn.ErrListenerClosed, <-served)
+
+		_, err = conn.Read()
+		assert.NotNil(t, err)
+		testutil.WaitFor(t, func() bool {
+			stats, _ := v.Stats()
+			return stats == varto.Stats{}
+		})
+	})
+}
@@ -0,0 +1,120 @@
+package varto
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// PresenceTopicPrefix is the prefix of the topics presence events are published to.
+// Events of a topic are published to PresenceTopicPrefix + topic.
+// The topics are reserved for presence events while Options.PresenceEvents is enabled.
+const PresenceTopicPrefix = "presence/"
+
+// PresenceAttr is the connection attribute that holds the presence metadata, as a map[string]string.
+const PresenceAttr = "presence"
+
+type PresenceEventType string
+
+const (
+	PresenceJoin  PresenceEventType = "join"
+	PresenceLeave PresenceEventType = "leave"
+)
+
+// PresenceEvent is emitted when a connection joins or leaves a topic.
+type PresenceEvent struct {
+	Type         PresenceEventType `json:"type"`
+	Topic        string            `json:"topic"`
+	ConnectionId string            `json:"connectionId"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// PresenceMember is a connection that is subscribed to a topic.
+type PresenceMember struct {
+	ConnectionId string            `json:"connectionId"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+
+	c := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		c[k] = v
+	}
+
+	return c
+}
+
+// SetPresenceMetadata sets the metadata that is reported along with the connection
+// in presence events and in Presence. Passing nil clears it.
+// It is stored as the PresenceAttr attribute of the connection.
+func (v *Varto) SetPresenceMetadata(conn Connection, metadata map[string]string) error {
+	if metadata == nil {
+		return v.DeleteAttr(conn, PresenceAttr)
+	}
+
+	return v.SetAttr(conn, PresenceAttr, copyMetadata(metadata))
+}
+
+func (v *Varto) presenceMetadata(conn Connection) map[string]string {
+	metadata, _ := v.Attrs(conn)[PresenceAttr].(map[string]string)
+	return copyMetadata(metadata)
+}
+
+// isPresenceTopic reports whether a topic is reserved for presence events.
+func (v *Varto) isPresenceTopic(topic string) bool {
+	return v.opts.PresenceEvents && strings.HasPrefix(topic, PresenceTopicPrefix)
+}
+
+// Presence returns the connections that are currently subscribed to a topic.
+func (v *Varto) Presence(topic string) ([]PresenceMember, error) {
+	if topic == "" {
+		return nil, ErrInvalidTopicName
+	}
+
+	var members []PresenceMember
+	for _, conn := range v.subscriptions.ConnectionsOf(topic) {
+		members = append(members, PresenceMember{
+			ConnectionId: conn.GetId(),
+			Metadata:     v.presenceMetadata(conn),
+		})
+	}
+
+	return members, nil
+}
+
+func (v *Varto) presenceEnabled() bool {
+	return v.opts.PresenceEvents || v.opts.OnPresence != nil
+}
+
+// emitPresence reports a join or leave to the presence callback and the presence topic.
+func (v *Varto) emitPresence(eventType PresenceEventType, conn Connection, topic string) {
+	if !v.presenceEnabled() || strings.HasPrefix(topic, PresenceTopicPrefix) {
+		return
+	}
+
+	event := PresenceEvent{
+		Type:         eventType,
+		Topic:        topic,
+		ConnectionId: conn.GetId(),
+		Metadata:     v.presenceMetadata(conn),
+	}
+
+	if v.opts.OnPresence != nil {
+		v.opts.OnPresence(event)
+	}
+
+	if v.opts.PresenceEvents {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+
+		name := PresenceTopicPrefix + topic
+		if t, err := v.store.GetTopic(name); err == nil {
+			deliver(t, Message{Topic: name, Data: data, Id: v.nextMessageId()})
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package varto_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPresence(t *testing.T) {
+	t.Run("TestPresence_WhenTopicNameIsEmpty_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+
+		_, err := v.Presence("")
+		assert.Equal(t, varto.ErrInvalidTopicName, err)
+	})
+
+	t.Run("TestPresence_WhenSubscribed_ThenReturnMembersWithMetadata", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.SetPresenceMetadata(mockConnection, map[string]string{"name": "alice"})
+		v.Subscribe(mockConnection, "room")
+
+		members, err := v.Presence("room")
+		assert.Nil(t, err)
+		assert.Equal(t, []varto.PresenceMember{{ConnectionId: "id", Metadata: map[string]string{"name": "alice"}}}, members)
+	})
+
+	t.Run("TestPresence_WhenConnectionIsNotHashable_ThenKeyMetadataById", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := valueConnection{id: "id", tags: map[string]string{}}
+
+		assert.NotPanics(t, func() {
+			assert.Nil(t, v.SetPresenceMetadata(conn, map[string]string{"name": "alice"}))
+			assert.Nil(t, v.Subscribe(conn, "room"))
+		})
+
+		members, err := v.Presence("room")
+		assert.Nil(t, err)
+		assert.Equal(t, []varto.PresenceMember{{ConnectionId: "id", Metadata: map[string]string{"name": "alice"}}}, members)
+	})
+
+	t.Run("TestPresence_WhenConnectionIsRemoved_ThenReturnNoMembers", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.AddConnection(mockConnection)
+		v.Subscribe(mockConnection, "room")
+		v.RemoveConnection(mockConnection)
+
+		members, err := v.Presence("room")
+		assert.Nil(t, err)
+		assert.Empty(t, members)
+	})
+
+	t.Run("TestPresence_WhenCallbackIsSet_ThenEmitJoinAndLeaveEvents", func(t *testing.T) {
+		var events []varto.PresenceEvent
+		v := varto.New(&varto.Options{
+			OnPresence: func(event varto.PresenceEvent) {
+				events = append(events, event)
+			},
+		})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.AddConnection(mockConnection)
+		v.Subscribe(mockConnection, "room")
+		v.Subscribe(mockConnection, "room")
+		v.Subscribe(mockConnection, "lobby")
+		v.Unsubscribe(mockConnection, "room")
+		v.RemoveConnection(mockConnection)
+
+		assert.Equal(t, []varto.PresenceEvent{
+			{Type: varto.PresenceJoin, Topic: "room", ConnectionId: "id"},
+			{Type: varto.PresenceJoin, Topic: "lobby", ConnectionId: "id"},
+			{Type: varto.PresenceLeave, Topic: "room", ConnectionId: "id"},
+			{Type: varto.PresenceLeave, Topic: "lobby", ConnectionId: "id"},
+		}, events)
+	})
+
+	t.Run("TestPresence_WhenPresenceEventsAreEnabled_ThenPublishToPresenceTopic", func(t *testing.T) {
+		v := varto.New(&varto.Options{PresenceEvents: true})
+		watcher := mock.NewMockConnection(gomock.NewController(t))
+		watcher.EXPECT().GetId().Return("watcher").AnyTimes()
+		watcher.EXPECT().Write([]byte(`{"type":"join","topic":"room","connectionId":"id"}`)).Return(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Subscribe(watcher, varto.PresenceTopicPrefix+"room")
+		v.Subscribe(mockConnection, "room")
+
+		time.Sleep(10 * time.Millisecond)
+	})
+	t.Run("TestPresence_WhenPresenceEventsAreEnabled_ThenRejectPublishToPresenceTopic", func(t *testing.T) {
+		v := varto.New(&varto.Options{PresenceEvents: true})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+
+		err := v.PublishFrom(mockConnection, varto.PresenceTopicPrefix+"room", []byte(`{"type":"join"}`))
+		assert.Equal(t, varto.ErrReservedTopic, err)
+	})
+
+	t.Run("TestPresence_WhenMetadataIsSet_ThenStoreItAsAttribute", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.SetAttr(mockConnection, varto.PresenceAttr, map[string]string{"name": "alice"})
+		v.Subscribe(mockConnection, "room")
+		members, _ := v.Presence("room")
+		assert.Equal(t, map[string]string{"name": "alice"}, members[0].Metadata)
+
+		v.SetPresenceMetadata(mockConnection, nil)
+		_, ok := v.Attr(mockConnection, varto.PresenceAttr)
+		assert.False(t, ok)
+	})
+}
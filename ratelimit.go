@@ -0,0 +1,260 @@
+package varto
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit allows Rate operations per second on average, with bursts of up to Burst operations.
+// A zero RateLimit means no limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+
+	return float64(l.Burst)
+}
+
+type RateLimitOptions struct {
+	// PublishPerConnection limits the messages each connection publishes with PublishFrom.
+	PublishPerConnection RateLimit
+
+	// PublishPerTopic limits the messages published to each topic.
+	PublishPerTopic RateLimit
+
+	// PublishGlobal limits all the messages published.
+	PublishGlobal RateLimit
+
+	// SubscribePerConnection limits the subscriptions of each connection.
+	SubscribePerConnection RateLimit
+
+	// SubscribePerTopic limits the subscriptions to each topic.
+	SubscribePerTopic RateLimit
+
+	// SubscribeGlobal limits all the subscriptions.
+	SubscribeGlobal RateLimit
+}
+
+// RateLimitError is returned when an operation exceeds a rate limit.
+// It matches ErrRateLimited with errors.Is.
+type RateLimitError struct {
+	// Scope is the limit that was exceeded: "connection", "topic" or "global".
+	Scope string
+
+	// RetryAfter is how long to wait before the operation is allowed again.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: %s limit exceeded, retry after %s", ErrRateLimited, e.Scope, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// rateLimitSweepInterval is how often the buckets of connections and topics are swept.
+// Buckets that have refilled are removed, since a new bucket would be the same.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter is a middleware that limits publishes and subscriptions with token buckets.
+// A publish from a connection takes a token from its connection, topic and global buckets at once,
+// so a publish rejected by one of them doesn't consume tokens of the others.
+type RateLimiter struct {
+	BaseMiddleware
+	sync.Mutex
+	opts  RateLimitOptions
+	now   func() time.Time
+	swept time.Time
+
+	publishByConnection   map[string]*tokenBucket
+	publishByTopic        map[string]*tokenBucket
+	publishGlobal         *tokenBucket
+	subscribeByConnection map[string]*tokenBucket
+	subscribeByTopic      map[string]*tokenBucket
+	subscribeGlobal       *tokenBucket
+
+	// prepaid counts the publishes of each topic whose tokens were taken by OnPublishFrom.
+	prepaid map[string]int
+}
+
+// NewRateLimiter returns a new RateLimiter middleware.
+func NewRateLimiter(opts RateLimitOptions) *RateLimiter {
+	return &RateLimiter{
+		opts:                  opts,
+		now:                   time.Now,
+		publishByConnection:   make(map[string]*tokenBucket),
+		publishByTopic:        make(map[string]*tokenBucket),
+		publishGlobal:         newTokenBucket(opts.PublishGlobal),
+		subscribeByConnection: make(map[string]*tokenBucket),
+		subscribeByTopic:      make(map[string]*tokenBucket),
+		subscribeGlobal:       newTokenBucket(opts.SubscribeGlobal),
+		prepaid:               make(map[string]int),
+	}
+}
+
+func (r *RateLimiter) OnRemoveConnection(conn Connection) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.publishByConnection, conn.GetId())
+	delete(r.subscribeByConnection, conn.GetId())
+	return nil
+}
+
+func (r *RateLimiter) OnSubscribe(conn Connection, topic string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.sweep()
+	return r.take(
+		rateLimitCheck{"connection", r.opts.SubscribePerConnection, bucketFor(r.subscribeByConnection, conn.GetId(), r.opts.SubscribePerConnection)},
+		rateLimitCheck{"topic", r.opts.SubscribePerTopic, bucketFor(r.subscribeByTopic, topic, r.opts.SubscribePerTopic)},
+		rateLimitCheck{"global", r.opts.SubscribeGlobal, r.subscribeGlobal},
+	)
+}
+
+// OnPublishFrom takes the tokens of a publish from a connection. The tokens of the topic and global limits
+// are taken with the token of the connection, so the OnPublish call that follows for the publish doesn't take them again.
+func (r *RateLimiter) OnPublishFrom(conn Connection, topic string, data []byte) error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.sweep()
+	if err := r.take(append(r.topicChecks(topic), r.connectionCheck(conn))...); err != nil {
+		return err
+	}
+
+	r.prepaid[topic]++
+	return nil
+}
+
+func (r *RateLimiter) OnPublish(topic string, data []byte) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.prepaid[topic] > 0 {
+		r.prepaid[topic]--
+		if r.prepaid[topic] == 0 {
+			delete(r.prepaid, topic)
+		}
+		return nil
+	}
+
+	r.sweep()
+	return r.take(r.topicChecks(topic)...)
+}
+
+func (r *RateLimiter) connectionCheck(conn Connection) rateLimitCheck {
+	return rateLimitCheck{"connection", r.opts.PublishPerConnection, bucketFor(r.publishByConnection, conn.GetId(), r.opts.PublishPerConnection)}
+}
+
+func (r *RateLimiter) topicChecks(topic string) []rateLimitCheck {
+	return []rateLimitCheck{
+		{"topic", r.opts.PublishPerTopic, bucketFor(r.publishByTopic, topic, r.opts.PublishPerTopic)},
+		{"global", r.opts.PublishGlobal, r.publishGlobal},
+	}
+}
+
+// sweep removes the buckets of connections and topics that have refilled, at most once per rateLimitSweepInterval.
+func (r *RateLimiter) sweep() {
+	now := r.now()
+	if now.Sub(r.swept) < rateLimitSweepInterval {
+		return
+	}
+	r.swept = now
+
+	sweepBuckets(r.publishByConnection, r.opts.PublishPerConnection, now)
+	sweepBuckets(r.publishByTopic, r.opts.PublishPerTopic, now)
+	sweepBuckets(r.subscribeByConnection, r.opts.SubscribePerConnection, now)
+	sweepBuckets(r.subscribeByTopic, r.opts.SubscribePerTopic, now)
+}
+
+func sweepBuckets(buckets map[string]*tokenBucket, limit RateLimit, now time.Time) {
+	for key, b := range buckets {
+		b.wait(limit, now)
+		if b.tokens >= limit.burst() {
+			delete(buckets, key)
+		}
+	}
+}
+
+type rateLimitCheck struct {
+	scope  string
+	limit  RateLimit
+	bucket *tokenBucket
+}
+
+// take takes a token from every bucket, or from none of them if any of them is empty.
+func (r *RateLimiter) take(checks ...rateLimitCheck) error {
+	now := r.now()
+
+	for _, c := range checks {
+		if c.bucket == nil {
+			continue
+		}
+
+		if wait := c.bucket.wait(c.limit, now); wait > 0 {
+			return &RateLimitError{Scope: c.scope, RetryAfter: wait}
+		}
+	}
+
+	for _, c := range checks {
+		if c.bucket != nil {
+			c.bucket.tokens--
+		}
+	}
+
+	return nil
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	if !limit.enabled() {
+		return nil
+	}
+
+	return &tokenBucket{tokens: limit.burst()}
+}
+
+func bucketFor(buckets map[string]*tokenBucket, key string, limit RateLimit) *tokenBucket {
+	if !limit.enabled() {
+		return nil
+	}
+
+	if _, ok := buckets[key]; !ok {
+		buckets[key] = newTokenBucket(limit)
+	}
+
+	return buckets[key]
+}
+
+// wait refills the bucket and returns how long to wait until it has a token.
+func (b *tokenBucket) wait(limit RateLimit, now time.Time) time.Duration {
+	if !b.last.IsZero() {
+		elapsed := now.Sub(b.last).Seconds()
+		b.tokens = math.Min(limit.burst(), b.tokens+elapsed*limit.Rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
@@ -0,0 +1,142 @@
+package varto_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// topicRateLimiter overrides OnPublish of the RateLimiter it embeds to record the topics published to.
+type topicRateLimiter struct {
+	*varto.RateLimiter
+	topics []string
+}
+
+func (r *topicRateLimiter) OnPublish(topic string, data []byte) error {
+	r.topics = append(r.topics, topic)
+	return r.RateLimiter.OnPublish(topic, data)
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("TestRateLimiter_WhenPublishExceedsGlobalLimit_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewRateLimiter(varto.RateLimitOptions{
+			PublishGlobal: varto.RateLimit{Rate: 1, Burst: 2},
+		}))
+
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic", []byte("data")))
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic2", []byte("data")))
+
+		err := v.Publish("topic", []byte("data"))
+		assert.True(t, errors.Is(err, varto.ErrRateLimited))
+
+		var rateLimitErr *varto.RateLimitError
+		assert.True(t, errors.As(err, &rateLimitErr))
+		assert.Equal(t, "global", rateLimitErr.Scope)
+		assert.Greater(t, rateLimitErr.RetryAfter.Nanoseconds(), int64(0))
+	})
+
+	t.Run("TestRateLimiter_WhenPublishExceedsTopicLimit_ThenOtherTopicsAreAllowed", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewRateLimiter(varto.RateLimitOptions{
+			PublishPerTopic: varto.RateLimit{Rate: 1, Burst: 1},
+		}))
+
+		v.Publish("topic", []byte("data"))
+		assert.True(t, errors.Is(v.Publish("topic", []byte("data")), varto.ErrRateLimited))
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic2", []byte("data")))
+	})
+
+	t.Run("TestRateLimiter_WhenConnectionExceedsPublishLimit_ThenOtherConnectionsAreAllowed", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewRateLimiter(varto.RateLimitOptions{
+			PublishPerConnection: varto.RateLimit{Rate: 1, Burst: 1},
+		}))
+		mockConnection1 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection1.EXPECT().GetId().Return("id1").AnyTimes()
+		mockConnection2 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection2.EXPECT().GetId().Return("id2").AnyTimes()
+
+		v.PublishFrom(mockConnection1, "topic", []byte("data"))
+		assert.True(t, errors.Is(v.PublishFrom(mockConnection1, "topic", []byte("data")), varto.ErrRateLimited))
+		assert.Equal(t, varto.ErrTopicNotFound, v.PublishFrom(mockConnection2, "topic", []byte("data")))
+	})
+
+	t.Run("TestRateLimiter_WhenConnectionIsNotHashable_ThenKeyBucketsById", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewRateLimiter(varto.RateLimitOptions{
+			PublishPerConnection:   varto.RateLimit{Rate: 1, Burst: 1},
+			SubscribePerConnection: varto.RateLimit{Rate: 1, Burst: 1},
+		}))
+		conn := valueConnection{id: "id", tags: map[string]string{}}
+
+		assert.NotPanics(t, func() {
+			assert.Nil(t, v.Subscribe(conn, "topic"))
+			assert.Nil(t, v.PublishFrom(conn, "topic", []byte("data")))
+			assert.True(t, errors.Is(v.PublishFrom(conn, "topic", []byte("data")), varto.ErrRateLimited))
+		})
+	})
+
+	t.Run("TestRateLimiter_WhenTopicLimitRejectsPublish_ThenKeepConnectionToken", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewRateLimiter(varto.RateLimitOptions{
+			PublishPerConnection: varto.RateLimit{Rate: 1, Burst: 2},
+			PublishPerTopic:      varto.RateLimit{Rate: 1, Burst: 1},
+		}))
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		assert.Equal(t, varto.ErrTopicNotFound, v.PublishFrom(mockConnection, "topic", []byte("data")))
+
+		var rateLimitErr *varto.RateLimitError
+		assert.True(t, errors.As(v.PublishFrom(mockConnection, "topic", []byte("data")), &rateLimitErr))
+		assert.Equal(t, "topic", rateLimitErr.Scope)
+		assert.Equal(t, varto.ErrTopicNotFound, v.PublishFrom(mockConnection, "topic2", []byte("data")))
+	})
+
+	t.Run("TestRateLimiter_WhenConnectionExceedsSubscribeLimit_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewRateLimiter(varto.RateLimitOptions{
+			SubscribePerConnection: varto.RateLimit{Rate: 1, Burst: 1},
+		}))
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		assert.Nil(t, v.Subscribe(mockConnection, "topic"))
+		assert.True(t, errors.Is(v.Subscribe(mockConnection, "topic2"), varto.ErrRateLimited))
+	})
+
+	t.Run("TestRateLimiter_WhenConnectionIsRemoved_ThenResetItsLimit", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewRateLimiter(varto.RateLimitOptions{
+			SubscribePerConnection: varto.RateLimit{Rate: 1, Burst: 1},
+		}))
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.AddConnection(mockConnection)
+		v.Subscribe(mockConnection, "topic")
+		v.RemoveConnection(mockConnection)
+
+		assert.Nil(t, v.Subscribe(mockConnection, "topic"))
+	})
+
+	t.Run("TestRateLimiter_WhenEmbeddedWithOverride_ThenCallOverride", func(t *testing.T) {
+		v := varto.New(nil)
+		limiter := &topicRateLimiter{RateLimiter: varto.NewRateLimiter(varto.RateLimitOptions{
+			PublishPerTopic: varto.RateLimit{Rate: 1, Burst: 2},
+		})}
+		v.Use(limiter)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		assert.Equal(t, varto.ErrTopicNotFound, v.PublishFrom(mockConnection, "topic", []byte("data")))
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic", []byte("data")))
+		assert.True(t, errors.Is(v.Publish("topic", []byte("data")), varto.ErrRateLimited))
+		assert.Equal(t, []string{"topic", "topic", "topic"}, limiter.topics)
+	})
+}
@@ -0,0 +1,7 @@
+package resp
+
+import "errors"
+
+var ErrProtocol = errors.New("protocol error")
+var ErrServerClosed = errors.New("resp server closed")
+var ErrPatternTooLong = errors.New("pattern too long")
@@ -0,0 +1,104 @@
+package resp
+
+import "strings"
+
+// matchPattern reports whether a channel matches a PSUBSCRIBE pattern. As with topic
+// patterns in varto, a pattern starting with a wildcard doesn't match channels starting with "$".
+func matchPattern(pattern string, channel string) bool {
+	if strings.HasPrefix(channel, "$") && pattern != "" && strings.IndexByte("*?[", pattern[0]) >= 0 {
+		return false
+	}
+
+	return matchGlob(pattern, channel)
+}
+
+// matchGlob matches a string against a Redis glob pattern, where "*" matches any sequence,
+// "?" matches one byte, "[...]" matches a set of bytes and "\" escapes the next byte.
+// Like stringmatchlen of Redis, it only backtracks to the last "*", so it takes
+// at most the product of the lengths of the pattern and the string.
+func matchGlob(pattern string, s string) bool {
+	p, i := 0, 0
+	star, starI := -1, 0
+
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				if p == len(pattern) {
+					return true
+				}
+
+				star, starI = p, i
+				continue
+			case '?':
+				p, i = p+1, i+1
+				continue
+			case '[':
+				matched, rest, ok := matchClass(pattern[p+1:], s[i])
+				if !ok {
+					return false
+				}
+
+				if matched {
+					p, i = len(pattern)-len(rest), i+1
+					continue
+				}
+			default:
+				c, n := pattern[p], 1
+				if c == '\\' && p+1 < len(pattern) {
+					c, n = pattern[p+1], 2
+				}
+
+				if s[i] == c {
+					p, i = p+n, i+1
+					continue
+				}
+			}
+		}
+
+		// The bytes since the last "*" don't match, so let it match one more byte and retry.
+		if star < 0 {
+			return false
+		}
+		starI++
+		p, i = star, starI
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// matchClass matches a byte against the set of a "[...]" pattern, given without the "[".
+// It returns the pattern after the closing "]", and false if there is none.
+func matchClass(pattern string, c byte) (bool, string, bool) {
+	negate := strings.HasPrefix(pattern, "^")
+	if negate {
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for {
+		switch {
+		case pattern == "":
+			return false, "", false
+		case pattern[0] == ']':
+			return matched != negate, pattern[1:], true
+		case pattern[0] == '\\' && len(pattern) > 1:
+			matched = matched || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := min(pattern[0], pattern[2]), max(pattern[0], pattern[2])
+			matched = matched || (c >= lo && c <= hi)
+			pattern = pattern[3:]
+		default:
+			matched = matched || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package resp implements a listener speaking the pub/sub subset of the Redis protocol (RESP),
+// so that redis-cli and Redis client libraries can be used as varto clients.
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxBulkSize is the maximum size of a command argument if Options.MaxBulkSize is zero.
+const DefaultMaxBulkSize = 1 << 20
+
+const maxArguments = 1 << 16
+
+// readCommand reads a command sent as an array of bulk strings, as Redis clients do,
+// or as an inline command, as typed in a telnet session. It returns no arguments for empty commands.
+func readCommand(r *bufio.Reader, maxBulkSize int) ([]string, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] != '*' {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(line), nil
+	}
+
+	n, err := readLength(r, '*')
+	if err != nil {
+		return nil, err
+	}
+
+	if n > maxArguments {
+		return nil, protocolError("invalid multibulk length")
+	}
+
+	args := make([]string, 0, min(max(n, 0), 16))
+	for i := 0; i < n; i++ {
+		size, err := readLength(r, '$')
+		if err != nil {
+			return nil, err
+		}
+
+		if size < 0 || size > maxBulkSize {
+			return nil, protocolError("invalid bulk length")
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, protocolError("expected CRLF after bulk string")
+		}
+
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+// readLength reads a line holding a length after a type prefix, such as "*2" or "$5".
+func readLength(r *bufio.Reader, prefix byte) (int, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(line) < 2 || line[0] != prefix {
+		return 0, protocolError(fmt.Sprintf("expected '%c'", prefix))
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return 0, protocolError("invalid length")
+	}
+
+	return n, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", protocolError("too big inline request")
+	}
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+
+	return string(line), nil
+}
+
+func protocolError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrProtocol, msg)
+}
+
+// unexpectedEOF turns io.EOF in the middle of a command into io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func appendArray(b []byte, n int) []byte {
+	b = append(b, '*')
+	b = strconv.AppendInt(b, int64(n), 10)
+	return append(b, "\r\n"...)
+}
+
+func appendBulk(b []byte, s string) []byte {
+	b = append(b, '$')
+	b = strconv.AppendInt(b, int64(len(s)), 10)
+	b = append(b, "\r\n"...)
+	b = append(b, s...)
+	return append(b, "\r\n"...)
+}
+
+func appendNull(b []byte) []byte {
+	return append(b, "$-1\r\n"...)
+}
+
+func appendInt(b []byte, n int) []byte {
+	b = append(b, ':')
+	b = strconv.AppendInt(b, int64(n), 10)
+	return append(b, "\r\n"...)
+}
+
+func appendSimple(b []byte, s string) []byte {
+	b = append(b, '+')
+	b = append(b, s...)
+	return append(b, "\r\n"...)
+}
+
+var lineBreaks = strings.NewReplacer("\r", " ", "\n", " ")
+
+func appendError(b []byte, msg string) []byte {
+	b = append(b, '-')
+	b = append(b, lineBreaks.Replace(msg)...)
+	return append(b, "\r\n"...)
+}
@@ -0,0 +1,304 @@
+package resp_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/resp"
+	"github.com/stretchr/testify/assert"
+)
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (c *client) send(args ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	_, err := c.conn.Write([]byte(b.String()))
+	assert.Nil(c.t, err)
+}
+
+// expect reads as many bytes as the expected reply has and compares them.
+func (c *client) expect(reply string) {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, len(reply))
+	if _, err := io.ReadFull(c.conn, buf); err != nil {
+		c.t.Fatalf("no reply received: %v", err)
+	}
+
+	assert.Equal(c.t, reply, string(buf))
+}
+
+func startServer(t *testing.T, v *varto.Varto, opts *resp.Options) func() *client {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	server := resp.NewServer(v, opts)
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+
+	return func() *client {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		assert.Nil(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		return &client{t: t, conn: conn}
+	}
+}
+
+func TestServer(t *testing.T) {
+	t.Run("TestServer_WhenClientSubscribes_ThenSendMessages", func(t *testing.T) {
+		v := varto.New(nil)
+		c := startServer(t, v, nil)()
+
+		c.send("SUBSCRIBE", "news", "sports")
+		c.expect("*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$6\r\nsports\r\n:2\r\n")
+
+		assert.Nil(t, v.Publish("news", []byte("hello")))
+		c.expect("*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+	})
+
+	t.Run("TestServer_WhenClientPublishes_ThenReplyWithReceivers", func(t *testing.T) {
+		v := varto.New(nil)
+		dial := startServer(t, v, nil)
+		subscriber, pattern, publisher := dial(), dial(), dial()
+		subscriber.send("SUBSCRIBE", "news")
+		subscriber.expect("*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+		pattern.send("PSUBSCRIBE", "n*")
+		pattern.expect("*3\r\n$10\r\npsubscribe\r\n$2\r\nn*\r\n:1\r\n")
+
+		publisher.send("PUBLISH", "news", "hello")
+		publisher.expect(":2\r\n")
+		subscriber.expect("*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+		pattern.expect("*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+
+		publisher.send("PUBLISH", "nobody", "hello")
+		publisher.expect(":1\r\n")
+		publisher.send("PUBLISH", "other", "hello")
+		publisher.expect(":0\r\n")
+	})
+
+	t.Run("TestServer_WhenPatternUsesGlobSyntax_ThenMatchChannels", func(t *testing.T) {
+		v := varto.New(nil)
+		c := startServer(t, v, nil)()
+		c.send("PSUBSCRIBE", "h?llo.[a-c]\\*")
+		c.expect("*3\r\n$10\r\npsubscribe\r\n$13\r\nh?llo.[a-c]\\*\r\n:1\r\n")
+
+		v.Publish("hello.d*", []byte("no"))
+		v.Publish("hallo.b", []byte("no"))
+		v.Publish("hallo.b*", []byte("yes"))
+
+		c.expect("*4\r\n$8\r\npmessage\r\n$13\r\nh?llo.[a-c]\\*\r\n$8\r\nhallo.b*\r\n$3\r\nyes\r\n")
+	})
+
+	t.Run("TestServer_WhenClientUnsubscribesFromAll_ThenConfirmEachChannel", func(t *testing.T) {
+		v := varto.New(nil)
+		c := startServer(t, v, nil)()
+		c.send("SUBSCRIBE", "b", "a")
+		c.expect("*3\r\n$9\r\nsubscribe\r\n$1\r\nb\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:2\r\n")
+
+		c.send("UNSUBSCRIBE")
+		c.expect("*3\r\n$11\r\nunsubscribe\r\n$1\r\na\r\n:1\r\n*3\r\n$11\r\nunsubscribe\r\n$1\r\nb\r\n:0\r\n")
+		c.send("UNSUBSCRIBE")
+		c.expect("*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n")
+
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("a", []byte("data")))
+		c.send("PING")
+		c.expect("+PONG\r\n")
+	})
+
+	t.Run("TestServer_WhenClientIsSubscribed_ThenOnlyAllowPubSubCommands", func(t *testing.T) {
+		v := varto.New(nil)
+		c := startServer(t, v, nil)()
+		c.send("SUBSCRIBE", "a")
+		c.expect("*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n")
+
+		c.send("PUBLISH", "a", "data")
+		c.expect("-ERR Can't execute 'publish': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context\r\n")
+		c.send("PING")
+		c.expect("*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+	})
+
+	t.Run("TestServer_WhenSubscribeIsRejected_ThenReplyWithError", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.OnSubscribeFunc(func(conn varto.Connection, topic string) error {
+			return varto.ErrAccessDenied
+		}))
+		c := startServer(t, v, &resp.Options{
+			AuthorizePattern: func(conn varto.Connection, pattern string) error {
+				return varto.ErrAccessDenied
+			},
+		})()
+
+		c.send("SUBSCRIBE", "a")
+		c.expect("-ERR access denied\r\n")
+		c.send("PSUBSCRIBE", "*")
+		c.expect("-ERR access denied\r\n")
+	})
+
+	t.Run("TestServer_WhenCommandIsInline_ThenExecuteIt", func(t *testing.T) {
+		v := varto.New(nil)
+		c := startServer(t, v, nil)()
+
+		c.conn.Write([]byte("ping hello\r\nFOO\r\n"))
+
+		c.expect("$5\r\nhello\r\n-ERR unknown command 'foo'\r\n")
+	})
+
+	t.Run("TestServer_WhenClientQuits_ThenRemoveConnection", func(t *testing.T) {
+		v := varto.New(nil)
+		c := startServer(t, v, nil)()
+		c.send("SUBSCRIBE", "a")
+		c.expect("*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n")
+
+		c.send("QUIT")
+		c.expect("+OK\r\n")
+		time.Sleep(10 * time.Millisecond)
+
+		stats, _ := v.Stats()
+		assert.Equal(t, varto.Stats{}, stats)
+	})
+
+	t.Run("TestServer_WhenBulkLengthIsInvalid_ThenReplyWithProtocolError", func(t *testing.T) {
+		v := varto.New(nil)
+		c := startServer(t, v, &resp.Options{MaxBulkSize: 4})()
+
+		c.send("PUBLISH", "channel", "data")
+
+		c.expect("-ERR protocol error: invalid bulk length\r\n")
+	})
+
+	t.Run("TestServer_WhenPatternStartsWithWildcard_ThenDontMatchDollarChannels", func(t *testing.T) {
+		v := varto.New(nil)
+		c := startServer(t, v, nil)()
+		c.send("PSUBSCRIBE", "*", "$*")
+		c.expect("*3\r\n$10\r\npsubscribe\r\n$1\r\n*\r\n:1\r\n*3\r\n$10\r\npsubscribe\r\n$2\r\n$*\r\n:2\r\n")
+
+		v.Publish("$internal", []byte("data"))
+
+		c.expect("*4\r\n$8\r\npmessage\r\n$2\r\n$*\r\n$9\r\n$internal\r\n$4\r\ndata\r\n")
+		c.send("PING")
+		c.expect("*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+	})
+	t.Run("TestServer_WhenPatternBacktracksALot_ThenMatchQuickly", func(t *testing.T) {
+		v := varto.New(nil)
+		dial := startServer(t, v, nil)
+		subscriber, publisher := dial(), dial()
+		pattern := strings.Repeat("a*", 30) + "b"
+		subscriber.send("PSUBSCRIBE", pattern)
+		subscriber.expect(fmt.Sprintf("*3\r\n$10\r\npsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(pattern), pattern))
+
+		publisher.send("PUBLISH", strings.Repeat("a", 100), "data")
+		publisher.expect(":0\r\n")
+	})
+
+	t.Run("TestServer_WhenPatternIsTooLong_ThenReplyWithError", func(t *testing.T) {
+		v := varto.New(nil)
+		c := startServer(t, v, &resp.Options{MaxPatternLength: 3})()
+
+		c.send("PSUBSCRIBE", "abcd")
+		c.expect("-ERR pattern too long\r\n")
+	})
+
+	t.Run("TestServer_WhenChannelIsDenied_ThenDontDeliverItToPatterns", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.NewACL(v, varto.ACLOptions{
+			Rules: []varto.ACLRule{{Action: varto.ACLSubscribe, Topic: "private", Deny: true}},
+		}))
+		dial := startServer(t, v, nil)
+		subscriber, publisher := dial(), dial()
+		subscriber.send("PSUBSCRIBE", "p*")
+		subscriber.expect("*3\r\n$10\r\npsubscribe\r\n$2\r\np*\r\n:1\r\n")
+
+		publisher.send("PUBLISH", "private", "secret")
+		publisher.expect(":0\r\n")
+		publisher.send("PUBLISH", "public", "news")
+		publisher.expect(":1\r\n")
+
+		subscriber.expect("*4\r\n$8\r\npmessage\r\n$2\r\np*\r\n$6\r\npublic\r\n$4\r\nnews\r\n")
+	})
+
+	t.Run("TestServer_WhenMessagesArePublished_ThenDeliverThemToPatternsInOrder", func(t *testing.T) {
+		v := varto.New(nil)
+		dial := startServer(t, v, nil)
+		subscriber, publisher := dial(), dial()
+		subscriber.send("PSUBSCRIBE", "*")
+		subscriber.expect("*3\r\n$10\r\npsubscribe\r\n$1\r\n*\r\n:1\r\n")
+
+		for i := range 100 {
+			publisher.send("PUBLISH", "channel", fmt.Sprintf("%03d", i))
+			publisher.expect(":1\r\n")
+		}
+
+		for i := range 100 {
+			subscriber.expect(fmt.Sprintf("*4\r\n$8\r\npmessage\r\n$1\r\n*\r\n$7\r\nchannel\r\n$3\r\n%03d\r\n", i))
+		}
+	})
+
+	t.Run("TestServer_WhenPatternMatchesPresenceChannel_ThenSendPresenceEvents", func(t *testing.T) {
+		v := varto.New(&varto.Options{PresenceEvents: true})
+		dial := startServer(t, v, nil)
+		watcher, member := dial(), dial()
+		watcher.send("PSUBSCRIBE", "presence/*")
+		watcher.expect("*3\r\n$10\r\npsubscribe\r\n$10\r\npresence/*\r\n:1\r\n")
+
+		member.send("SUBSCRIBE", "room")
+		member.expect("*3\r\n$9\r\nsubscribe\r\n$4\r\nroom\r\n:1\r\n")
+
+		event := `{"type":"join","topic":"room","connectionId":"resp:2"}`
+		watcher.expect(fmt.Sprintf("*4\r\n$8\r\npmessage\r\n$10\r\npresence/*\r\n$13\r\npresence/room\r\n$%d\r\n%s\r\n", len(event), event))
+	})
+
+	t.Run("TestServer_WhenPatternMatchesSystemChannel_ThenSendSystemEvents", func(t *testing.T) {
+		v := varto.New(&varto.Options{SystemEvents: true})
+		dial := startServer(t, v, nil)
+		watcher := dial()
+		watcher.send("PSUBSCRIBE", "$SYS/connections/*")
+		watcher.expect("*3\r\n$10\r\npsubscribe\r\n$18\r\n$SYS/connections/*\r\n:1\r\n")
+
+		dial().send("PING")
+
+		event := `{"connectionId":"resp:2"}`
+		watcher.expect(fmt.Sprintf("*4\r\n$8\r\npmessage\r\n$18\r\n$SYS/connections/*\r\n$22\r\n$SYS/connections/added\r\n$%d\r\n%s\r\n", len(event), event))
+	})
+
+	t.Run("TestServer_WhenTrackedClientSendsCommands_ThenKeepItUntilIdle", func(t *testing.T) {
+		v := varto.New(nil)
+		h := varto.NewHeartbeat(v, &varto.HeartbeatOptions{Interval: 10 * time.Millisecond, IdleTimeout: 100 * time.Millisecond})
+		defer h.Stop()
+		dial := startServer(t, v, &resp.Options{Wrap: h.Track})
+		pattern, publisher := dial(), dial()
+		pattern.send("PSUBSCRIBE", "n*")
+		pattern.expect("*3\r\n$10\r\npsubscribe\r\n$2\r\nn*\r\n:1\r\n")
+
+		for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+			time.Sleep(10 * time.Millisecond)
+			publisher.send("PUBLISH", "news", "hello")
+			publisher.expect(":1\r\n")
+			pattern.expect("*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+			pattern.send("PING")
+			pattern.expect("*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+		}
+
+		// Once the commands stop, the subscriber is idle and closed.
+		buf := make([]byte, 64)
+		for {
+			pattern.conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := pattern.conn.Read(buf); err != nil {
+				assert.ErrorIs(t, err, io.EOF)
+				break
+			}
+		}
+	})
+}
@@ -0,0 +1,276 @@
+package resp
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/metinorak/varto"
+)
+
+// DefaultMaxPatternLength is the maximum length of a PSUBSCRIBE pattern if Options.MaxPatternLength is zero.
+const DefaultMaxPatternLength = 256
+
+// Options configures a RESP server.
+type Options struct {
+	// AuthorizePattern checks a PSUBSCRIBE pattern. Patterns are kept by the server, not by varto.
+	// The client is subscribed in varto to each channel matching one of its patterns, when the pattern
+	// is subscribed to or the channel first appears, so each channel still goes through the OnSubscribe
+	// hooks of the middleware once. Channels that are rejected are not delivered to the patterns.
+	// If it returns an error, the client gets it as an error reply.
+	// If it is nil, every pattern is allowed.
+	AuthorizePattern func(conn varto.Connection, pattern string) error
+
+	// MaxPatternLength is the maximum length of a PSUBSCRIBE pattern.
+	// If it is zero, DefaultMaxPatternLength is used.
+	MaxPatternLength int
+
+	// MaxBulkSize is the maximum size of a command argument.
+	// If it is zero, DefaultMaxBulkSize is used.
+	MaxBulkSize int
+
+	// BroadcastChannel is the channel of the messages sent for Varto.BroadcastToAll.
+	// If it is empty, broadcasts are not sent to RESP clients.
+	BroadcastChannel string
+
+	// Wrap returns the connection added to the Varto in place of a session, such as Heartbeat.Track.
+	// Received commands are recorded as activity with varto.Touch.
+	Wrap func(conn varto.Connection) varto.Connection
+}
+
+// Server serves Redis clients. It supports SUBSCRIBE, UNSUBSCRIBE, PSUBSCRIBE, PUNSUBSCRIBE,
+// PUBLISH, PING and QUIT. Every client is a varto connection, so its channel subscriptions
+// and publishes go through the middleware of the Varto.
+type Server struct {
+	v      *varto.Varto
+	opts   Options
+	handle *varto.MiddlewareHandle
+
+	mu        sync.Mutex
+	sessions  map[*session]bool
+	byId      map[string]*session
+	listeners map[net.Listener]bool
+	closed    bool
+
+	lastId atomic.Uint64
+}
+
+// NewServer returns a server publishing to and subscribing on v.
+// It adds a middleware to v that subscribes pattern subscriptions to the channels that appear;
+// the middleware is removed by Close.
+func NewServer(v *varto.Varto, opts *Options) *Server {
+	s := &Server{
+		v:         v,
+		sessions:  make(map[*session]bool),
+		byId:      make(map[string]*session),
+		listeners: make(map[net.Listener]bool),
+	}
+
+	if opts != nil {
+		s.opts = *opts
+	}
+
+	if s.opts.MaxBulkSize == 0 {
+		s.opts.MaxBulkSize = DefaultMaxBulkSize
+	}
+
+	if s.opts.MaxPatternLength == 0 {
+		s.opts.MaxPatternLength = DefaultMaxPatternLength
+	}
+
+	s.handle = v.Use(&patternDelivery{server: s})
+	return s
+}
+
+// Serve accepts connections until the listener or the server is closed,
+// and then returns ErrServerClosed.
+func (s *Server) Serve(ln net.Listener) error {
+	if !s.trackListener(ln) {
+		ln.Close()
+		return ErrServerClosed
+	}
+	defer s.untrackListener(ln)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() || errors.Is(err, net.ErrClosed) {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a client until it quits, and then closes the connection.
+// It returns nil if the client sends QUIT or closes the connection.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+
+	sess := newSession(s, conn, "resp:"+strconv.FormatUint(s.lastId.Add(1), 10))
+	if !s.track(sess) {
+		return ErrServerClosed
+	}
+	defer s.untrack(sess)
+
+	return sess.serve()
+}
+
+// Close stops the listeners, closes the open connections and removes the middleware of the server.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	listeners := make([]net.Listener, 0, len(s.listeners))
+	for ln := range s.listeners {
+		listeners = append(listeners, ln)
+	}
+	sessions := make([]*session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+
+	s.handle.Remove()
+
+	var err error
+	for _, ln := range listeners {
+		if lnErr := ln.Close(); err == nil {
+			err = lnErr
+		}
+	}
+
+	for _, sess := range sessions {
+		sess.conn.Close()
+	}
+
+	return err
+}
+
+// patternDelivery is the middleware subscribing pattern subscriptions to the channels that appear,
+// and counting the receivers of the PUBLISH commands of clients.
+type patternDelivery struct {
+	varto.BaseMiddleware
+	server *Server
+}
+
+// OnPublish subscribes the matching pattern subscriptions to a channel without subscribers
+// before the message is delivered to it. The pattern subscriptions of channels with subscribers
+// were subscribed when the channel appeared.
+func (p *patternDelivery) OnPublish(topic string, data []byte) error {
+	if len(p.server.v.Subscribers(topic)) == 0 {
+		p.server.offer(topic)
+	}
+	return nil
+}
+
+// OnSubscribe subscribes the matching pattern subscriptions to the presence channel of a channel,
+// before the join of the subscriber is published to it.
+func (p *patternDelivery) OnSubscribe(conn varto.Connection, topic string) error {
+	if !strings.HasPrefix(topic, varto.PresenceTopicPrefix) {
+		p.server.offer(varto.PresenceTopicPrefix + topic)
+	}
+	return nil
+}
+
+// AfterSubscribe subscribes the matching pattern subscriptions to a channel once it has subscribers.
+func (p *patternDelivery) AfterSubscribe(conn varto.Connection, topic string, err error) {
+	if err == nil {
+		p.server.offer(topic)
+	}
+}
+
+// AfterPublish sets the number of receivers of a PUBLISH of a client. Like in Redis, a client
+// receives a message once for its subscription to the channel and once for each matching pattern.
+func (p *patternDelivery) AfterPublish(report varto.PublishReport) {
+	publisher := p.server.sessionOf(report.Connection)
+	if publisher == nil || report.Err != nil {
+		return
+	}
+
+	receivers := report.Recipients
+	for _, conn := range p.server.v.Subscribers(report.Topic) {
+		if sess := p.server.sessionOf(conn); sess != nil {
+			receivers += sess.receiversOf(report.Topic) - 1
+		}
+	}
+
+	publisher.published = receivers
+}
+
+// offer subscribes the sessions with a pattern matching a channel to it.
+func (s *Server) offer(channel string) {
+	s.mu.Lock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+
+	for _, sess := range sessions {
+		sess.offer(channel)
+	}
+}
+
+// sessionOf returns the session of a varto connection, or nil if it is not a session of the server.
+func (s *Server) sessionOf(conn varto.Connection) *session {
+	if conn == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.byId[conn.GetId()]
+}
+
+func (s *Server) track(sess *session) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.sessions[sess] = true
+	s.byId[sess.id] = sess
+	return true
+}
+
+func (s *Server) untrack(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sess)
+	delete(s.byId, sess.id)
+}
+
+func (s *Server) trackListener(ln net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.listeners[ln] = true
+	return true
+}
+
+func (s *Server) untrackListener(ln net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.listeners, ln)
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
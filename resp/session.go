@@ -0,0 +1,510 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/metinorak/varto"
+)
+
+var errQuit = errors.New("resp client quit")
+
+// systemChannels are the system topics of varto. Patterns are subscribed to the ones they match
+// when they are subscribed to, since system topics don't appear through subscriptions or publishes.
+var systemChannels = []string{
+	varto.SystemTopicConnectionAdded,
+	varto.SystemTopicConnectionRemoved,
+	varto.SystemTopicTopicCreated,
+	varto.SystemTopicTopicRemoved,
+	varto.SystemTopicDeliveryError,
+}
+
+// session is the varto connection of a Redis client.
+type session struct {
+	server *Server
+	conn   net.Conn
+	reader *bufio.Reader
+	id     string
+	done   chan struct{}
+
+	// wrapped is the connection of the session in the Varto: the session, or the connection
+	// Options.Wrap returned for it.
+	wrapped varto.Connection
+
+	// published is the number of receivers of the last PUBLISH of the client.
+	// It is set by the middleware of the server, on the goroutine of the publish.
+	published int
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	channels map[string]bool
+	patterns map[string]bool
+	// matched holds the channels matching the patterns: true if the client is subscribed
+	// to them in varto, false if the subscription was rejected.
+	matched map[string]bool
+	closed  bool
+}
+
+func newSession(server *Server, conn net.Conn, id string) *session {
+	s := &session{
+		server:   server,
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		id:       id,
+		done:     make(chan struct{}),
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+		matched:  make(map[string]bool),
+	}
+
+	s.wrapped = s
+	if wrap := server.opts.Wrap; wrap != nil {
+		s.wrapped = wrap(s)
+	}
+
+	return s
+}
+
+func (s *session) GetId() string {
+	return s.id
+}
+
+// Close closes the network connection of the client, which ends the session.
+func (s *session) Close() error {
+	return s.conn.Close()
+}
+
+// Read blocks until the session is finished, since the commands of the client are read by serve.
+func (s *session) Read() ([]byte, error) {
+	<-s.done
+	return nil, io.EOF
+}
+
+// Write sends a broadcast to the client as a message on Options.BroadcastChannel.
+func (s *session) Write(data []byte) error {
+	if s.server.opts.BroadcastChannel == "" {
+		return nil
+	}
+
+	return s.writeMessage(s.server.opts.BroadcastChannel, data)
+}
+
+// WriteMessage sends a message of a channel once for the subscription to the channel
+// and once for each matching pattern.
+func (s *session) WriteMessage(msg varto.Message) error {
+	s.mu.Lock()
+	channel := s.channels[msg.Topic]
+	var patterns []string
+	if s.matched[msg.Topic] {
+		patterns = s.patternsMatching(msg.Topic)
+	}
+	s.mu.Unlock()
+
+	if channel {
+		if err := s.writeMessage(msg.Topic, msg.Data); err != nil {
+			return err
+		}
+	}
+
+	for _, pattern := range patterns {
+		if err := s.writePatternMessage(pattern, msg.Topic, msg.Data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *session) serve() error {
+	defer close(s.done)
+
+	if err := s.server.v.AddConnection(s.wrapped); err != nil {
+		s.write(appendError(nil, errorMessage(err)))
+		return err
+	}
+	defer s.finish()
+
+	for {
+		args, err := readCommand(s.reader, s.server.opts.MaxBulkSize)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			if errors.Is(err, ErrProtocol) {
+				s.write(appendError(nil, errorMessage(err)))
+			}
+			return err
+		}
+
+		varto.Touch(s.wrapped)
+		if len(args) == 0 {
+			continue
+		}
+
+		if err := s.handle(args); err != nil {
+			if err == errQuit {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (s *session) handle(args []string) error {
+	name := strings.ToLower(args[0])
+	args = args[1:]
+
+	if s.subscribed() && !allowedWhenSubscribed(name) {
+		return s.write(appendError(nil, "ERR Can't execute '"+name+"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context"))
+	}
+
+	switch name {
+	case "subscribe", "psubscribe":
+		if len(args) == 0 {
+			return s.write(wrongArguments(name))
+		}
+		return s.write(s.subscribe(name, args))
+	case "unsubscribe", "punsubscribe":
+		return s.write(s.unsubscribe(name, args))
+	case "publish":
+		if len(args) != 2 {
+			return s.write(wrongArguments(name))
+		}
+		return s.write(s.publish(args[0], args[1]))
+	case "ping":
+		if len(args) > 1 {
+			return s.write(wrongArguments(name))
+		}
+		return s.write(s.ping(args))
+	case "quit":
+		s.write(appendSimple(nil, "OK"))
+		return errQuit
+	default:
+		return s.write(appendError(nil, "ERR unknown command '"+name+"'"))
+	}
+}
+
+// subscribe subscribes to channels or patterns and confirms each of them with
+// the number of subscriptions of the client. A subscription that is rejected gets an error reply.
+func (s *session) subscribe(kind string, names []string) []byte {
+	var reply []byte
+
+	for _, name := range names {
+		var err error
+		if kind == "psubscribe" {
+			err = s.subscribePattern(name)
+		} else {
+			err = s.subscribeChannel(name)
+		}
+
+		if err != nil {
+			reply = appendError(reply, errorMessage(err))
+			continue
+		}
+
+		reply = appendArray(reply, 3)
+		reply = appendBulk(reply, kind)
+		reply = appendBulk(reply, name)
+		reply = appendInt(reply, s.subscriptionCount())
+	}
+
+	return reply
+}
+
+// subscribeChannel subscribes to a channel. It is marked as subscribed first,
+// so that the messages delivered as soon as varto subscribed the client are written.
+func (s *session) subscribeChannel(channel string) error {
+	s.mu.Lock()
+	subscribed := s.channels[channel]
+	s.channels[channel] = true
+	s.mu.Unlock()
+
+	err := s.server.v.Subscribe(s.wrapped, channel)
+	if err != nil && !subscribed {
+		s.mu.Lock()
+		delete(s.channels, channel)
+		s.mu.Unlock()
+	}
+
+	return err
+}
+
+func (s *session) subscribePattern(pattern string) error {
+	if len(pattern) > s.server.opts.MaxPatternLength {
+		return ErrPatternTooLong
+	}
+
+	if authorize := s.server.opts.AuthorizePattern; authorize != nil {
+		if err := authorize(s.wrapped, pattern); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.patterns[pattern] = true
+	s.mu.Unlock()
+
+	for _, channel := range append(s.server.v.Topics(), systemChannels...) {
+		s.offer(channel)
+	}
+
+	return nil
+}
+
+// offer subscribes the client to a channel matching one of its patterns, unless the channel
+// has been offered before. The subscription goes through the middleware of varto once.
+func (s *session) offer(channel string) {
+	s.mu.Lock()
+	if _, ok := s.matched[channel]; ok || s.closed || !s.matchesPattern(channel) {
+		s.mu.Unlock()
+		return
+	}
+	s.matched[channel] = true
+	subscribed := s.channels[channel]
+	s.mu.Unlock()
+
+	if subscribed {
+		return
+	}
+
+	if err := s.server.v.Subscribe(s.wrapped, channel); err != nil {
+		s.mu.Lock()
+		if _, ok := s.matched[channel]; ok {
+			s.matched[channel] = false
+		}
+		s.mu.Unlock()
+		return
+	}
+
+	// The session may have been removed from varto meanwhile, which the subscription would outlive.
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		s.server.v.Unsubscribe(s.wrapped, channel)
+	}
+}
+
+// unsubscribePattern removes a pattern and returns the channels the client is not subscribed to anymore.
+func (s *session) unsubscribePattern(pattern string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.patterns, pattern)
+
+	var channels []string
+	for channel, subscribed := range s.matched {
+		if s.matchesPattern(channel) {
+			continue
+		}
+
+		delete(s.matched, channel)
+		if subscribed && !s.channels[channel] {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
+
+// unsubscribe unsubscribes from channels or patterns, or from all of them if names is empty,
+// and confirms each of them with the number of subscriptions left.
+func (s *session) unsubscribe(kind string, names []string) []byte {
+	patterns := kind == "punsubscribe"
+
+	if len(names) == 0 {
+		s.mu.Lock()
+		if patterns {
+			names = sortedKeys(s.patterns)
+		} else {
+			names = sortedKeys(s.channels)
+		}
+		s.mu.Unlock()
+	}
+
+	if len(names) == 0 {
+		reply := appendArray(nil, 3)
+		reply = appendBulk(reply, kind)
+		reply = appendNull(reply)
+		return appendInt(reply, s.subscriptionCount())
+	}
+
+	var reply []byte
+	for _, name := range names {
+		if patterns {
+			for _, channel := range s.unsubscribePattern(name) {
+				s.server.v.Unsubscribe(s.wrapped, channel)
+			}
+		} else {
+			// The client stays subscribed in varto to a channel matching one of its patterns.
+			s.mu.Lock()
+			delete(s.channels, name)
+			matched := s.matched[name]
+			s.mu.Unlock()
+
+			if !matched {
+				s.server.v.Unsubscribe(s.wrapped, name)
+			}
+		}
+
+		reply = appendArray(reply, 3)
+		reply = appendBulk(reply, kind)
+		reply = appendBulk(reply, name)
+		reply = appendInt(reply, s.subscriptionCount())
+	}
+
+	return reply
+}
+
+// publish publishes a message and replies with the number of receivers.
+// A channel without subscribers is not an error.
+func (s *session) publish(channel string, data string) []byte {
+	s.published = 0
+
+	err := s.server.v.PublishMessageFrom(s.wrapped, varto.Message{Topic: channel, Data: []byte(data)})
+	if err != nil && !errors.Is(err, varto.ErrTopicNotFound) {
+		return appendError(nil, errorMessage(err))
+	}
+
+	return appendInt(nil, s.published)
+}
+
+// ping replies with PONG, or with its argument. Subscribed clients get a pong message instead.
+func (s *session) ping(args []string) []byte {
+	if s.subscribed() {
+		reply := appendArray(nil, 2)
+		reply = appendBulk(reply, "pong")
+		if len(args) == 0 {
+			return appendBulk(reply, "")
+		}
+		return appendBulk(reply, args[0])
+	}
+
+	if len(args) == 0 {
+		return appendSimple(nil, "PONG")
+	}
+	return appendBulk(nil, args[0])
+}
+
+func (s *session) writeMessage(channel string, data []byte) error {
+	reply := appendArray(nil, 3)
+	reply = appendBulk(reply, "message")
+	reply = appendBulk(reply, channel)
+	reply = appendBulk(reply, string(data))
+	return s.write(reply)
+}
+
+func (s *session) writePatternMessage(pattern string, channel string, data []byte) error {
+	reply := appendArray(nil, 4)
+	reply = appendBulk(reply, "pmessage")
+	reply = appendBulk(reply, pattern)
+	reply = appendBulk(reply, channel)
+	reply = appendBulk(reply, string(data))
+	return s.write(reply)
+}
+
+func (s *session) write(reply []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	_, err := s.conn.Write(reply)
+	return err
+}
+
+// finish removes the session from varto. Channels are not offered to it anymore.
+func (s *session) finish() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	s.server.v.RemoveConnection(s.wrapped)
+}
+
+// receiversOf returns the number of times the client receives a message of a channel.
+func (s *session) receiversOf(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receivers := 0
+	if s.channels[channel] {
+		receivers++
+	}
+
+	if s.matched[channel] {
+		receivers += len(s.patternsMatching(channel))
+	}
+
+	return max(receivers, 1)
+}
+
+// matchesPattern reports whether a channel matches one of the patterns of the client.
+// The caller must hold the lock.
+func (s *session) matchesPattern(channel string) bool {
+	for pattern := range s.patterns {
+		if matchPattern(pattern, channel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// patternsMatching returns the patterns of the client matching a channel.
+// The caller must hold the lock.
+func (s *session) patternsMatching(channel string) []string {
+	var patterns []string
+	for pattern := range s.patterns {
+		if matchPattern(pattern, channel) {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	slices.Sort(patterns)
+	return patterns
+}
+
+func (s *session) subscriptionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.channels) + len(s.patterns)
+}
+
+func (s *session) subscribed() bool {
+	return s.subscriptionCount() > 0
+}
+
+func allowedWhenSubscribed(name string) bool {
+	switch name {
+	case "subscribe", "psubscribe", "unsubscribe", "punsubscribe", "ping", "quit":
+		return true
+	default:
+		return false
+	}
+}
+
+func wrongArguments(name string) []byte {
+	return appendError(nil, "ERR wrong number of arguments for '"+name+"' command")
+}
+
+// errorMessage formats an error as the message of an error reply, which starts with an error code.
+func errorMessage(err error) string {
+	return "ERR " + err.Error()
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,89 @@
+package varto
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Actions of the commands Serve reads from a connection.
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+	ActionPublish     = "publish"
+	ActionBroadcast   = "broadcast"
+)
+
+// Command is a JSON command read from a connection by Serve.
+type Command struct {
+	Action  string            `json:"action"`
+	Topic   string            `json:"topic,omitempty"`
+	Data    string            `json:"data,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// CommandError is written back to a connection by Serve when a command fails.
+type CommandError struct {
+	Action string `json:"action,omitempty"`
+	Topic  string `json:"topic,omitempty"`
+	Error  string `json:"error"`
+}
+
+// Serve adds a connection, runs the commands read from it until Read fails,
+// and removes the connection again.
+// Commands that fail are answered with a CommandError, and the connection is kept.
+// It returns nil if Read returns io.EOF.
+func (v *Varto) Serve(conn Connection) error {
+	if conn == nil {
+		return ErrNilConnection
+	}
+
+	if err := v.AddConnection(conn); err != nil {
+		return err
+	}
+	defer v.RemoveConnection(conn)
+
+	for {
+		data, err := conn.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var cmd Command
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			conn.Write(encodeCommandError(cmd, ErrInvalidCommand))
+		} else if err := v.runCommand(conn, cmd); err != nil {
+			conn.Write(encodeCommandError(cmd, err))
+		}
+	}
+}
+
+func (v *Varto) runCommand(conn Connection, cmd Command) error {
+	switch cmd.Action {
+	case ActionSubscribe:
+		return v.Subscribe(conn, cmd.Topic)
+	case ActionUnsubscribe:
+		return v.Unsubscribe(conn, cmd.Topic)
+	case ActionPublish:
+		return v.PublishMessageFrom(conn, Message{Topic: cmd.Topic, Data: []byte(cmd.Data), Headers: cmd.Headers})
+	case ActionBroadcast:
+		if !v.opts.ServeBroadcast {
+			return ErrAccessDenied
+		}
+		return v.BroadcastToAllFrom(conn, []byte(cmd.Data))
+	default:
+		return ErrInvalidCommand
+	}
+}
+
+func encodeCommandError(cmd Command, err error) []byte {
+	data, _ := json.Marshal(CommandError{
+		Action: cmd.Action,
+		Topic:  cmd.Topic,
+		Error:  err.Error(),
+	})
+
+	return data
+}
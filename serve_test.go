@@ -0,0 +1,82 @@
+package varto_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestServe(t *testing.T) {
+	t.Run("TestServe_WhenReadReturnsEOF_ThenRemoveConnectionAndReturnNil", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		gomock.InOrder(
+			mockConnection.EXPECT().Read().Return([]byte(`{"action":"subscribe","topic":"topic"}`), nil),
+			mockConnection.EXPECT().Read().Return(nil, io.EOF),
+		)
+
+		err := v.Serve(mockConnection)
+		assert.Nil(t, err)
+
+		stats, _ := v.Stats()
+		assert.Equal(t, varto.Stats{}, stats)
+	})
+
+	t.Run("TestServe_WhenCommandIsInvalid_ThenWriteError", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		gomock.InOrder(
+			mockConnection.EXPECT().Read().Return([]byte(`not json`), nil),
+			mockConnection.EXPECT().Read().Return([]byte(`{"action":"unknown"}`), nil),
+			mockConnection.EXPECT().Read().Return(nil, fmt.Errorf("error")),
+		)
+		mockConnection.EXPECT().Write([]byte(`{"error":"invalid command"}`)).Return(nil)
+		mockConnection.EXPECT().Write([]byte(`{"action":"unknown","error":"invalid command"}`)).Return(nil)
+
+		err := v.Serve(mockConnection)
+		assert.EqualError(t, err, "error")
+	})
+	t.Run("TestServe_WhenBroadcastIsDisabled_ThenWriteError", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		gomock.InOrder(
+			mockConnection.EXPECT().Read().Return([]byte(`{"action":"broadcast","data":"data"}`), nil),
+			mockConnection.EXPECT().Read().Return(nil, io.EOF),
+		)
+		mockConnection.EXPECT().Write([]byte(`{"action":"broadcast","error":"access denied"}`)).Return(nil)
+
+		assert.Nil(t, v.Serve(mockConnection))
+	})
+
+	t.Run("TestServe_WhenBroadcastIsEnabled_ThenCheckACL", func(t *testing.T) {
+		v := varto.New(&varto.Options{ServeBroadcast: true})
+		v.Use(varto.NewACL(v, varto.ACLOptions{
+			DenyByDefault: true,
+			Rules:         []varto.ACLRule{{Action: varto.ACLBroadcast, Attrs: map[string]any{"role": "admin"}}},
+		}))
+		admin := mock.NewMockConnection(gomock.NewController(t))
+		admin.EXPECT().GetId().Return("admin").AnyTimes()
+		user := mock.NewMockConnection(gomock.NewController(t))
+		user.EXPECT().GetId().Return("user").AnyTimes()
+		v.SetAttr(admin, "role", "admin")
+		v.AddConnection(admin)
+
+		gomock.InOrder(
+			user.EXPECT().Read().Return([]byte(`{"action":"broadcast","data":"data"}`), nil),
+			user.EXPECT().Write([]byte(`{"action":"broadcast","error":"access denied"}`)).Return(nil),
+			user.EXPECT().Read().Return(nil, io.EOF),
+		)
+		assert.Nil(t, v.Serve(user))
+
+		admin.EXPECT().Write([]byte("data")).Return(nil)
+		assert.Nil(t, v.BroadcastToAllFrom(admin, []byte("data")))
+	})
+}
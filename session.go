@@ -0,0 +1,319 @@
+package varto
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SessionOwnerAttr is the connection attribute that identifies the owner of a session, such as a user id.
+// A session can only be resumed by a connection with the same owner as the connection that started it.
+const SessionOwnerAttr = "user"
+
+// session keeps the subscriptions of a client across reconnects.
+type session struct {
+	id     string
+	owner  any
+	conn   Connection
+	topics []string
+	queue  *sessionQueue
+	timer  *time.Timer
+}
+
+type sessionManager struct {
+	sync.Mutex
+	expiry    time.Duration
+	queueSize int
+	sessions  map[string]*session
+	byConn    map[string]*session
+}
+
+func newSessionManager(expiry time.Duration, queueSize int) *sessionManager {
+	return &sessionManager{
+		expiry:    expiry,
+		queueSize: queueSize,
+		sessions:  make(map[string]*session),
+		byConn:    make(map[string]*session),
+	}
+}
+
+// ResumeSession binds a connection to the session with the given id.
+// If the session was disconnected and has not expired yet, its subscriptions
+// are restored to the connection and any queued messages are written to it,
+// and true is returned. Otherwise a new session is started for the connection.
+//
+// A session can only be resumed by a connection with the same SessionOwnerAttr attribute,
+// and only if the connection may subscribe to all of its topics. Otherwise an error is returned
+// and the session stays disconnected.
+func (v *Varto) ResumeSession(conn Connection, sessionId string) (bool, error) {
+	if conn == nil {
+		return false, ErrNilConnection
+	}
+
+	if sessionId == "" {
+		return false, ErrInvalidSessionId
+	}
+
+	if v.sessions == nil {
+		return false, ErrSessionsDisabled
+	}
+
+	owner := v.Attrs(conn)[SessionOwnerAttr]
+
+	m := v.sessions
+	m.Lock()
+
+	if _, ok := m.byConn[conn.GetId()]; ok {
+		m.Unlock()
+		return false, ErrSessionInUse
+	}
+
+	s, ok := m.sessions[sessionId]
+	if !ok {
+		s = &session{id: sessionId, owner: owner, conn: conn}
+		m.sessions[sessionId] = s
+		m.byConn[conn.GetId()] = s
+		m.Unlock()
+		return false, nil
+	}
+
+	if !reflect.DeepEqual(s.owner, owner) {
+		m.Unlock()
+		return false, ErrSessionNotOwned
+	}
+
+	if s.conn != nil {
+		m.Unlock()
+		return false, ErrSessionInUse
+	}
+
+	s.timer.Stop()
+	s.conn = conn
+	m.byConn[conn.GetId()] = s
+	topics, queue := s.topics, s.queue
+	m.Unlock()
+
+	// Nothing is written to the connection before it is known to be allowed to receive it.
+	for _, topic := range topics {
+		if err := v.CheckSubscribe(conn, topic); err != nil {
+			v.releaseSession(s, conn)
+			return false, err
+		}
+	}
+
+	m.Lock()
+	s.topics, s.queue = nil, nil
+	m.Unlock()
+
+	if queue == nil {
+		for _, topic := range topics {
+			if err := v.Subscribe(conn, topic); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+	}
+
+	// The queued messages are written first and the queue forwards the messages
+	// it still receives, so that the connection can take its place in each topic
+	// without missing or repeating messages.
+	if err := queue.Forward(conn); err != nil {
+		v.unsubscribeFromStore(queue, topics)
+		return true, err
+	}
+
+	for i, topic := range topics {
+		v.replaceInTopic(topic, queue, conn)
+
+		if err := v.Subscribe(conn, topic); err != nil {
+			v.unsubscribeFromStore(conn, topics[i:i+1])
+			v.unsubscribeFromStore(queue, topics[i+1:])
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// releaseSession disconnects a session again after a connection failed to resume it.
+func (v *Varto) releaseSession(s *session, conn Connection) {
+	m := v.sessions
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.byConn, conn.GetId())
+	s.conn = nil
+	s.timer = time.AfterFunc(m.expiry, func() {
+		v.expireSession(s)
+	})
+}
+
+// replaceInTopic replaces a session queue with the connection resuming the session
+// in a single step if the topic supports it, or unsubscribes the queue after subscribing the connection.
+func (v *Varto) replaceInTopic(name string, queue *sessionQueue, conn Connection) {
+	t, err := v.store.GetTopic(name)
+	if err != nil {
+		return
+	}
+
+	if r, ok := t.(connectionReplacer); ok {
+		r.replace(queue, conn)
+		return
+	}
+
+	t.Subscribe(conn)
+	t.Unsubscribe(queue)
+}
+
+// detachSession keeps the session of a removed connection alive until it expires.
+func (v *Varto) detachSession(conn Connection, topics []string) {
+	m := v.sessions
+	m.Lock()
+	defer m.Unlock()
+
+	s, ok := m.byConn[conn.GetId()]
+	if !ok {
+		return
+	}
+
+	delete(m.byConn, conn.GetId())
+	s.conn = nil
+	s.topics = topics
+
+	if m.queueSize > 0 {
+		s.queue = newSessionQueue(s.id, m.queueSize)
+		for _, name := range topics {
+			if t, err := v.store.GetTopic(name); err == nil {
+				t.Subscribe(s.queue)
+			}
+		}
+	}
+
+	s.timer = time.AfterFunc(m.expiry, func() {
+		v.expireSession(s)
+	})
+}
+
+// detachSessionsFrom removes a topic from the disconnected sessions,
+// so that they neither queue its messages nor subscribe to it again when resumed.
+func (v *Varto) detachSessionsFrom(t Topic, topicName string) {
+	m := v.sessions
+	m.Lock()
+	defer m.Unlock()
+
+	for _, s := range m.sessions {
+		if s.conn != nil || !slices.Contains(s.topics, topicName) {
+			continue
+		}
+
+		s.topics = slices.DeleteFunc(slices.Clone(s.topics), func(topic string) bool {
+			return topic == topicName
+		})
+
+		if s.queue != nil {
+			t.Unsubscribe(s.queue)
+		}
+	}
+}
+
+func (v *Varto) expireSession(s *session) {
+	m := v.sessions
+	m.Lock()
+
+	if m.sessions[s.id] != s || s.conn != nil {
+		m.Unlock()
+		return
+	}
+
+	delete(m.sessions, s.id)
+	topics, queue := s.topics, s.queue
+	m.Unlock()
+
+	if queue != nil {
+		v.unsubscribeFromStore(queue, topics)
+	}
+}
+
+// unsubscribeFromStore unsubscribes a session queue, or a connection that failed to resume it, from the topics
+// and removes the topics that are left empty.
+func (v *Varto) unsubscribeFromStore(conn Connection, topics []string) {
+	for _, name := range topics {
+		t, err := v.store.GetTopic(name)
+		if err != nil {
+			continue
+		}
+
+		t.Unsubscribe(conn)
+
+		if t.IsEmpty() {
+			if v.store.RemoveTopic(name) == nil {
+				v.emitTopicRemoved(name)
+			}
+		}
+	}
+}
+
+// sessionQueue stands in for a disconnected session and buffers the messages
+// published to its topics. The oldest messages are dropped once it is full.
+// Once the session is resumed, it forwards the messages to the connection instead.
+type sessionQueue struct {
+	sync.Mutex
+	id       string
+	size     int
+	messages [][]byte
+	forward  Connection
+}
+
+// sessionQueueIdPrefix starts the ids of session queues.
+const sessionQueueIdPrefix = reservedIdPrefix + "session:"
+
+func newSessionQueue(sessionId string, size int) *sessionQueue {
+	return &sessionQueue{
+		id:   sessionQueueIdPrefix + sessionId,
+		size: size,
+	}
+}
+
+func (q *sessionQueue) Read() ([]byte, error) {
+	return nil, errors.New("session queue cannot be read")
+}
+
+func (q *sessionQueue) Write(data []byte) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.forward != nil {
+		return q.forward.Write(data)
+	}
+
+	if len(q.messages) == q.size {
+		q.messages = q.messages[1:]
+	}
+
+	q.messages = append(q.messages, append([]byte(nil), data...))
+	return nil
+}
+
+func (q *sessionQueue) GetId() string {
+	return q.id
+}
+
+// Forward writes the queued messages to conn and forwards the messages written afterwards to it.
+func (q *sessionQueue) Forward(conn Connection) error {
+	q.Lock()
+	defer q.Unlock()
+
+	messages := q.messages
+	q.messages = nil
+	q.forward = conn
+
+	for _, data := range messages {
+		if err := conn.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package varto_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/internal/testutil"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// countingConnection counts how many times each message is written to it.
+type countingConnection struct {
+	id     string
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *countingConnection) GetId() string {
+	return c.id
+}
+
+func (c *countingConnection) Read() ([]byte, error) {
+	return nil, nil
+}
+
+func (c *countingConnection) Write(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[string(data)]++
+	return nil
+}
+
+func (c *countingConnection) total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.counts)
+}
+
+func TestResumeSession(t *testing.T) {
+	t.Run("TestResumeSession_WhenSessionsAreDisabled_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+
+		_, err := v.ResumeSession(mockConnection, "session")
+		assert.Equal(t, varto.ErrSessionsDisabled, err)
+	})
+
+	t.Run("TestResumeSession_WhenSessionIdIsEmpty_ThenReturnError", func(t *testing.T) {
+		v := varto.New(&varto.Options{SessionExpiry: time.Minute})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+
+		_, err := v.ResumeSession(mockConnection, "")
+		assert.Equal(t, varto.ErrInvalidSessionId, err)
+	})
+
+	t.Run("TestResumeSession_WhenSessionDoesNotExist_ThenReturnFalse", func(t *testing.T) {
+		v := varto.New(&varto.Options{SessionExpiry: time.Minute})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		resumed, err := v.ResumeSession(mockConnection, "session")
+		assert.Nil(t, err)
+		assert.False(t, resumed)
+	})
+
+	t.Run("TestResumeSession_WhenSessionIsInUse_ThenReturnError", func(t *testing.T) {
+		v := varto.New(&varto.Options{SessionExpiry: time.Minute})
+		mockConnection1 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection1.EXPECT().GetId().Return("id1").AnyTimes()
+		mockConnection2 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection2.EXPECT().GetId().Return("id2").AnyTimes()
+
+		v.ResumeSession(mockConnection1, "session")
+		_, err := v.ResumeSession(mockConnection2, "session")
+		assert.Equal(t, varto.ErrSessionInUse, err)
+	})
+
+	t.Run("TestResumeSession_WhenReconnected_ThenRestoreSubscriptionsAndQueuedMessages", func(t *testing.T) {
+		v := varto.New(&varto.Options{SessionExpiry: time.Minute, SessionQueueSize: 10})
+		mockConnection1 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection1.EXPECT().GetId().Return("id1").AnyTimes()
+		mockConnection2 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection2.EXPECT().GetId().Return("id2").AnyTimes()
+
+		v.AddConnection(mockConnection1)
+		v.ResumeSession(mockConnection1, "session")
+		v.Subscribe(mockConnection1, "topic")
+		v.RemoveConnection(mockConnection1)
+
+		v.Publish("topic", []byte("queued"))
+		time.Sleep(10 * time.Millisecond)
+
+		gomock.InOrder(
+			mockConnection2.EXPECT().Write([]byte("queued")).Return(nil),
+			mockConnection2.EXPECT().Write([]byte("live")).Return(nil),
+		)
+
+		v.AddConnection(mockConnection2)
+		resumed, err := v.ResumeSession(mockConnection2, "session")
+		assert.Nil(t, err)
+		assert.True(t, resumed)
+
+		err = v.Publish("topic", []byte("live"))
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(t, err)
+	})
+
+	t.Run("TestResumeSession_WhenOwnerDiffers_ThenReturnErrorAndKeepSession", func(t *testing.T) {
+		v := varto.New(&varto.Options{SessionExpiry: time.Minute, SessionQueueSize: 10})
+		alice := mock.NewMockConnection(gomock.NewController(t))
+		alice.EXPECT().GetId().Return("id1").AnyTimes()
+		bob := mock.NewMockConnection(gomock.NewController(t))
+		bob.EXPECT().GetId().Return("id2").AnyTimes()
+		ctrl := gomock.NewController(t)
+		aliceAgain := mock.NewMockConnection(ctrl)
+		aliceAgain.EXPECT().GetId().Return("id3").AnyTimes()
+
+		v.AddConnection(alice)
+		v.SetAttr(alice, varto.SessionOwnerAttr, "alice")
+		v.ResumeSession(alice, "session")
+		v.Subscribe(alice, "topic")
+		v.RemoveConnection(alice)
+		v.Publish("topic", []byte("private"))
+
+		v.AddConnection(bob)
+		v.SetAttr(bob, varto.SessionOwnerAttr, "bob")
+		resumed, err := v.ResumeSession(bob, "session")
+		assert.Equal(t, varto.ErrSessionNotOwned, err)
+		assert.False(t, resumed)
+
+		aliceAgain.EXPECT().Write([]byte("private")).Return(nil)
+		v.AddConnection(aliceAgain)
+		v.SetAttr(aliceAgain, varto.SessionOwnerAttr, "alice")
+		resumed, err = v.ResumeSession(aliceAgain, "session")
+		assert.Nil(t, err)
+		assert.True(t, resumed)
+		testutil.WaitFor(t, ctrl.Satisfied)
+	})
+
+	t.Run("TestResumeSession_WhenTopicIsNotAllowed_ThenReturnErrorBeforeWritingQueuedMessages", func(t *testing.T) {
+		v := varto.New(&varto.Options{SessionExpiry: time.Minute, SessionQueueSize: 10})
+		mockConnection1 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection1.EXPECT().GetId().Return("id1").AnyTimes()
+		mockConnection2 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection2.EXPECT().GetId().Return("id2").AnyTimes()
+		ctrl := gomock.NewController(t)
+		mockConnection3 := mock.NewMockConnection(ctrl)
+		mockConnection3.EXPECT().GetId().Return("id3").AnyTimes()
+
+		v.ResumeSession(mockConnection1, "session")
+		v.Subscribe(mockConnection1, "topic")
+		v.RemoveConnection(mockConnection1)
+		v.Publish("topic", []byte("queued"))
+		v.DisallowTopic("topic")
+
+		resumed, err := v.ResumeSession(mockConnection2, "session")
+		assert.Equal(t, varto.ErrTopicIsNotAllowed, err)
+		assert.False(t, resumed)
+
+		v.AllowTopic("topic")
+		mockConnection3.EXPECT().Write([]byte("queued")).Return(nil)
+		resumed, err = v.ResumeSession(mockConnection3, "session")
+		assert.Nil(t, err)
+		assert.True(t, resumed)
+		testutil.WaitFor(t, ctrl.Satisfied)
+	})
+
+	t.Run("TestResumeSession_WhenSessionExpired_ThenReturnFalse", func(t *testing.T) {
+		v := varto.New(&varto.Options{SessionExpiry: 5 * time.Millisecond, SessionQueueSize: 10})
+		mockConnection1 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection1.EXPECT().GetId().Return("id1").AnyTimes()
+		mockConnection2 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection2.EXPECT().GetId().Return("id2").AnyTimes()
+
+		v.ResumeSession(mockConnection1, "session")
+		v.Subscribe(mockConnection1, "topic")
+		v.RemoveConnection(mockConnection1)
+		time.Sleep(20 * time.Millisecond)
+
+		resumed, err := v.ResumeSession(mockConnection2, "session")
+		assert.Nil(t, err)
+		assert.False(t, resumed)
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("topic", []byte("data")))
+	})
+	t.Run("TestResumeSession_WhenMessagesArePublishedWhileResuming_ThenWriteEachOnce", func(t *testing.T) {
+		v := varto.New(&varto.Options{SessionExpiry: time.Minute, SessionQueueSize: 1000})
+		conn1 := &countingConnection{id: "id1", counts: make(map[string]int)}
+		conn2 := &countingConnection{id: "id2", counts: make(map[string]int)}
+
+		v.AddConnection(conn1)
+		v.ResumeSession(conn1, "session")
+		v.Subscribe(conn1, "topic")
+		v.RemoveConnection(conn1)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 500; i++ {
+				v.Publish("topic", []byte(fmt.Sprint(i)))
+			}
+		}()
+
+		v.AddConnection(conn2)
+		resumed, err := v.ResumeSession(conn2, "session")
+		<-done
+
+		assert.Nil(t, err)
+		assert.True(t, resumed)
+		assert.Eventually(t, func() bool { return conn2.total() == 500 }, time.Second, time.Millisecond)
+		conn2.mu.Lock()
+		defer conn2.mu.Unlock()
+		for data, count := range conn2.counts {
+			assert.Equal(t, 1, count, data)
+		}
+	})
+}
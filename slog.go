@@ -0,0 +1,124 @@
+package varto
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+)
+
+type SlogOptions struct {
+	// Level is the level of successful operations. If it is nil, slog.LevelInfo is used.
+	Level slog.Leveler
+
+	// ErrorLevel is the level of failed operations and delivery errors.
+	// If it is nil, slog.LevelError is used.
+	ErrorLevel slog.Leveler
+
+	// PayloadSampleRate is the fraction of publishes and broadcasts, from 0 to 1,
+	// whose payload is logged. If it is zero, payloads are never logged.
+	PayloadSampleRate float64
+
+	// MaxPayloadBytes is the maximum number of payload bytes logged.
+	// If it is zero, 256 bytes are logged.
+	MaxPayloadBytes int
+}
+
+const defaultSlogMaxPayloadBytes = 256
+
+type slogMiddleware struct {
+	BaseMiddleware
+	logger *slog.Logger
+	opts   SlogOptions
+}
+
+// SlogMiddleware returns a middleware that logs every operation to logger once it is done,
+// along with the delivery errors of topics. If opts is nil, default options are used.
+func SlogMiddleware(logger *slog.Logger, opts *SlogOptions) Middleware {
+	m := &slogMiddleware{
+		logger: logger,
+	}
+
+	if opts != nil {
+		m.opts = *opts
+	}
+
+	if m.opts.Level == nil {
+		m.opts.Level = slog.LevelInfo
+	}
+
+	if m.opts.ErrorLevel == nil {
+		m.opts.ErrorLevel = slog.LevelError
+	}
+
+	if m.opts.MaxPayloadBytes == 0 {
+		m.opts.MaxPayloadBytes = defaultSlogMaxPayloadBytes
+	}
+
+	return m
+}
+
+func (m *slogMiddleware) AfterAddConnection(conn Connection, err error) {
+	m.log("add connection", err, slog.String("connection_id", conn.GetId()))
+}
+
+func (m *slogMiddleware) AfterRemoveConnection(conn Connection, err error) {
+	m.log("remove connection", err, slog.String("connection_id", conn.GetId()))
+}
+
+func (m *slogMiddleware) AfterSubscribe(conn Connection, topic string, err error) {
+	m.log("subscribe", err, slog.String("connection_id", conn.GetId()), slog.String("topic", topic))
+}
+
+func (m *slogMiddleware) AfterUnsubscribe(conn Connection, topic string, err error) {
+	m.log("unsubscribe", err, slog.String("connection_id", conn.GetId()), slog.String("topic", topic))
+}
+
+func (m *slogMiddleware) AfterPublish(report PublishReport) {
+	attrs := []slog.Attr{slog.String("topic", report.Topic)}
+	if report.Connection != nil {
+		attrs = append(attrs, slog.String("connection_id", report.Connection.GetId()))
+	}
+
+	m.log("publish", report.Err, append(attrs, m.reportAttrs(report)...)...)
+}
+
+func (m *slogMiddleware) AfterBroadcastToAll(report PublishReport) {
+	m.log("broadcast", report.Err, m.reportAttrs(report)...)
+}
+
+func (m *slogMiddleware) OnDeliveryError(topic string, conn Connection, err error) {
+	m.logger.LogAttrs(context.Background(), m.opts.ErrorLevel.Level(), "deliver failed",
+		slog.String("connection_id", conn.GetId()),
+		slog.String("topic", topic),
+		slog.Any("error", err),
+	)
+}
+
+func (m *slogMiddleware) reportAttrs(report PublishReport) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.Int("size", len(report.Data)),
+		slog.Int("recipients", report.Recipients),
+	}
+
+	if m.opts.PayloadSampleRate > 0 && rand.Float64() < m.opts.PayloadSampleRate {
+		payload := report.Data
+		if len(payload) > m.opts.MaxPayloadBytes {
+			payload = payload[:m.opts.MaxPayloadBytes]
+		}
+
+		attrs = append(attrs, slog.String("payload", string(payload)))
+	}
+
+	return attrs
+}
+
+func (m *slogMiddleware) log(msg string, err error, attrs ...slog.Attr) {
+	level := m.opts.Level.Level()
+	if err != nil {
+		level = m.opts.ErrorLevel.Level()
+		msg += " failed"
+		attrs = append(attrs, slog.Any("error", err))
+	}
+
+	m.logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
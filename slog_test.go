@@ -0,0 +1,112 @@
+package varto_test
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.String()
+}
+
+func TestSlogMiddleware(t *testing.T) {
+	newLogger := func() (*slog.Logger, *syncBuffer) {
+		buf := &syncBuffer{}
+		return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})), buf
+	}
+
+	t.Run("TestSlogMiddleware_WhenSubscribed_ThenLogConnectionAndTopic", func(t *testing.T) {
+		logger, buf := newLogger()
+		v := varto.New(nil)
+		v.Use(varto.SlogMiddleware(logger, nil))
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Subscribe(mockConnection, "topic")
+
+		assert.Contains(t, buf.String(), "level=INFO msg=subscribe connection_id=id topic=topic")
+	})
+
+	t.Run("TestSlogMiddleware_WhenOperationFails_ThenLogErrorAtErrorLevel", func(t *testing.T) {
+		logger, buf := newLogger()
+		v := varto.New(nil)
+		v.Use(varto.SlogMiddleware(logger, &varto.SlogOptions{ErrorLevel: slog.LevelWarn}))
+
+		v.Publish("topic", []byte("data"))
+
+		assert.Contains(t, buf.String(), `level=WARN msg="publish failed" topic=topic size=4 recipients=0 error="topic not found"`)
+	})
+
+	t.Run("TestSlogMiddleware_WhenPayloadIsSampled_ThenLogTruncatedPayload", func(t *testing.T) {
+		logger, buf := newLogger()
+		v := varto.New(nil)
+		v.Use(varto.SlogMiddleware(logger, &varto.SlogOptions{Level: slog.LevelDebug, PayloadSampleRate: 1, MaxPayloadBytes: 3}))
+
+		v.BroadcastToAll([]byte("data"))
+
+		assert.Contains(t, buf.String(), "level=DEBUG msg=broadcast size=4 recipients=0 payload=dat")
+	})
+
+	t.Run("TestSlogMiddleware_WhenDeliveryFails_ThenLogError", func(t *testing.T) {
+		logger, buf := newLogger()
+		v := varto.New(nil)
+		v.Use(varto.SlogMiddleware(logger, nil))
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(fmt.Errorf("broken pipe"))
+
+		v.Subscribe(mockConnection, "topic")
+		v.Publish("topic", []byte("data"))
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Contains(t, buf.String(), `level=ERROR msg="deliver failed" connection_id=id topic=topic error="broken pipe"`)
+	})
+}
+
+func TestOnDeliveryError(t *testing.T) {
+	t.Run("TestOnDeliveryError_WhenWriteFails_ThenCallHandler", func(t *testing.T) {
+		errs := make(chan error, 1)
+		v := varto.New(&varto.Options{
+			OnDeliveryError: func(topic string, conn varto.Connection, err error) {
+				errs <- err
+			},
+		})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(fmt.Errorf("error"))
+
+		v.Subscribe(mockConnection, "topic")
+		v.Publish("topic", []byte("data"))
+
+		select {
+		case err := <-errs:
+			assert.EqualError(t, err, "error")
+		case <-time.After(time.Second):
+			t.Fatal("delivery error is not reported")
+		}
+	})
+}
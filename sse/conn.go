@@ -0,0 +1,185 @@
+// Package sse implements write-only varto connections over Server-Sent Events.
+package sse
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/metinorak/varto"
+)
+
+// Conn is a Server-Sent Events stream. It implements varto.Connection and varto.MessageWriter.
+// It is write-only: Read blocks until the request is done and then returns io.EOF.
+//
+// Writes are queued and written by the handler of the stream, so a slow client never
+// blocks the delivery to other connections. A stream whose queue is full is closed,
+// and the client can resume it with the Last-Event-ID header.
+type Conn struct {
+	id          string
+	ctx         context.Context
+	w           http.ResponseWriter
+	rc          *http.ResponseController
+	topicEvents bool
+	history     *history
+
+	// lastId is the id of the last event the client got before resuming, and replayed
+	// holds the ids of the events replayed to it, so that events that are both
+	// replayed and queued are written once. They are only used by the handler.
+	lastId   uint64
+	replayed map[uint64]bool
+
+	mu         sync.Mutex
+	queue      []event
+	bufferSize int
+	overflow   bool
+	closed     bool
+	ready      chan struct{}
+}
+
+func newConn(id string, ctx context.Context, w http.ResponseWriter, h *handler) *Conn {
+	return &Conn{
+		id:          id,
+		ctx:         ctx,
+		w:           w,
+		rc:          http.NewResponseController(w),
+		topicEvents: h.opts.TopicEvents,
+		history:     h.history,
+		bufferSize:  h.opts.BufferSize,
+		ready:       make(chan struct{}, 1),
+	}
+}
+
+func (c *Conn) GetId() string {
+	return c.id
+}
+
+func (c *Conn) Read() ([]byte, error) {
+	<-c.ctx.Done()
+	return nil, io.EOF
+}
+
+// Write sends data as an event without an id.
+func (c *Conn) Write(data []byte) error {
+	return c.push(event{msg: varto.Message{Data: data}})
+}
+
+// WriteMessage sends a message of a topic as an event with the message id, and keeps it
+// in the history of the handler. A message without a topic, such as a broadcast, is sent
+// as an event without an id.
+func (c *Conn) WriteMessage(msg varto.Message) error {
+	if msg.Topic == "" {
+		return c.Write(msg.Data)
+	}
+
+	e := event{id: msg.Id, msg: varto.Message{Topic: msg.Topic, Data: msg.Data}}
+	c.history.record(e)
+	return c.push(e)
+}
+
+// push queues an event for the handler to write.
+func (c *Conn) push(e event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	if c.overflow {
+		return varto.ErrSlowConsumer
+	}
+
+	if len(c.queue) >= c.bufferSize {
+		c.overflow = true
+		c.signal()
+		return varto.ErrSlowConsumer
+	}
+
+	c.queue = append(c.queue, e)
+	c.signal()
+	return nil
+}
+
+func (c *Conn) signal() {
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+// writeQueued writes the queued events. It returns varto.ErrSlowConsumer if the queue overflowed.
+func (c *Conn) writeQueued() error {
+	c.mu.Lock()
+	queue, overflow := c.queue, c.overflow
+	c.queue = nil
+	c.mu.Unlock()
+
+	if overflow {
+		return varto.ErrSlowConsumer
+	}
+
+	for _, e := range queue {
+		if err := c.writeEvent(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeEvent writes and flushes an event, unless it has already been written.
+func (c *Conn) writeEvent(e event) error {
+	if e.id != 0 && (e.id <= c.lastId || c.replayed[e.id]) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if e.id != 0 {
+		buf.WriteString("id: " + strconv.FormatUint(e.id, 10) + "\n")
+	}
+
+	if c.topicEvents && e.msg.Topic != "" {
+		buf.WriteString("event: " + eventName(e.msg.Topic) + "\n")
+	}
+
+	for _, line := range bytes.Split(e.msg.Data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n")
+
+	return c.flush(buf.Bytes())
+}
+
+// writeComment writes a comment line, which clients ignore.
+func (c *Conn) writeComment(comment string) error {
+	return c.flush([]byte(": " + comment + "\n\n"))
+}
+
+func (c *Conn) flush(data []byte) error {
+	if _, err := c.w.Write(data); err != nil {
+		return err
+	}
+
+	return c.rc.Flush()
+}
+
+// close stops queuing writes, since the response must not be used after the handler returns.
+func (c *Conn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	c.queue = nil
+}
+
+// eventName removes line breaks from a topic, which would end the event field and start another one.
+func eventName(topic string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(topic)
+}
@@ -0,0 +1,5 @@
+package sse
+
+import "errors"
+
+var ErrClosed = errors.New("sse stream closed")
@@ -0,0 +1,180 @@
+package sse
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metinorak/varto"
+)
+
+// DefaultKeepAlive is the interval of keep-alive comments if Options.KeepAlive is zero.
+const DefaultKeepAlive = 15 * time.Second
+
+// DefaultHistorySize is the number of messages kept per topic if Options.HistorySize is zero.
+const DefaultHistorySize = 100
+
+// DefaultHistoryExpiry is how long the messages of a topic are kept after its last stream closed
+// if Options.HistoryExpiry is zero.
+const DefaultHistoryExpiry = time.Minute
+
+// DefaultBufferSize is the number of events queued per stream if Options.BufferSize is zero.
+const DefaultBufferSize = 256
+
+// TopicParam is the query parameter the topics of a stream are read from. It can be repeated.
+const TopicParam = "topic"
+
+// Options configures a Server-Sent Events handler.
+type Options struct {
+	// KeepAlive is the interval of the comments sent to keep idle streams open.
+	// If it is zero, DefaultKeepAlive is used.
+	KeepAlive time.Duration
+
+	// HistorySize is the number of messages kept per topic for clients that
+	// reconnect with a Last-Event-ID header. If it is zero, DefaultHistorySize is used.
+	// If it is negative, no messages are kept.
+	// Only the topics streams are subscribed to are kept.
+	HistorySize int
+
+	// HistoryExpiry is how long the messages of a topic are kept after its last stream closed.
+	// If it is zero, DefaultHistoryExpiry is used.
+	HistoryExpiry time.Duration
+
+	// BufferSize is the number of events queued per stream. A stream that falls further behind
+	// is closed, and the client can resume it with the Last-Event-ID header.
+	// If it is zero, DefaultBufferSize is used.
+	BufferSize int
+
+	// TopicEvents sends each message as an event named after its topic,
+	// instead of as an unnamed message event.
+	TopicEvents bool
+
+	// Id returns the id of the connection of a request. If it is nil, a random id is used.
+	Id func(r *http.Request) string
+}
+
+type handler struct {
+	v       *varto.Varto
+	opts    Options
+	history *history
+}
+
+// Handler returns an http.Handler that streams the messages of the topics
+// in the TopicParam query parameters as Server-Sent Events.
+// Topics that contain line breaks are rejected.
+// It adds a middleware to v that keeps the messages of the topics of streams for replaying.
+func Handler(v *varto.Varto, opts *Options) http.Handler {
+	h := &handler{v: v}
+	if opts != nil {
+		h.opts = *opts
+	}
+
+	if h.opts.KeepAlive == 0 {
+		h.opts.KeepAlive = DefaultKeepAlive
+	}
+
+	if h.opts.HistorySize == 0 {
+		h.opts.HistorySize = DefaultHistorySize
+	}
+
+	if h.opts.HistoryExpiry == 0 {
+		h.opts.HistoryExpiry = DefaultHistoryExpiry
+	}
+
+	if h.opts.BufferSize == 0 {
+		h.opts.BufferSize = DefaultBufferSize
+	}
+
+	h.history = newHistory(v, h.opts.HistorySize, h.opts.HistoryExpiry)
+	v.Use(h.history)
+
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	topics := r.URL.Query()[TopicParam]
+	if len(topics) == 0 {
+		http.Error(w, "no topic", http.StatusBadRequest)
+		return
+	}
+
+	for _, topic := range topics {
+		if strings.ContainsAny(topic, "\r\n") {
+			http.Error(w, "invalid topic", http.StatusBadRequest)
+			return
+		}
+	}
+
+	id := varto.NewConnectionId()
+	if h.opts.Id != nil {
+		id = h.opts.Id(r)
+	}
+
+	conn := newConn(id, r.Context(), w, h)
+	if err := h.v.AddConnection(conn); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer conn.close()
+	defer h.v.RemoveConnection(conn)
+
+	if !h.open(w, r, conn, topics) {
+		return
+	}
+
+	ticker := time.NewTicker(h.opts.KeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if err := conn.writeComment("keep-alive"); err != nil {
+				return
+			}
+		case <-conn.ready:
+			if err := conn.writeQueued(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// open subscribes the connection to the topics, starts the stream and replays the messages
+// the client missed. Live messages are queued meanwhile and written after the replay.
+func (h *handler) open(w http.ResponseWriter, r *http.Request, conn *Conn, topics []string) bool {
+	for _, topic := range topics {
+		if err := h.v.Subscribe(conn, topic); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return false
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := conn.rc.Flush(); err != nil {
+		return false
+	}
+
+	lastId, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	if err != nil {
+		return true
+	}
+
+	events := h.history.after(topics, lastId)
+	conn.lastId = lastId
+	conn.replayed = make(map[uint64]bool, len(events))
+	for _, e := range events {
+		if err := conn.writeEvent(e); err != nil {
+			return false
+		}
+		conn.replayed[e.id] = true
+	}
+
+	return true
+}
@@ -0,0 +1,175 @@
+package sse
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/metinorak/varto"
+)
+
+// event is a published message with the id it is sent with.
+type event struct {
+	id  uint64
+	msg varto.Message
+}
+
+// history is a middleware that keeps the latest messages of the topics of the streams of a handler
+// for replaying them. Events are numbered with the ids Varto gives to messages.
+//
+// Only topics with streams are tracked. A topic is forgotten once it has had no streams
+// for the expiry, so that clients can still resume after reconnecting. Meanwhile the messages
+// published to it are still kept.
+type history struct {
+	varto.BaseMiddleware
+	sync.Mutex
+	v      *varto.Varto
+	size   int
+	expiry time.Duration
+	topics map[string]*topicHistory
+}
+
+type topicHistory struct {
+	conns  map[*Conn]bool
+	events []event
+	timer  *time.Timer
+}
+
+func newHistory(v *varto.Varto, size int, expiry time.Duration) *history {
+	return &history{
+		v:      v,
+		size:   size,
+		expiry: expiry,
+		topics: make(map[string]*topicHistory),
+	}
+}
+
+func (h *history) AfterSubscribe(conn varto.Connection, topic string, err error) {
+	c, ok := conn.(*Conn)
+	if !ok || c.history != h || err != nil {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	t, ok := h.topics[topic]
+	if !ok {
+		t = &topicHistory{conns: make(map[*Conn]bool)}
+		h.topics[topic] = t
+	}
+
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.conns[c] = true
+}
+
+func (h *history) AfterUnsubscribe(conn varto.Connection, topic string, err error) {
+	c, ok := conn.(*Conn)
+	if !ok || c.history != h || err != nil {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.remove(c, topic)
+}
+
+func (h *history) AfterRemoveConnection(conn varto.Connection, err error) {
+	c, ok := conn.(*Conn)
+	if !ok || c.history != h {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	for topic := range h.topics {
+		h.remove(c, topic)
+	}
+}
+
+// remove removes a stream from a topic and schedules forgetting the topic if it was the last one.
+// The caller must hold the lock.
+func (h *history) remove(c *Conn, topic string) {
+	t, ok := h.topics[topic]
+	if !ok || !t.conns[c] {
+		return
+	}
+
+	delete(t.conns, c)
+	if len(t.conns) > 0 {
+		return
+	}
+
+	t.timer = time.AfterFunc(h.expiry, func() {
+		h.Lock()
+		defer h.Unlock()
+
+		if h.topics[topic] == t && len(t.conns) == 0 {
+			delete(h.topics, topic)
+		}
+	})
+}
+
+// AfterPublish keeps a message published to tracked topics, including topics without streams.
+func (h *history) AfterPublish(report varto.PublishReport) {
+	if report.Err != nil || report.Id == 0 {
+		return
+	}
+
+	h.record(event{id: report.Id, msg: varto.Message{Topic: report.Topic, Data: report.Data}})
+}
+
+// record keeps an event in the tracked topics it matches, unless it is already kept.
+func (h *history) record(e event) {
+	if h.size <= 0 || e.id == 0 {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	for name, t := range h.topics {
+		if !h.v.MatchTopic(name, e.msg.Topic) || slices.ContainsFunc(t.events, func(kept event) bool { return kept.id == e.id }) {
+			continue
+		}
+
+		t.events = append(t.events, e)
+		if len(t.events) > h.size {
+			t.events = t.events[len(t.events)-h.size:]
+		}
+	}
+}
+
+// after returns the kept events of the topics with an id greater than lastId, ordered by id.
+func (h *history) after(topics []string, lastId uint64) []event {
+	h.Lock()
+	defer h.Unlock()
+
+	seen := make(map[uint64]bool)
+	var events []event
+	for _, topic := range topics {
+		t, ok := h.topics[topic]
+		if !ok {
+			continue
+		}
+
+		for _, e := range t.events {
+			if e.id > lastId && !seen[e.id] {
+				seen[e.id] = true
+				events = append(events, e)
+			}
+		}
+	}
+
+	slices.SortFunc(events, func(a, b event) int {
+		return cmp.Compare(a.id, b.id)
+	})
+
+	return events
+}
@@ -0,0 +1,211 @@
+package sse_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/internal/testutil"
+	"github.com/metinorak/varto/sse"
+	"github.com/stretchr/testify/assert"
+)
+
+type messageConn struct {
+	mu   sync.Mutex
+	msgs []varto.Message
+}
+
+func (c *messageConn) GetId() string           { return "message-conn" }
+func (c *messageConn) Read() ([]byte, error)   { return nil, nil }
+func (c *messageConn) Write(data []byte) error { return nil }
+
+func (c *messageConn) WriteMessage(msg varto.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.msgs = append(c.msgs, msg)
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	serve := func(t *testing.T, v *varto.Varto, opts *sse.Options) string {
+		srv := httptest.NewServer(sse.Handler(v, opts))
+		t.Cleanup(srv.Close)
+
+		return srv.URL
+	}
+
+	connect := func(t *testing.T, url string, header http.Header) (*bufio.Reader, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		return bufio.NewReader(resp.Body), cancel
+	}
+
+	readEvent := func(t *testing.T, r *bufio.Reader) string {
+		var event strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line == "\n" {
+				return event.String()
+			}
+			event.WriteString(line)
+		}
+	}
+
+	t.Run("TestHandler_WhenMessageIsPublished_ThenSendEventWithId", func(t *testing.T) {
+		v := varto.New(nil)
+		stream, _ := connect(t, serve(t, v, nil)+"?topic=topic", nil)
+
+		assert.Nil(t, v.Publish("topic", []byte("line1\nline2")))
+
+		assert.Equal(t, "id: 1\ndata: line1\ndata: line2\n", readEvent(t, stream))
+	})
+
+	t.Run("TestHandler_WhenTopicEventsIsSet_ThenNameEventsAfterTopics", func(t *testing.T) {
+		v := varto.New(nil)
+		stream, _ := connect(t, serve(t, v, &sse.Options{TopicEvents: true})+"?topic=topic1&topic=topic2", nil)
+
+		v.Publish("topic2", []byte("data"))
+
+		assert.Equal(t, "id: 1\nevent: topic2\ndata: data\n", readEvent(t, stream))
+	})
+
+	t.Run("TestHandler_WhenLastEventIdIsSent_ThenReplayMissedMessages", func(t *testing.T) {
+		v := varto.New(nil)
+		url := serve(t, v, nil) + "?topic=topic"
+		stream, cancel := connect(t, url, nil)
+
+		v.Publish("topic", []byte("data1"))
+		v.Publish("topic", []byte("data2"))
+		v.Publish("topic", []byte("data3"))
+		assert.Equal(t, "id: 1\ndata: data1\n", readEvent(t, stream))
+		cancel()
+
+		stream, _ = connect(t, url, http.Header{"Last-Event-ID": {"1"}})
+
+		assert.Equal(t, "id: 2\ndata: data2\n", readEvent(t, stream))
+		assert.Equal(t, "id: 3\ndata: data3\n", readEvent(t, stream))
+
+		v.Publish("topic", []byte("data4"))
+		assert.Equal(t, "id: 4\ndata: data4\n", readEvent(t, stream))
+	})
+
+	t.Run("TestHandler_WhenStreamIsIdle_ThenSendKeepAliveComments", func(t *testing.T) {
+		v := varto.New(nil)
+		stream, _ := connect(t, serve(t, v, &sse.Options{KeepAlive: 10 * time.Millisecond})+"?topic=topic", nil)
+
+		assert.Equal(t, ": keep-alive\n", readEvent(t, stream))
+	})
+
+	t.Run("TestHandler_WhenClientDisconnects_ThenRemoveConnection", func(t *testing.T) {
+		v := varto.New(nil)
+		_, cancel := connect(t, serve(t, v, nil)+"?topic=topic", nil)
+
+		stats, _ := v.Stats()
+		assert.Equal(t, varto.Stats{Connections: 1, Topics: 1, Subscriptions: 1}, stats)
+
+		cancel()
+		testutil.WaitFor(t, func() bool {
+			stats, _ := v.Stats()
+			return stats == varto.Stats{}
+		})
+	})
+
+	t.Run("TestHandler_WhenNoTopicIsGiven_ThenReturnBadRequest", func(t *testing.T) {
+		v := varto.New(nil)
+
+		resp, err := http.Get(serve(t, v, nil))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("TestHandler_WhenTopicHasLineBreak_ThenReturnBadRequest", func(t *testing.T) {
+		v := varto.New(nil)
+
+		resp, err := http.Get(serve(t, v, nil) + "?topic=" + url.QueryEscape("topic\ndata: injected"))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		stats, _ := v.Stats()
+		assert.Equal(t, varto.Stats{}, stats)
+	})
+
+	t.Run("TestHandler_WhenOtherConnectionGetsMessage_ThenMessageHasNoEventHeaders", func(t *testing.T) {
+		v := varto.New(nil)
+		stream, _ := connect(t, serve(t, v, nil)+"?topic=topic", nil)
+
+		conn := &messageConn{}
+		assert.Nil(t, v.AddConnection(conn))
+		assert.Nil(t, v.Subscribe(conn, "topic"))
+
+		assert.Nil(t, v.Publish("topic", []byte("data")))
+		assert.Equal(t, "id: 1\ndata: data\n", readEvent(t, stream))
+
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		assert.Equal(t, []varto.Message{{Topic: "topic", Data: []byte("data"), Id: 1}}, conn.msgs)
+	})
+
+	t.Run("TestHandler_WhenTopicHasNoStreams_ThenDoNotKeepItsMessages", func(t *testing.T) {
+		v := varto.New(nil)
+		url := serve(t, v, nil) + "?topic=topic"
+
+		conn := &messageConn{}
+		assert.Nil(t, v.AddConnection(conn))
+		assert.Nil(t, v.Subscribe(conn, "topic"))
+		assert.Nil(t, v.Publish("topic", []byte("data1")))
+
+		stream, _ := connect(t, url, http.Header{"Last-Event-ID": {"0"}})
+		assert.Nil(t, v.Publish("topic", []byte("data2")))
+
+		assert.Equal(t, "id: 2\ndata: data2\n", readEvent(t, stream))
+	})
+
+	t.Run("TestHandler_WhenPresenceEventsAreEnabled_ThenSendThemWithIds", func(t *testing.T) {
+		v := varto.New(&varto.Options{PresenceEvents: true})
+		stream, _ := connect(t, serve(t, v, nil)+"?topic=presence/room", nil)
+
+		conn := &messageConn{}
+		assert.Nil(t, v.AddConnection(conn))
+		assert.Nil(t, v.Subscribe(conn, "room"))
+
+		assert.Regexp(t, `^id: [1-9][0-9]*\ndata: .*"message-conn"`, readEvent(t, stream))
+	})
+
+	t.Run("TestHandler_WhenWildcardSubscriptionsAreDisabled_ThenDoNotReplayMatchingTopics", func(t *testing.T) {
+		v := varto.New(nil)
+		url := serve(t, v, nil) + "?topic=a/%2B"
+		_, cancel := connect(t, url, nil)
+
+		conn := &messageConn{}
+		assert.Nil(t, v.AddConnection(conn))
+		assert.Nil(t, v.Subscribe(conn, "a/b"))
+		assert.Nil(t, v.Publish("a/b", []byte("data1")))
+		assert.Nil(t, v.Publish("a/+", []byte("data2")))
+		cancel()
+
+		stream, _ := connect(t, url, http.Header{"Last-Event-ID": {"0"}})
+		assert.Equal(t, "id: 2\ndata: data2\n", readEvent(t, stream))
+	})
+}
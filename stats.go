@@ -0,0 +1,60 @@
+package varto
+
+import "slices"
+
+// Stats is a snapshot of the state of a Varto instance.
+type Stats struct {
+	// Connections is the number of connections in the store.
+	Connections int
+
+	// Topics is the number of topics with at least one subscriber.
+	Topics int
+
+	// Subscriptions is the total number of subscriptions.
+	Subscriptions int
+}
+
+// Stats returns a snapshot of the number of connections, topics and subscriptions.
+func (v *Varto) Stats() (Stats, error) {
+	connections, err := v.store.GetAllConnections()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	topics, subscriptions := v.subscriptions.Stats()
+
+	return Stats{
+		Connections:   len(connections),
+		Topics:        topics,
+		Subscriptions: subscriptions,
+	}, nil
+}
+
+// Topics returns the names of the topics with at least one subscriber, sorted.
+func (v *Varto) Topics() []string {
+	topics := v.subscriptions.Topics()
+	slices.Sort(topics)
+
+	return topics
+}
+
+// Subscribers returns the connections subscribed to a topic.
+func (v *Varto) Subscribers(topic string) []Connection {
+	return v.subscriptions.ConnectionsOf(topic)
+}
+
+// GetConnection returns the connection with the given id.
+func (v *Varto) GetConnection(id string) (Connection, error) {
+	connections, err := v.store.GetAllConnections()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, conn := range connections {
+		if conn.GetId() == id {
+			return conn, nil
+		}
+	}
+
+	return nil, ErrConnectionNotFound
+}
@@ -0,0 +1,12 @@
+package stomp
+
+import "errors"
+
+var ErrMalformedFrame = errors.New("malformed stomp frame")
+var ErrFrameTooLarge = errors.New("stomp frame too large")
+var ErrNotConnected = errors.New("stomp session is not connected")
+var ErrUnsupportedVersion = errors.New("unsupported stomp version")
+var ErrUnknownCommand = errors.New("unknown stomp command")
+var ErrMissingHeader = errors.New("missing stomp header")
+var ErrUnknownSubscription = errors.New("unknown stomp subscription")
+var ErrHeartBeatTimeout = errors.New("stomp heart-beat timeout")
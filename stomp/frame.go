@@ -0,0 +1,297 @@
+// Package stomp implements a STOMP 1.2 front end for varto.
+// Frames are read from and written to any varto.Connection, such as a ws.Conn or a netconn.Conn.
+package stomp
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Commands of the frames.
+const (
+	CommandConnect     = "CONNECT"
+	CommandStomp       = "STOMP"
+	CommandConnected   = "CONNECTED"
+	CommandSend        = "SEND"
+	CommandSubscribe   = "SUBSCRIBE"
+	CommandUnsubscribe = "UNSUBSCRIBE"
+	CommandAck         = "ACK"
+	CommandNack        = "NACK"
+	CommandBegin       = "BEGIN"
+	CommandCommit      = "COMMIT"
+	CommandAbort       = "ABORT"
+	CommandDisconnect  = "DISCONNECT"
+	CommandMessage     = "MESSAGE"
+	CommandReceipt     = "RECEIPT"
+	CommandError       = "ERROR"
+)
+
+// DefaultMaxFrameSize is the maximum size of a received frame if Options.MaxFrameSize is zero.
+const DefaultMaxFrameSize = 1 << 20
+
+// Frame is a STOMP frame. If a header is repeated, the first value is kept.
+type Frame struct {
+	Command string
+	Headers map[string]string
+	Body    []byte
+}
+
+// Bytes encodes the frame. The headers are written sorted by name.
+func (f *Frame) Bytes() []byte {
+	escape := f.Command != CommandConnect && f.Command != CommandConnected
+
+	var buf bytes.Buffer
+	buf.WriteString(f.Command)
+	buf.WriteByte('\n')
+
+	names := make([]string, 0, len(f.Headers))
+	for name := range f.Headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		value := f.Headers[name]
+		if escape {
+			name, value = escapeHeader(name), escapeHeader(value)
+		}
+
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteByte('\n')
+	buf.Write(f.Body)
+	buf.WriteByte(0)
+
+	return buf.Bytes()
+}
+
+// FrameReader reads frames from a stream of chunks, such as the data returned
+// by Connection.Read. A chunk may hold part of a frame or several frames.
+// End-of-lines between frames are heart-beats and are skipped.
+type FrameReader struct {
+	read         func() ([]byte, error)
+	buf          []byte
+	maxFrameSize int
+
+	// frame is the frame at the start of buf once its headers are parsed, and body
+	// and length are the position and the content-length of its body, or -1.
+	frame  *Frame
+	body   int
+	length int
+
+	// scanned is how far buf has been searched for the end of the headers or the body,
+	// so that each chunk is only searched once.
+	scanned int
+}
+
+// NewFrameReader returns a reader of the frames in the chunks returned by read.
+// If maxFrameSize is zero, DefaultMaxFrameSize is used.
+func NewFrameReader(read func() ([]byte, error), maxFrameSize int) *FrameReader {
+	if maxFrameSize == 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+
+	return &FrameReader{
+		read:         read,
+		maxFrameSize: maxFrameSize,
+	}
+}
+
+// ReadFrame returns the next frame.
+func (r *FrameReader) ReadFrame() (*Frame, error) {
+	for {
+		f, err := r.parse()
+		if err != nil {
+			return nil, err
+		}
+
+		if f != nil {
+			return f, nil
+		}
+
+		if len(r.buf) > r.maxFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+
+		data, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+
+		r.buf = append(r.buf, data...)
+	}
+}
+
+// parse continues parsing the frame at the start of buf.
+// It returns a nil frame if buf doesn't hold a whole frame yet.
+func (r *FrameReader) parse() (*Frame, error) {
+	if r.frame == nil {
+		if r.scanned == 0 {
+			r.buf = bytes.TrimLeft(r.buf, "\r\n")
+		}
+
+		if err := r.parseHeaders(); err != nil || r.frame == nil {
+			return nil, err
+		}
+	}
+
+	end := -1
+	if r.length >= 0 {
+		if len(r.buf)-r.body <= r.length {
+			return nil, nil
+		}
+
+		end = r.body + r.length
+		if r.buf[end] != 0 {
+			return nil, ErrMalformedFrame
+		}
+	} else {
+		i := bytes.IndexByte(r.buf[r.scanned:], 0)
+		if i < 0 {
+			r.scanned = len(r.buf)
+			return nil, nil
+		}
+		end = r.scanned + i
+	}
+
+	f := r.frame
+	f.Body = append([]byte(nil), r.buf[r.body:end]...)
+
+	r.buf = r.buf[end+1:]
+	r.frame = nil
+	r.scanned = 0
+
+	return f, nil
+}
+
+// parseHeaders looks for the blank line that ends the headers, from the line after the
+// last one searched, and parses the command and the headers once it is found.
+func (r *FrameReader) parseHeaders() error {
+	for {
+		line, next, ok := readLine(r.buf, r.scanned)
+		if !ok {
+			return nil
+		}
+
+		if line == "" && r.scanned > 0 {
+			f, length, err := parseHeaders(r.buf[:r.scanned])
+			if err != nil {
+				return err
+			}
+
+			if length > r.maxFrameSize {
+				return ErrFrameTooLarge
+			}
+
+			r.frame, r.body, r.length, r.scanned = f, next, length, next
+			return nil
+		}
+
+		r.scanned = next
+	}
+}
+
+// parseHeaders parses the command and header lines of a frame.
+// It returns the content-length header, or -1 if the frame has none.
+func parseHeaders(buf []byte) (*Frame, int, error) {
+	command, pos, _ := readLine(buf, 0)
+
+	f := &Frame{
+		Command: command,
+		Headers: make(map[string]string),
+	}
+	unescape := command != CommandConnect && command != CommandConnected
+
+	for pos < len(buf) {
+		var line string
+		line, pos, _ = readLine(buf, pos)
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, 0, ErrMalformedFrame
+		}
+
+		if unescape {
+			var err error
+			if name, err = unescapeHeader(name); err != nil {
+				return nil, 0, err
+			}
+			if value, err = unescapeHeader(value); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if _, ok := f.Headers[name]; !ok {
+			f.Headers[name] = value
+		}
+	}
+
+	value, ok := f.Headers["content-length"]
+	if !ok {
+		return f, -1, nil
+	}
+
+	length, err := strconv.Atoi(value)
+	if err != nil || length < 0 {
+		return nil, 0, ErrMalformedFrame
+	}
+
+	return f, length, nil
+}
+
+// readLine returns the line starting at pos without its end-of-line, and the position after it.
+func readLine(buf []byte, pos int) (string, int, bool) {
+	i := bytes.IndexByte(buf[pos:], '\n')
+	if i < 0 {
+		return "", 0, false
+	}
+
+	line := buf[pos : pos+i]
+	return string(bytes.TrimSuffix(line, []byte("\r"))), pos + i + 1, true
+}
+
+var headerEscaper = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+
+func escapeHeader(s string) string {
+	return headerEscaper.Replace(s)
+}
+
+func unescapeHeader(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return "", ErrMalformedFrame
+		}
+
+		switch s[i] {
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		case 'c':
+			b.WriteByte(':')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			return "", ErrMalformedFrame
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,538 @@
+package stomp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metinorak/varto"
+)
+
+// Version is the STOMP version spoken by the server.
+const Version = "1.2"
+
+// Options configures STOMP sessions.
+type Options struct {
+	// Authenticate checks the headers of the CONNECT frame, such as login and passcode.
+	// It gets the connection of the session, so it can set its attributes with Varto.SetAttr.
+	// If it returns an error, the session is closed with an ERROR frame.
+	Authenticate func(conn varto.Connection, headers map[string]string) error
+
+	// SendHeartBeat is the smallest interval the server can send heart-beats at.
+	// If it is zero, the server doesn't send heart-beats.
+	SendHeartBeat time.Duration
+
+	// ReceiveHeartBeat is the interval the server wants to receive heart-beats at.
+	// If it is zero, the server doesn't expect heart-beats.
+	ReceiveHeartBeat time.Duration
+
+	// MaxFrameSize is the maximum size of a received frame.
+	// If it is zero, DefaultMaxFrameSize is used.
+	MaxFrameSize int
+
+	// Wrap returns the connection added to the Varto in place of a session, such as Heartbeat.Track.
+	// Received frames are recorded as activity with varto.Touch.
+	Wrap func(conn varto.Connection) varto.Connection
+}
+
+// Serve speaks STOMP over a transport connection until the client disconnects or
+// the transport fails. The session is added to v as a connection once the client
+// has connected, so its subscriptions and publishes go through the middleware of v.
+// If the transport implements io.Closer, it is closed when a heart-beat is missed.
+// It returns nil if the client sends DISCONNECT or the transport returns io.EOF.
+func Serve(v *varto.Varto, transport varto.Connection, opts *Options) error {
+	s := newSession(v, transport, opts)
+	defer s.stop()
+	defer func() {
+		if s.isConnected() {
+			v.RemoveConnection(s.wrapped)
+		}
+	}()
+
+	for {
+		f, err := s.reader.ReadFrame()
+		if err != nil {
+			if s.timedOut.Load() {
+				return ErrHeartBeatTimeout
+			}
+
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			if errors.Is(err, ErrMalformedFrame) || errors.Is(err, ErrFrameTooLarge) {
+				s.writeError(nil, err)
+			}
+			return err
+		}
+
+		if err := s.handle(f); err != nil {
+			if err == errDisconnected {
+				return nil
+			}
+
+			s.writeError(f, err)
+			return err
+		}
+	}
+}
+
+var errDisconnected = errors.New("disconnected")
+
+type subscription struct {
+	destination string
+	ack         string
+}
+
+// session is the varto connection of a STOMP client.
+type session struct {
+	v         *varto.Varto
+	transport varto.Connection
+	opts      Options
+	reader    *FrameReader
+
+	// wrapped is the connection of the session in the Varto: the session, or the connection
+	// Options.Wrap returned for it.
+	wrapped varto.Connection
+
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	connected     bool
+	subscriptions map[string]subscription
+	byDestination map[string]map[string]bool
+
+	nextMessageId atomic.Uint64
+	lastRead      atomic.Int64
+	timedOut      atomic.Bool
+	done          chan struct{}
+	stopOnce      sync.Once
+}
+
+func newSession(v *varto.Varto, transport varto.Connection, opts *Options) *session {
+	s := &session{
+		v:             v,
+		transport:     transport,
+		subscriptions: make(map[string]subscription),
+		byDestination: make(map[string]map[string]bool),
+		done:          make(chan struct{}),
+	}
+
+	if opts != nil {
+		s.opts = *opts
+	}
+
+	s.wrapped = s
+	if s.opts.Wrap != nil {
+		s.wrapped = s.opts.Wrap(s)
+	}
+
+	s.lastRead.Store(time.Now().UnixNano())
+	s.reader = NewFrameReader(func() ([]byte, error) {
+		data, err := transport.Read()
+		s.lastRead.Store(time.Now().UnixNano())
+		if err == nil {
+			varto.Touch(s.wrapped)
+		}
+		return data, err
+	}, s.opts.MaxFrameSize)
+
+	return s
+}
+
+func (s *session) GetId() string {
+	return s.transport.GetId()
+}
+
+// Close closes the transport if it implements io.Closer, which ends the session.
+func (s *session) Close() error {
+	if closer, ok := s.transport.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Read blocks until the session ends, since frames are read by Serve.
+func (s *session) Read() ([]byte, error) {
+	<-s.done
+	return nil, io.EOF
+}
+
+// Write sends data that is not published to a topic, such as a broadcast,
+// as a MESSAGE frame without a subscription. It is dropped until the client has connected.
+func (s *session) Write(data []byte) error {
+	if !s.isConnected() {
+		return nil
+	}
+
+	return s.writeFrame(&Frame{
+		Command: CommandMessage,
+		Headers: map[string]string{
+			"message-id":     s.newMessageId(),
+			"content-length": strconv.Itoa(len(data)),
+		},
+		Body: data,
+	})
+}
+
+// WriteMessage sends a MESSAGE frame for each subscription of the client to the topic of the message.
+func (s *session) WriteMessage(msg varto.Message) error {
+	s.mu.Lock()
+	var frames []*Frame
+	for id := range s.byDestination[msg.Topic] {
+		headers := make(map[string]string, len(msg.Headers)+5)
+		for name, value := range msg.Headers {
+			headers[name] = value
+		}
+
+		messageId := s.newMessageId()
+		headers["subscription"] = id
+		headers["message-id"] = messageId
+		headers["destination"] = msg.Topic
+		headers["content-length"] = strconv.Itoa(len(msg.Data))
+		if s.subscriptions[id].ack != "auto" {
+			headers["ack"] = messageId
+		}
+
+		frames = append(frames, &Frame{Command: CommandMessage, Headers: headers, Body: msg.Data})
+	}
+	s.mu.Unlock()
+
+	for _, f := range frames {
+		if err := s.writeFrame(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *session) isConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connected
+}
+
+func (s *session) handle(f *Frame) error {
+	connected := s.isConnected()
+
+	if f.Command == CommandConnect || f.Command == CommandStomp {
+		if connected {
+			return fmt.Errorf("%w: already connected", ErrMalformedFrame)
+		}
+
+		return s.connect(f)
+	}
+
+	if !connected {
+		return ErrNotConnected
+	}
+
+	var err error
+	switch f.Command {
+	case CommandSend:
+		err = s.send(f)
+	case CommandSubscribe:
+		err = s.subscribe(f)
+	case CommandUnsubscribe:
+		err = s.unsubscribe(f)
+	case CommandAck, CommandNack:
+		_, err = header(f, "id")
+	case CommandBegin, CommandCommit, CommandAbort:
+		_, err = header(f, "transaction")
+	case CommandDisconnect:
+		s.writeReceipt(f)
+		return errDisconnected
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownCommand, f.Command)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.writeReceipt(f)
+}
+
+func (s *session) connect(f *Frame) error {
+	if !versionSupported(f.Headers["accept-version"]) {
+		return fmt.Errorf("%w: supported versions are %s", ErrUnsupportedVersion, Version)
+	}
+
+	if s.opts.Authenticate != nil {
+		if err := s.opts.Authenticate(s.wrapped, f.Headers); err != nil {
+			return err
+		}
+	}
+
+	if err := s.v.AddConnection(s.wrapped); err != nil {
+		return err
+	}
+
+	cx, cy := parseHeartBeat(f.Headers["heart-beat"])
+	send := negotiate(s.opts.SendHeartBeat, cy)
+	receive := negotiate(s.opts.ReceiveHeartBeat, cx)
+
+	err := s.writeFrame(&Frame{
+		Command: CommandConnected,
+		Headers: map[string]string{
+			"version":    Version,
+			"heart-beat": fmt.Sprintf("%d,%d", s.opts.SendHeartBeat.Milliseconds(), s.opts.ReceiveHeartBeat.Milliseconds()),
+			"session":    s.GetId(),
+		},
+	})
+	if err != nil {
+		s.v.RemoveConnection(s.wrapped)
+		return err
+	}
+
+	// Writes are dropped until now, so that the CONNECTED frame is the first one the client gets.
+	s.mu.Lock()
+	s.connected = true
+	s.mu.Unlock()
+
+	s.startHeartBeats(send, receive)
+	return nil
+}
+
+func (s *session) send(f *Frame) error {
+	destination, err := header(f, "destination")
+	if err != nil {
+		return err
+	}
+
+	headers := make(map[string]string)
+	for name, value := range f.Headers {
+		switch name {
+		case "destination", "content-length", "receipt", "transaction":
+		default:
+			headers[name] = value
+		}
+	}
+
+	// A destination without subscribers is not an error in STOMP; the message is just dropped.
+	err = s.v.PublishMessageFrom(s.wrapped, varto.Message{Topic: destination, Data: f.Body, Headers: headers})
+	if errors.Is(err, varto.ErrTopicNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *session) subscribe(f *Frame) error {
+	id, err := header(f, "id")
+	if err != nil {
+		return err
+	}
+
+	destination, err := header(f, "destination")
+	if err != nil {
+		return err
+	}
+
+	ack := f.Headers["ack"]
+	switch ack {
+	case "":
+		ack = "auto"
+	case "auto", "client", "client-individual":
+	default:
+		return fmt.Errorf("%w: invalid ack mode %s", ErrMalformedFrame, ack)
+	}
+
+	s.mu.Lock()
+	if _, ok := s.subscriptions[id]; ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: subscription %s already exists", ErrMalformedFrame, id)
+	}
+	s.mu.Unlock()
+
+	if err := s.v.Subscribe(s.wrapped, destination); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscriptions[id] = subscription{destination: destination, ack: ack}
+	if s.byDestination[destination] == nil {
+		s.byDestination[destination] = make(map[string]bool)
+	}
+	s.byDestination[destination][id] = true
+
+	return nil
+}
+
+func (s *session) unsubscribe(f *Frame) error {
+	id, err := header(f, "id")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownSubscription, id)
+	}
+
+	delete(s.subscriptions, id)
+	delete(s.byDestination[sub.destination], id)
+	last := len(s.byDestination[sub.destination]) == 0
+	if last {
+		delete(s.byDestination, sub.destination)
+	}
+	s.mu.Unlock()
+
+	if last {
+		return s.v.Unsubscribe(s.wrapped, sub.destination)
+	}
+
+	return nil
+}
+
+func (s *session) writeReceipt(f *Frame) error {
+	receipt, ok := f.Headers["receipt"]
+	if !ok {
+		return nil
+	}
+
+	return s.writeFrame(&Frame{
+		Command: CommandReceipt,
+		Headers: map[string]string{"receipt-id": receipt},
+	})
+}
+
+// writeError sends an ERROR frame for an error caused by a frame, if any.
+func (s *session) writeError(f *Frame, err error) {
+	headers := map[string]string{
+		"message":      strings.ReplaceAll(err.Error(), "\n", " "),
+		"content-type": "text/plain",
+	}
+
+	var body []byte
+	if f != nil {
+		if receipt, ok := f.Headers["receipt"]; ok {
+			headers["receipt-id"] = receipt
+		}
+
+		body = []byte("failed frame: " + f.Command)
+	}
+	headers["content-length"] = strconv.Itoa(len(body))
+
+	s.writeFrame(&Frame{Command: CommandError, Headers: headers, Body: body})
+}
+
+func (s *session) writeFrame(f *Frame) error {
+	return s.writeRaw(f.Bytes())
+}
+
+func (s *session) writeRaw(data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return s.transport.Write(data)
+}
+
+// startHeartBeats sends heart-beats and checks the received ones at the negotiated intervals.
+// A missed heart-beat is only reported after twice the interval, to allow for delays.
+func (s *session) startHeartBeats(send time.Duration, receive time.Duration) {
+	if send > 0 {
+		go func() {
+			ticker := time.NewTicker(send)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-s.done:
+					return
+				case <-ticker.C:
+					s.writeRaw([]byte("\n"))
+				}
+			}
+		}()
+	}
+
+	if receive > 0 {
+		go func() {
+			ticker := time.NewTicker(receive)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-s.done:
+					return
+				case <-ticker.C:
+					if time.Since(time.Unix(0, s.lastRead.Load())) > 2*receive {
+						s.timedOut.Store(true)
+						if closer, ok := s.transport.(io.Closer); ok {
+							closer.Close()
+						}
+						return
+					}
+				}
+			}
+		}()
+	}
+}
+
+func (s *session) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *session) newMessageId() string {
+	return strconv.FormatUint(s.nextMessageId.Add(1), 10)
+}
+
+func header(f *Frame, name string) (string, error) {
+	value, ok := f.Headers[name]
+	if !ok || value == "" {
+		return "", fmt.Errorf("%w: %s", ErrMissingHeader, name)
+	}
+
+	return value, nil
+}
+
+func versionSupported(acceptVersion string) bool {
+	for _, version := range strings.Split(acceptVersion, ",") {
+		if strings.TrimSpace(version) == Version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseHeartBeat parses a heart-beat header into the intervals the sender
+// can send at and wants to receive at.
+func parseHeartBeat(value string) (time.Duration, time.Duration) {
+	send, receive, ok := strings.Cut(value, ",")
+	if !ok {
+		return 0, 0
+	}
+
+	x, err1 := strconv.Atoi(strings.TrimSpace(send))
+	y, err2 := strconv.Atoi(strings.TrimSpace(receive))
+	if err1 != nil || err2 != nil || x < 0 || y < 0 {
+		return 0, 0
+	}
+
+	return time.Duration(x) * time.Millisecond, time.Duration(y) * time.Millisecond
+}
+
+// negotiate returns the interval of heart-beats one side sends and the other expects,
+// which is zero if either side doesn't want them.
+func negotiate(own time.Duration, peer time.Duration) time.Duration {
+	if own == 0 || peer == 0 {
+		return 0
+	}
+
+	return max(own, peer)
+}
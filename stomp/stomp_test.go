@@ -0,0 +1,320 @@
+package stomp_test
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/stomp"
+	"github.com/stretchr/testify/assert"
+)
+
+// pipeConnection is an in-memory transport. The test writes the client frames to in
+// and reads the server frames from out.
+type pipeConnection struct {
+	id        string
+	in        chan []byte
+	out       chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeConnection(id string) *pipeConnection {
+	return &pipeConnection{
+		id:     id,
+		in:     make(chan []byte, 16),
+		out:    make(chan []byte, 16),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *pipeConnection) GetId() string {
+	return c.id
+}
+
+func (c *pipeConnection) Read() ([]byte, error) {
+	select {
+	case data := <-c.in:
+		return data, nil
+	case <-c.closed:
+		return nil, io.EOF
+	}
+}
+
+func (c *pipeConnection) Write(data []byte) error {
+	c.out <- data
+	return nil
+}
+
+func (c *pipeConnection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+func TestServe(t *testing.T) {
+	start := func(t *testing.T, v *varto.Varto, opts *stomp.Options) (*pipeConnection, *stomp.FrameReader, chan error) {
+		conn := newPipeConnection(fmt.Sprintf("conn-%p", t))
+		served := make(chan error, 1)
+		go func() {
+			served <- stomp.Serve(v, conn, opts)
+		}()
+		t.Cleanup(func() { conn.Close() })
+
+		reader := stomp.NewFrameReader(func() ([]byte, error) {
+			select {
+			case data := <-conn.out:
+				return data, nil
+			case <-time.After(time.Second):
+				return nil, fmt.Errorf("no frame received")
+			}
+		}, 0)
+
+		return conn, reader, served
+	}
+
+	send := func(conn *pipeConnection, command string, headers map[string]string, body string) {
+		f := &stomp.Frame{Command: command, Headers: headers, Body: []byte(body)}
+		conn.in <- f.Bytes()
+	}
+
+	connect := func(t *testing.T, conn *pipeConnection, reader *stomp.FrameReader) {
+		send(conn, stomp.CommandConnect, map[string]string{"accept-version": "1.1,1.2", "host": "varto"}, "")
+
+		f, err := reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, stomp.CommandConnected, f.Command)
+		assert.Equal(t, "1.2", f.Headers["version"])
+	}
+
+	t.Run("TestServe_WhenClientSubscribes_ThenSendMessageFrames", func(t *testing.T) {
+		v := varto.New(nil)
+		conn, reader, _ := start(t, v, nil)
+		connect(t, conn, reader)
+
+		send(conn, stomp.CommandSubscribe, map[string]string{"id": "0", "destination": "topic", "receipt": "r1"}, "")
+		f, err := reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, &stomp.Frame{Command: stomp.CommandReceipt, Headers: map[string]string{"receipt-id": "r1"}}, f)
+
+		v.PublishMessage(varto.Message{Topic: "topic", Data: []byte("da\x00ta"), Headers: map[string]string{"key": "a:b"}})
+
+		f, err = reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, stomp.CommandMessage, f.Command)
+		assert.Equal(t, "0", f.Headers["subscription"])
+		assert.Equal(t, "topic", f.Headers["destination"])
+		assert.Equal(t, "a:b", f.Headers["key"])
+		assert.Equal(t, []byte("da\x00ta"), f.Body)
+	})
+
+	t.Run("TestServe_WhenClientSends_ThenPublishToSubscribers", func(t *testing.T) {
+		v := varto.New(nil)
+		ch, cancel, _ := v.SubscribeChan("topic", 1)
+		defer cancel()
+		conn, reader, _ := start(t, v, nil)
+		connect(t, conn, reader)
+
+		f := &stomp.Frame{Command: stomp.CommandSend, Headers: map[string]string{"destination": "topic", "key": "value"}, Body: []byte("data")}
+		data := f.Bytes()
+		conn.in <- data[:5]
+		conn.in <- data[5:]
+
+		select {
+		case msg := <-ch:
+			assert.Equal(t, varto.Message{Topic: "topic", Data: []byte("data"), Headers: map[string]string{"key": "value"}, Id: 1}, msg)
+		case <-time.After(time.Second):
+			t.Fatal("message is not published")
+		}
+	})
+
+	t.Run("TestServe_WhenClientUnsubscribesAndDisconnects_ThenRemoveConnection", func(t *testing.T) {
+		v := varto.New(nil)
+		conn, reader, served := start(t, v, nil)
+		connect(t, conn, reader)
+
+		send(conn, stomp.CommandSubscribe, map[string]string{"id": "0", "destination": "topic"}, "")
+		send(conn, stomp.CommandUnsubscribe, map[string]string{"id": "0"}, "")
+		send(conn, stomp.CommandDisconnect, map[string]string{"receipt": "bye"}, "")
+
+		f, err := reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, "bye", f.Headers["receipt-id"])
+		assert.Nil(t, <-served)
+
+		stats, _ := v.Stats()
+		assert.Equal(t, varto.Stats{}, stats)
+	})
+
+	t.Run("TestServe_WhenFrameIsSentBeforeConnect_ThenSendError", func(t *testing.T) {
+		v := varto.New(nil)
+		conn, reader, served := start(t, v, nil)
+
+		send(conn, stomp.CommandSubscribe, map[string]string{"id": "0", "destination": "topic"}, "")
+
+		f, err := reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, stomp.CommandError, f.Command)
+		assert.Equal(t, stomp.ErrNotConnected, <-served)
+	})
+
+	t.Run("TestServe_WhenMiddlewareRejectsSubscribe_ThenSendErrorWithReceipt", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.OnSubscribeFunc(func(conn varto.Connection, topic string) error {
+			return varto.ErrAccessDenied
+		}))
+		conn, reader, served := start(t, v, nil)
+		connect(t, conn, reader)
+
+		send(conn, stomp.CommandSubscribe, map[string]string{"id": "0", "destination": "topic", "receipt": "r1"}, "")
+
+		f, err := reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, stomp.CommandError, f.Command)
+		assert.Equal(t, "access denied", f.Headers["message"])
+		assert.Equal(t, "r1", f.Headers["receipt-id"])
+		assert.Equal(t, varto.ErrAccessDenied, <-served)
+	})
+
+	t.Run("TestServe_WhenClientHasNotConnected_ThenDoNotAddConnection", func(t *testing.T) {
+		v := varto.New(nil)
+		conn, reader, _ := start(t, v, &stomp.Options{
+			Authenticate: func(conn varto.Connection, headers map[string]string) error {
+				if headers["passcode"] != "secret" {
+					return varto.ErrAccessDenied
+				}
+				return nil
+			},
+		})
+
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(t, v.BroadcastToAll([]byte("data")))
+		stats, _ := v.Stats()
+		assert.Equal(t, 0, stats.Connections)
+
+		send(conn, stomp.CommandConnect, map[string]string{"accept-version": "1.2", "passcode": "secret"}, "")
+		f, err := reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, stomp.CommandConnected, f.Command)
+
+		stats, _ = v.Stats()
+		assert.Equal(t, 1, stats.Connections)
+	})
+
+	t.Run("TestServe_WhenAuthenticationFails_ThenDoNotAddConnection", func(t *testing.T) {
+		v := varto.New(&varto.Options{SystemEvents: true})
+		events, cancel, _ := v.SubscribeChan(varto.SystemTopicConnectionAdded, 1)
+		defer cancel()
+		conn, reader, served := start(t, v, &stomp.Options{
+			Authenticate: func(conn varto.Connection, headers map[string]string) error {
+				return varto.ErrAccessDenied
+			},
+		})
+
+		send(conn, stomp.CommandConnect, map[string]string{"accept-version": "1.2"}, "")
+		f, err := reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, stomp.CommandError, f.Command)
+		assert.Equal(t, varto.ErrAccessDenied, <-served)
+		assert.Empty(t, events)
+	})
+
+	t.Run("TestServe_WhenVersionIsNotSupported_ThenSendError", func(t *testing.T) {
+		v := varto.New(nil)
+		conn, reader, _ := start(t, v, nil)
+
+		send(conn, stomp.CommandConnect, map[string]string{"accept-version": "1.0"}, "")
+
+		f, err := reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, stomp.CommandError, f.Command)
+	})
+
+	t.Run("TestServe_WhenHeartBeatsAreNegotiated_ThenSendThem", func(t *testing.T) {
+		v := varto.New(nil)
+		conn, _, _ := start(t, v, &stomp.Options{SendHeartBeat: 10 * time.Millisecond})
+
+		send(conn, stomp.CommandConnect, map[string]string{"accept-version": "1.2", "heart-beat": "0,10"}, "")
+		<-conn.out
+
+		select {
+		case data := <-conn.out:
+			assert.Equal(t, []byte("\n"), data)
+		case <-time.After(time.Second):
+			t.Fatal("heart-beat is not sent")
+		}
+	})
+
+	t.Run("TestServe_WhenClientMissesHeartBeats_ThenCloseTransport", func(t *testing.T) {
+		v := varto.New(nil)
+		conn, reader, served := start(t, v, &stomp.Options{ReceiveHeartBeat: 10 * time.Millisecond})
+
+		send(conn, stomp.CommandConnect, map[string]string{"accept-version": "1.2", "heart-beat": "10,0"}, "")
+		reader.ReadFrame()
+
+		select {
+		case err := <-served:
+			assert.Equal(t, stomp.ErrHeartBeatTimeout, err)
+		case <-time.After(time.Second):
+			t.Fatal("session is not closed")
+		}
+	})
+}
+
+func TestFrameReader(t *testing.T) {
+	chunks := func(data ...string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			if len(data) == 0 {
+				return nil, io.EOF
+			}
+
+			chunk := data[0]
+			data = data[1:]
+			return []byte(chunk), nil
+		}
+	}
+
+	t.Run("TestFrameReader_WhenContentLengthOverflows_ThenReturnError", func(t *testing.T) {
+		reader := stomp.NewFrameReader(chunks("SEND\ncontent-length:9223372036854775807\n\nbody\x00"), 0)
+
+		f, err := reader.ReadFrame()
+		assert.Nil(t, f)
+		assert.Equal(t, stomp.ErrFrameTooLarge, err)
+	})
+
+	t.Run("TestFrameReader_WhenFrameIsSplitIntoBytes_ThenReadIt", func(t *testing.T) {
+		data := "\nSEND\ndestination:topic\ncontent-length:5\n\na\x00b\nc\x00\n"
+		var split []string
+		for i := range data {
+			split = append(split, data[i:i+1])
+		}
+		reader := stomp.NewFrameReader(chunks(split...), 0)
+
+		f, err := reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, &stomp.Frame{
+			Command: stomp.CommandSend,
+			Headers: map[string]string{"destination": "topic", "content-length": "5"},
+			Body:    []byte("a\x00b\nc"),
+		}, f)
+	})
+
+	t.Run("TestFrameReader_WhenChunkHoldsSeveralFrames_ThenReadEach", func(t *testing.T) {
+		reader := stomp.NewFrameReader(chunks("SEND\n\nfirst\x00\r\nSEND\n\nsec", "ond\x00"), 0)
+
+		f, err := reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, "first", string(f.Body))
+
+		f, err = reader.ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, "second", string(f.Body))
+
+		_, err = reader.ReadFrame()
+		assert.Equal(t, io.EOF, err)
+	})
+}
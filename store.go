@@ -54,10 +54,15 @@ func (s *inMemoryStore) RemoveTopic(topicName string) error {
 }
 
 func (s *inMemoryStore) AddConnection(conn Connection) error {
+	id := conn.GetId()
+	if isReservedConnectionId(id) {
+		return ErrReservedConnectionId
+	}
+
 	s.Lock()
 	defer s.Unlock()
 
-	s.connections[conn.GetId()] = conn
+	s.connections[id] = conn
 
 	return nil
 }
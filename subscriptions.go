@@ -0,0 +1,173 @@
+package varto
+
+import "sync"
+
+// subscriptionIndex keeps track of which connections are subscribed to which topics.
+// Connections are keyed by their id, as in the store.
+type subscriptionIndex struct {
+	sync.RWMutex
+	byTopic  map[string]map[string]Connection
+	byConn   map[string]map[string]bool
+	patterns map[string]bool
+}
+
+func newSubscriptionIndex() *subscriptionIndex {
+	return &subscriptionIndex{
+		byTopic:  make(map[string]map[string]Connection),
+		byConn:   make(map[string]map[string]bool),
+		patterns: make(map[string]bool),
+	}
+}
+
+// Add adds a subscription and reports whether it is a new one.
+func (i *subscriptionIndex) Add(conn Connection, topic string) bool {
+	i.Lock()
+	defer i.Unlock()
+
+	id := conn.GetId()
+	if _, ok := i.byTopic[topic][id]; ok {
+		i.byTopic[topic][id] = conn
+		return false
+	}
+
+	if _, ok := i.byTopic[topic]; !ok {
+		i.byTopic[topic] = make(map[string]Connection)
+
+		if isTopicPattern(topic) {
+			i.patterns[topic] = true
+		}
+	}
+	i.byTopic[topic][id] = conn
+
+	if _, ok := i.byConn[id]; !ok {
+		i.byConn[id] = make(map[string]bool)
+	}
+	i.byConn[id][topic] = true
+	return true
+}
+
+// Remove removes a subscription and reports whether it existed.
+func (i *subscriptionIndex) Remove(conn Connection, topic string) bool {
+	i.Lock()
+	defer i.Unlock()
+
+	id := conn.GetId()
+	if _, ok := i.byTopic[topic][id]; !ok {
+		return false
+	}
+
+	i.remove(id, topic)
+	return true
+}
+
+// RemoveConnection removes every subscription of the connection and returns
+// the topics it was subscribed to.
+func (i *subscriptionIndex) RemoveConnection(conn Connection) []string {
+	i.Lock()
+	defer i.Unlock()
+
+	id := conn.GetId()
+
+	var topics []string
+	for topic := range i.byConn[id] {
+		topics = append(topics, topic)
+	}
+
+	for _, topic := range topics {
+		i.remove(id, topic)
+	}
+
+	return topics
+}
+
+func (i *subscriptionIndex) remove(id string, topic string) {
+	if conns, ok := i.byTopic[topic]; ok {
+		delete(conns, id)
+		if len(conns) == 0 {
+			delete(i.byTopic, topic)
+			delete(i.patterns, topic)
+		}
+	}
+
+	if topics, ok := i.byConn[id]; ok {
+		delete(topics, topic)
+		if len(topics) == 0 {
+			delete(i.byConn, id)
+		}
+	}
+}
+
+// TopicsOf returns the topics the connection is subscribed to.
+func (i *subscriptionIndex) TopicsOf(conn Connection) []string {
+	i.RLock()
+	defer i.RUnlock()
+
+	var topics []string
+	for topic := range i.byConn[conn.GetId()] {
+		topics = append(topics, topic)
+	}
+
+	return topics
+}
+
+// ConnectionsOf returns the connections subscribed to the topic.
+func (i *subscriptionIndex) ConnectionsOf(topic string) []Connection {
+	i.RLock()
+	defer i.RUnlock()
+
+	var connections []Connection
+	for _, conn := range i.byTopic[topic] {
+		connections = append(connections, conn)
+	}
+
+	return connections
+}
+
+// Topics returns the topics that have at least one subscriber.
+func (i *subscriptionIndex) Topics() []string {
+	i.RLock()
+	defer i.RUnlock()
+
+	var topics []string
+	for topic := range i.byTopic {
+		topics = append(topics, topic)
+	}
+
+	return topics
+}
+
+// PatternsMatching returns the wildcard topics with subscribers that receive the messages of a topic.
+func (i *subscriptionIndex) PatternsMatching(topic string) []string {
+	i.RLock()
+	defer i.RUnlock()
+
+	var patterns []string
+	for pattern := range i.patterns {
+		if matchSubscription(pattern, topic) {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns
+}
+
+// Count returns the number of subscribers of the topic.
+func (i *subscriptionIndex) Count(topic string) int {
+	i.RLock()
+	defer i.RUnlock()
+
+	return len(i.byTopic[topic])
+}
+
+// Stats returns the number of topics with subscribers and the total number of subscriptions.
+func (i *subscriptionIndex) Stats() (int, int) {
+	i.RLock()
+	defer i.RUnlock()
+
+	subscriptions := 0
+	for _, conns := range i.byTopic {
+		subscriptions += len(conns)
+	}
+
+	return len(i.byTopic), subscriptions
+}
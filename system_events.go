@@ -0,0 +1,83 @@
+package varto
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// SystemTopicPrefix is the prefix of the topics reserved for system events.
+// Messages can't be published to these topics with Publish.
+const SystemTopicPrefix = "$SYS/"
+
+// Topics system events are published to when Options.SystemEvents is set.
+const (
+	SystemTopicConnectionAdded   = SystemTopicPrefix + "connections/added"
+	SystemTopicConnectionRemoved = SystemTopicPrefix + "connections/removed"
+	SystemTopicTopicCreated      = SystemTopicPrefix + "topics/created"
+	SystemTopicTopicRemoved      = SystemTopicPrefix + "topics/removed"
+	SystemTopicDeliveryError     = SystemTopicPrefix + "delivery/errors"
+)
+
+// SystemEvent is the JSON payload of the messages published to system topics.
+type SystemEvent struct {
+	ConnectionId string `json:"connectionId,omitempty"`
+	Topic        string `json:"topic,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// IsSystemTopic reports whether a topic is reserved for system events.
+func IsSystemTopic(topic string) bool {
+	return strings.HasPrefix(topic, SystemTopicPrefix)
+}
+
+// isReservedTopic reports whether a topic can't be published to,
+// because it is reserved for system or presence events.
+func (v *Varto) isReservedTopic(topic string) bool {
+	return IsSystemTopic(topic) || v.isPresenceTopic(topic)
+}
+
+// publishSystemEvent publishes an event to a system topic if it has subscribers.
+// It bypasses the middleware, since the event is not published by a client.
+func (v *Varto) publishSystemEvent(topic string, event SystemEvent) {
+	if !v.opts.SystemEvents {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	if t, err := v.store.GetTopic(topic); err == nil {
+		deliver(t, Message{Topic: topic, Data: data, Id: v.nextMessageId()})
+	}
+}
+
+func (v *Varto) emitTopicCreated(topic string) {
+	if !IsSystemTopic(topic) {
+		v.publishSystemEvent(SystemTopicTopicCreated, SystemEvent{Topic: topic})
+	}
+}
+
+func (v *Varto) emitTopicRemoved(topic string) {
+	if !IsSystemTopic(topic) {
+		v.publishSystemEvent(SystemTopicTopicRemoved, SystemEvent{Topic: topic})
+	}
+}
+
+func (v *Varto) emitConnectionEvent(topic string, conn Connection) {
+	if v.opts.SystemEvents {
+		v.publishSystemEvent(topic, SystemEvent{ConnectionId: conn.GetId()})
+	}
+}
+
+func (v *Varto) emitDeliveryError(topic string, conn Connection, err error) {
+	// Errors delivering to the delivery errors topic itself are not reported to it again.
+	if v.opts.SystemEvents && topic != SystemTopicDeliveryError {
+		v.publishSystemEvent(SystemTopicDeliveryError, SystemEvent{
+			ConnectionId: conn.GetId(),
+			Topic:        topic,
+			Error:        err.Error(),
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package varto_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSystemEvents(t *testing.T) {
+	subscribe := func(t *testing.T, v *varto.Varto, topic string) chan varto.SystemEvent {
+		events := make(chan varto.SystemEvent, 10)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("observer").AnyTimes()
+		mockConnection.EXPECT().Write(gomock.Any()).DoAndReturn(func(data []byte) error {
+			var event varto.SystemEvent
+			assert.Nil(t, json.Unmarshal(data, &event))
+			events <- event
+			return nil
+		}).AnyTimes()
+
+		assert.Nil(t, v.Subscribe(mockConnection, topic))
+		return events
+	}
+
+	receive := func(t *testing.T, events chan varto.SystemEvent) varto.SystemEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second):
+			t.Fatal("event is not delivered")
+			return varto.SystemEvent{}
+		}
+	}
+
+	t.Run("TestSystemEvents_WhenConnectionIsAddedAndRemoved_ThenPublishEvents", func(t *testing.T) {
+		v := varto.New(&varto.Options{SystemEvents: true})
+		added := subscribe(t, v, varto.SystemTopicConnectionAdded)
+		removed := subscribe(t, v, varto.SystemTopicConnectionRemoved)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.AddConnection(mockConnection)
+		assert.Equal(t, varto.SystemEvent{ConnectionId: "id"}, receive(t, added))
+
+		v.RemoveConnection(mockConnection)
+		assert.Equal(t, varto.SystemEvent{ConnectionId: "id"}, receive(t, removed))
+	})
+
+	t.Run("TestSystemEvents_WhenTopicIsCreatedAndRemoved_ThenPublishEvents", func(t *testing.T) {
+		v := varto.New(&varto.Options{SystemEvents: true})
+		created := subscribe(t, v, varto.SystemTopicTopicCreated)
+		removed := subscribe(t, v, varto.SystemTopicTopicRemoved)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Subscribe(mockConnection, "topic")
+		assert.Equal(t, varto.SystemEvent{Topic: "topic"}, receive(t, created))
+
+		v.Unsubscribe(mockConnection, "topic")
+		assert.Equal(t, varto.SystemEvent{Topic: "topic"}, receive(t, removed))
+	})
+
+	t.Run("TestSystemEvents_WhenDeliveryFails_ThenPublishEvent", func(t *testing.T) {
+		v := varto.New(&varto.Options{SystemEvents: true, OnDeliveryError: func(string, varto.Connection, error) {}})
+		errs := subscribe(t, v, varto.SystemTopicDeliveryError)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(fmt.Errorf("error"))
+
+		v.Subscribe(mockConnection, "topic")
+		v.Publish("topic", []byte("data"))
+
+		assert.Equal(t, varto.SystemEvent{ConnectionId: "id", Topic: "topic", Error: "error"}, receive(t, errs))
+	})
+
+	t.Run("TestSystemEvents_WhenDisabled_ThenPublishNothing", func(t *testing.T) {
+		v := varto.New(nil)
+		added := subscribe(t, v, varto.SystemTopicConnectionAdded)
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.AddConnection(mockConnection)
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Len(t, added, 0)
+	})
+
+	t.Run("TestSystemEvents_WhenPublishingToSystemTopic_ThenReturnError", func(t *testing.T) {
+		v := varto.New(&varto.Options{SystemEvents: true})
+		subscribe(t, v, varto.SystemTopicConnectionAdded)
+
+		err := v.Publish(varto.SystemTopicConnectionAdded, []byte("data"))
+		assert.Equal(t, varto.ErrReservedTopic, err)
+	})
+
+	t.Run("TestSystemEvents_WhenMiddlewareRewritesToSystemTopic_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		v.Use(varto.TransformPublishFunc(func(msg *varto.Message) error {
+			msg.Topic = varto.SystemTopicTopicCreated
+			return nil
+		}))
+
+		err := v.Publish("topic", []byte("data"))
+		assert.Equal(t, varto.ErrReservedTopic, err)
+	})
+}
@@ -1,8 +1,11 @@
 package varto
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Topic interface {
@@ -12,18 +15,63 @@ type Topic interface {
 	Publish([]byte)
 }
 
+// TopicHooks lets a topic report what happens while it delivers messages.
+type TopicHooks struct {
+	// OnDeliveryError is called when writing a message to a subscriber fails.
+	OnDeliveryError func(topic string, conn Connection, err error)
+
+	// OnDelivered is called after a message is written to all the subscribers.
+	OnDelivered func(report DeliveryReport)
+
+	// Tracer traces the time messages wait in the queue and each write to a subscriber,
+	// as children of the span found in the message headers.
+	Tracer Tracer
+}
+
+// DeliveryReport describes the delivery of a message to the subscribers of a topic.
+type DeliveryReport struct {
+	Topic string
+
+	// Recipients is the number of subscribers the message was written to.
+	Recipients int
+
+	// Failures is the number of subscribers the message couldn't be written to.
+	Failures int
+
+	// QueueDepth is the number of messages still waiting in the topic queue.
+	QueueDepth int
+
+	// QueueTime is how long the message waited in the topic queue.
+	QueueTime time.Duration
+
+	// Duration is how long it took to write the message to all the subscribers.
+	Duration time.Duration
+}
+
+// HookableTopic is an optional interface for topics that accept hooks.
+// Varto sets its hooks on the topics it creates through the store.
+type HookableTopic interface {
+	SetHooks(hooks TopicHooks)
+}
+
 type topic struct {
 	sync.RWMutex
 	name        string
 	connections map[string]Connection
-	Channel     chan []byte
+	hooks       TopicHooks
+	Channel     chan queuedMessage
+}
+
+type queuedMessage struct {
+	msg      Message
+	queuedAt time.Time
 }
 
 func NewTopic(name string) Topic {
 	t := &topic{
 		name:        name,
 		connections: make(map[string]Connection),
-		Channel:     make(chan []byte, 100),
+		Channel:     make(chan queuedMessage, 100),
 	}
 
 	go t.listen()
@@ -45,6 +93,23 @@ func (t *topic) Unsubscribe(conn Connection) {
 	delete(t.connections, conn.GetId())
 }
 
+// connectionReplacer is implemented by topics that can replace a subscriber with another one atomically.
+type connectionReplacer interface {
+	replace(old Connection, new Connection)
+}
+
+func (t *topic) replace(old Connection, new Connection) {
+	t.Lock()
+	defer t.Unlock()
+
+	if _, ok := t.connections[old.GetId()]; !ok {
+		return
+	}
+
+	delete(t.connections, old.GetId())
+	t.connections[new.GetId()] = new
+}
+
 func (t *topic) IsEmpty() bool {
 	t.RLock()
 	defer t.RUnlock()
@@ -52,25 +117,63 @@ func (t *topic) IsEmpty() bool {
 	return len(t.connections) == 0
 }
 
+func (t *topic) SetHooks(hooks TopicHooks) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.hooks = hooks
+}
+
 func (t *topic) Publish(data []byte) {
-	t.Channel <- data
+	t.PublishMessage(Message{Topic: t.name, Data: data})
+}
+
+func (t *topic) PublishMessage(msg Message) {
+	t.Channel <- queuedMessage{msg: msg, queuedAt: time.Now()}
 }
 
 func (t *topic) listen() {
-	for data := range t.Channel {
-		if err := t.publish(data); err != nil {
-			fmt.Println(err)
+	for item := range t.Channel {
+		t.RLock()
+		hooks := t.hooks
+		t.RUnlock()
+
+		tracer := hooks.Tracer
+		if tracer == nil {
+			tracer = noopTracer{}
+		}
+
+		ctx := tracer.Extract(context.Background(), item.msg.Headers)
+		_, span := tracer.Start(ctx, SpanQueue, item.queuedAt)
+		span.SetAttribute("topic", t.name)
+		span.End(nil)
+
+		report := DeliveryReport{
+			Topic:      t.name,
+			QueueDepth: len(t.Channel),
+			QueueTime:  time.Since(item.queuedAt),
+		}
+
+		start := time.Now()
+		t.publish(ctx, tracer, hooks, item.msg, &report)
+		report.Duration = time.Since(start)
+
+		if hooks.OnDelivered != nil {
+			hooks.OnDelivered(report)
 		}
 	}
 }
 
-func (t *topic) publish(data []byte) error {
+func (t *topic) publish(ctx context.Context, tracer Tracer, hooks TopicHooks, msg Message, report *DeliveryReport) {
 	t.RLock()
-	connections := t.connections
+	connections := make([]Connection, 0, len(t.connections))
+	for _, conn := range t.connections {
+		connections = append(connections, conn)
+	}
 	t.RUnlock()
 
 	wg := sync.WaitGroup{}
-	chErr := make(chan error)
+	var failures atomic.Int64
 
 	for _, conn := range connections {
 		wg.Add(1)
@@ -78,19 +181,28 @@ func (t *topic) publish(data []byte) error {
 		go func(c Connection) {
 			defer wg.Done()
 
-			if err := c.Write(data); err != nil {
-				chErr <- err
+			_, span := tracer.Start(ctx, SpanWrite, time.Now())
+			if hooks.Tracer != nil {
+				span.SetAttribute("connection_id", c.GetId())
+			}
+
+			err := writeMessage(c, msg)
+			span.End(err)
+
+			if err != nil {
+				failures.Add(1)
+
+				if hooks.OnDeliveryError != nil {
+					hooks.OnDeliveryError(t.name, c, err)
+				} else {
+					fmt.Println(err)
+				}
 			}
 		}(conn)
 	}
 
 	wg.Wait()
 
-	select {
-	case err := <-chErr:
-		return err
-	default:
-	}
-
-	return nil
+	report.Failures = int(failures.Load())
+	report.Recipients = len(connections) - report.Failures
 }
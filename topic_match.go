@@ -0,0 +1,123 @@
+package varto
+
+import "strings"
+
+// TopicLevelSeparator separates the levels of a topic name.
+const TopicLevelSeparator = "/"
+
+// matchTopic reports whether a topic matches a pattern.
+// In a pattern, "+" matches exactly one level and "#", which must be the last level,
+// matches any number of remaining levels, including none.
+func matchTopic(pattern string, topic string) bool {
+	patternLevels := strings.Split(pattern, TopicLevelSeparator)
+	topicLevels := strings.Split(topic, TopicLevelSeparator)
+
+	for i, level := range patternLevels {
+		if level == "#" {
+			return i == len(patternLevels)-1
+		}
+
+		if i >= len(topicLevels) {
+			return false
+		}
+
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+
+	return len(patternLevels) == len(topicLevels)
+}
+
+// topicPatternsOverlap reports whether some topic matches both patterns.
+func topicPatternsOverlap(a string, b string) bool {
+	aLevels := strings.Split(a, TopicLevelSeparator)
+	bLevels := strings.Split(b, TopicLevelSeparator)
+
+	for i := 0; ; i++ {
+		if (i < len(aLevels) && aLevels[i] == "#") || (i < len(bLevels) && bLevels[i] == "#") {
+			return true
+		}
+
+		if i == len(aLevels) || i == len(bLevels) {
+			return len(aLevels) == len(bLevels)
+		}
+
+		if aLevels[i] != "+" && bLevels[i] != "+" && aLevels[i] != bLevels[i] {
+			return false
+		}
+	}
+}
+
+// topicPatternCovers reports whether every topic that matches filter also matches pattern.
+func topicPatternCovers(pattern string, filter string) bool {
+	patternLevels := strings.Split(pattern, TopicLevelSeparator)
+	filterLevels := strings.Split(filter, TopicLevelSeparator)
+
+	for i := 0; ; i++ {
+		if i < len(patternLevels) && patternLevels[i] == "#" {
+			return true
+		}
+
+		if i == len(patternLevels) || i == len(filterLevels) {
+			return len(patternLevels) == len(filterLevels)
+		}
+
+		if filterLevels[i] == "#" || (filterLevels[i] == "+" && patternLevels[i] != "+") {
+			return false
+		}
+
+		if patternLevels[i] != "+" && patternLevels[i] != filterLevels[i] {
+			return false
+		}
+	}
+}
+
+// isTopicPattern reports whether a topic name contains wildcards.
+func isTopicPattern(topic string) bool {
+	return strings.ContainsAny(topic, "+#")
+}
+
+// validTopicPattern reports whether the wildcards of a pattern each take up a whole level,
+// and "#" is only used as the last level.
+func validTopicPattern(pattern string) bool {
+	levels := strings.Split(pattern, TopicLevelSeparator)
+	for i, level := range levels {
+		if level == "+" || (level == "#" && i == len(levels)-1) {
+			continue
+		}
+
+		if isTopicPattern(level) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchSubscription reports whether a wildcard subscription receives the messages of a topic.
+// Like matchTopic, except that a pattern starting with a wildcard doesn't match
+// topics starting with "$", such as the system topics.
+func matchSubscription(pattern string, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(pattern, "+") || strings.HasPrefix(pattern, "#")) {
+		return false
+	}
+
+	return matchTopic(pattern, topic)
+}
+
+// MatchTopic reports whether a topic matches a subscription pattern,
+// as messages are delivered with Options.WildcardSubscriptions.
+func MatchTopic(pattern string, topic string) bool {
+	return matchSubscription(pattern, topic)
+}
+
+// MatchTopic reports whether the subscribers of a topic or pattern receive the messages of a topic.
+// Unlike the MatchTopic function, it only treats wildcards as such with Options.WildcardSubscriptions.
+func (v *Varto) MatchTopic(pattern string, topic string) bool {
+	if pattern == topic {
+		return true
+	}
+
+	return v.opts.WildcardSubscriptions && isTopicPattern(pattern) && matchSubscription(pattern, topic)
+}
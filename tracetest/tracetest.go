@@ -0,0 +1,146 @@
+// Package tracetest provides an in-memory varto.Tracer for testing the spans of publishes.
+package tracetest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metinorak/varto"
+)
+
+// TraceParentHeader is the message header the span context is propagated in,
+// in the W3C traceparent format.
+const TraceParentHeader = "traceparent"
+
+// SpanRecord is a span recorded by a Recorder.
+type SpanRecord struct {
+	Name       string
+	TraceId    string
+	SpanId     string
+	ParentId   string
+	Attributes map[string]any
+	Start      time.Time
+	End        time.Time
+	Err        error
+}
+
+type spanContext struct {
+	traceId string
+	spanId  string
+}
+
+type spanContextKey struct{}
+
+// Recorder is a varto.Tracer that keeps the ended spans in memory.
+type Recorder struct {
+	sync.Mutex
+	nextId uint64
+	spans  []SpanRecord
+}
+
+// NewRecorder returns a new Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Start(ctx context.Context, name string, start time.Time) (context.Context, varto.Span) {
+	r.Lock()
+	r.nextId++
+	id := r.nextId
+	r.Unlock()
+
+	record := SpanRecord{
+		Name:       name,
+		SpanId:     fmt.Sprintf("%016x", id),
+		Attributes: make(map[string]any),
+		Start:      start,
+	}
+
+	if parent, ok := ctx.Value(spanContextKey{}).(spanContext); ok {
+		record.TraceId = parent.traceId
+		record.ParentId = parent.spanId
+	} else {
+		record.TraceId = fmt.Sprintf("%032x", id)
+	}
+
+	ctx = context.WithValue(ctx, spanContextKey{}, spanContext{traceId: record.TraceId, spanId: record.SpanId})
+	return ctx, &span{recorder: r, record: record}
+}
+
+func (r *Recorder) Inject(ctx context.Context, headers map[string]string) {
+	if sc, ok := ctx.Value(spanContextKey{}).(spanContext); ok {
+		headers[TraceParentHeader] = fmt.Sprintf("00-%s-%s-01", sc.traceId, sc.spanId)
+	}
+}
+
+func (r *Recorder) Extract(ctx context.Context, headers map[string]string) context.Context {
+	parts := strings.Split(headers[TraceParentHeader], "-")
+	if len(parts) != 4 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, spanContextKey{}, spanContext{traceId: parts[1], spanId: parts[2]})
+}
+
+// Spans returns the ended spans in the order they ended.
+func (r *Recorder) Spans() []SpanRecord {
+	r.Lock()
+	defer r.Unlock()
+
+	return append([]SpanRecord(nil), r.spans...)
+}
+
+// SpansNamed returns the ended spans with the given name.
+func (r *Recorder) SpansNamed(name string) []SpanRecord {
+	var spans []SpanRecord
+	for _, s := range r.Spans() {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+
+	return spans
+}
+
+// Reset removes all the recorded spans.
+func (r *Recorder) Reset() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.spans = nil
+}
+
+type span struct {
+	sync.Mutex
+	recorder *Recorder
+	record   SpanRecord
+	ended    bool
+}
+
+func (s *span) SetAttribute(key string, value any) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.record.Attributes[key] = value
+}
+
+func (s *span) End(err error) {
+	s.Lock()
+	if s.ended {
+		s.Unlock()
+		return
+	}
+	s.ended = true
+	s.record.End = time.Now()
+	s.record.Err = err
+	record := s.record
+	s.Unlock()
+
+	s.recorder.Lock()
+	defer s.recorder.Unlock()
+
+	s.recorder.spans = append(s.recorder.spans, record)
+}
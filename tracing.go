@@ -0,0 +1,54 @@
+package varto
+
+import (
+	"context"
+	"time"
+)
+
+// Names of the spans Varto starts.
+const (
+	SpanPublish    = "varto.publish"
+	SpanMiddleware = "varto.middleware"
+	SpanQueue      = "varto.queue"
+	SpanWrite      = "varto.write"
+)
+
+// Tracer starts spans for the stages of publishing and delivering a message.
+// The publish span is propagated to the delivery spans through the message headers.
+type Tracer interface {
+	// Start starts a span at the given time as a child of the span in ctx,
+	// and returns a context that contains the new span.
+	Start(ctx context.Context, name string, start time.Time) (context.Context, Span)
+
+	// Inject writes the span in ctx into the message headers.
+	Inject(ctx context.Context, headers map[string]string)
+
+	// Extract reads a span from the message headers and returns a context that contains it.
+	Extract(ctx context.Context, headers map[string]string) context.Context
+}
+
+// Span is a traced stage of publishing or delivering a message.
+type Span interface {
+	SetAttribute(key string, value any)
+
+	// End ends the span with the error of the stage, if any.
+	End(err error)
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, start time.Time) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopTracer) Inject(ctx context.Context, headers map[string]string) {}
+
+func (noopTracer) Extract(ctx context.Context, headers map[string]string) context.Context {
+	return ctx
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value any) {}
+
+func (noopSpan) End(err error) {}
@@ -0,0 +1,93 @@
+package varto_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/metinorak/varto/tracetest"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestTracing(t *testing.T) {
+	t.Run("TestTracing_WhenMessageIsDelivered_ThenRecordSpanTree", func(t *testing.T) {
+		recorder := tracetest.NewRecorder()
+		v := varto.New(&varto.Options{Tracer: recorder})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
+		mockConnection.EXPECT().Write([]byte("data")).Return(nil)
+
+		v.Subscribe(mockConnection, "topic")
+		err := v.Publish("topic", []byte("data"))
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+
+		publish := recorder.SpansNamed(varto.SpanPublish)
+		assert.Len(t, publish, 1)
+		assert.Equal(t, "", publish[0].ParentId)
+		assert.Equal(t, "topic", publish[0].Attributes["topic"])
+		assert.Equal(t, 1, publish[0].Attributes["recipients"])
+
+		for _, name := range []string{varto.SpanMiddleware, varto.SpanQueue, varto.SpanWrite} {
+			spans := recorder.SpansNamed(name)
+			assert.Len(t, spans, 1, name)
+			assert.Equal(t, publish[0].TraceId, spans[0].TraceId, name)
+			assert.Equal(t, publish[0].SpanId, spans[0].ParentId, name)
+		}
+
+		assert.Equal(t, "id", recorder.SpansNamed(varto.SpanWrite)[0].Attributes["connection_id"])
+	})
+
+	t.Run("TestTracing_WhenContextHasSpan_ThenPublishSpanIsItsChild", func(t *testing.T) {
+		recorder := tracetest.NewRecorder()
+		v := varto.New(&varto.Options{Tracer: recorder})
+
+		ctx, parent := recorder.Start(context.Background(), "request", time.Now())
+		v.PublishMessageContext(ctx, varto.Message{Topic: "topic", Data: []byte("data")})
+		parent.End(nil)
+
+		publish := recorder.SpansNamed(varto.SpanPublish)
+		assert.Len(t, publish, 1)
+		assert.Equal(t, recorder.SpansNamed("request")[0].SpanId, publish[0].ParentId)
+		assert.Equal(t, varto.ErrTopicNotFound, publish[0].Err)
+	})
+
+	t.Run("TestTracing_WhenMiddlewareRejects_ThenMiddlewareSpanHasError", func(t *testing.T) {
+		recorder := tracetest.NewRecorder()
+		v := varto.New(&varto.Options{Tracer: recorder})
+		v.Use(varto.OnPublishFunc(func(topic string, data []byte) error {
+			return fmt.Errorf("error")
+		}))
+
+		v.Publish("topic", []byte("data"))
+
+		spans := recorder.SpansNamed(varto.SpanMiddleware)
+		assert.Len(t, spans, 1)
+		assert.EqualError(t, spans[0].Err, "error")
+	})
+
+	t.Run("TestTracing_WhenMessageIsDelivered_ThenHeadersCarryTraceContext", func(t *testing.T) {
+		recorder := tracetest.NewRecorder()
+		v := varto.New(&varto.Options{Tracer: recorder})
+		conn := &messageConnection{
+			MockConnection: mock.NewMockConnection(gomock.NewController(t)),
+			messages:       make(chan varto.Message, 1),
+		}
+		conn.EXPECT().GetId().Return("id").AnyTimes()
+
+		v.Subscribe(conn, "topic")
+		v.Publish("topic", []byte("data"))
+
+		select {
+		case msg := <-conn.messages:
+			publish := recorder.SpansNamed(varto.SpanPublish)[0]
+			assert.Equal(t, "00-"+publish.TraceId+"-"+publish.SpanId+"-01", msg.Headers[tracetest.TraceParentHeader])
+		case <-time.After(time.Second):
+			t.Fatal("message is not delivered")
+		}
+	})
+}
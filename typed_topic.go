@@ -0,0 +1,56 @@
+package varto
+
+import (
+	"context"
+	"fmt"
+)
+
+// TypedTopic publishes and subscribes to a topic with values of type T,
+// which are encoded to and decoded from the message data with a Codec.
+type TypedTopic[T any] struct {
+	v     *Varto
+	name  string
+	codec Codec
+}
+
+// NewTypedTopic returns a typed topic. If codec is nil, JSONCodec is used.
+func NewTypedTopic[T any](v *Varto, name string, codec Codec) *TypedTopic[T] {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	return &TypedTopic[T]{
+		v:     v,
+		name:  name,
+		codec: codec,
+	}
+}
+
+// Name returns the name of the topic.
+func (t *TypedTopic[T]) Name() string {
+	return t.name
+}
+
+// Publish encodes a value and publishes it to the topic.
+func (t *TypedTopic[T]) Publish(ctx context.Context, value T) error {
+	data, err := t.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	return t.v.PublishMessageContext(ctx, Message{Topic: t.name, Data: data})
+}
+
+// Subscribe calls handler with the decoded values published to the topic, like SubscribeFunc.
+// Messages that can't be decoded are reported as delivery errors wrapping ErrDecode.
+func (t *TypedTopic[T]) Subscribe(handler func(value T), policy ...OverflowPolicy) (func(), error) {
+	return t.v.subscribeFunc(t.name, policy, func(conn Connection, msg Message) {
+		var value T
+		if err := t.codec.Decode(msg.Data, &value); err != nil {
+			t.v.reportDeliveryError(t.name, conn, fmt.Errorf("%w: %w", ErrDecode, err))
+			return
+		}
+
+		handler(value)
+	})
+}
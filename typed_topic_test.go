@@ -0,0 +1,92 @@
+package varto_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/stretchr/testify/assert"
+)
+
+type order struct {
+	Id    string
+	Total int
+}
+
+func TestTypedTopic(t *testing.T) {
+	receive := func(t *testing.T, ch chan order) order {
+		select {
+		case value := <-ch:
+			return value
+		case <-time.After(time.Second):
+			t.Fatal("value is not delivered")
+			return order{}
+		}
+	}
+
+	for name, codec := range map[string]varto.Codec{
+		"JSON": varto.JSONCodec{},
+		"Gob":  varto.GobCodec{},
+	} {
+		t.Run("TestTypedTopic_When"+name+"ValueIsPublished_ThenDecodeIt", func(t *testing.T) {
+			v := varto.New(nil)
+			orders := varto.NewTypedTopic[order](v, "orders", codec)
+			received := make(chan order, 1)
+
+			cancel, err := orders.Subscribe(func(value order) {
+				received <- value
+			})
+			assert.Nil(t, err)
+			defer cancel()
+
+			assert.Nil(t, orders.Publish(context.Background(), order{Id: "1", Total: 42}))
+			assert.Equal(t, order{Id: "1", Total: 42}, receive(t, received))
+		})
+	}
+
+	t.Run("TestTypedTopic_WhenRawValueIsPublished_ThenPassItThrough", func(t *testing.T) {
+		v := varto.New(nil)
+		raw := varto.NewTypedTopic[[]byte](v, "raw", varto.RawCodec{})
+		ch, cancel, _ := v.SubscribeChan("raw", 1)
+		defer cancel()
+
+		raw.Publish(context.Background(), []byte("data"))
+
+		assert.Equal(t, []byte("data"), (<-ch).Data)
+	})
+
+	t.Run("TestTypedTopic_WhenRawCodecGetsOtherType_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		raw := varto.NewTypedTopic[string](v, "raw", varto.RawCodec{})
+
+		err := raw.Publish(context.Background(), "data")
+		assert.True(t, errors.Is(err, varto.ErrUnsupportedType))
+	})
+
+	t.Run("TestTypedTopic_WhenDataCannotBeDecoded_ThenReportDeliveryError", func(t *testing.T) {
+		errs := make(chan error, 1)
+		v := varto.New(&varto.Options{
+			OnDeliveryError: func(topic string, conn varto.Connection, err error) {
+				errs <- err
+			},
+		})
+		orders := varto.NewTypedTopic[order](v, "orders", nil)
+		received := make(chan order, 1)
+		cancel, _ := orders.Subscribe(func(value order) {
+			received <- value
+		})
+		defer cancel()
+
+		v.Publish("orders", []byte("not json"))
+
+		select {
+		case err := <-errs:
+			assert.True(t, errors.Is(err, varto.ErrDecode))
+		case <-time.After(time.Second):
+			t.Fatal("delivery error is not reported")
+		}
+		assert.Len(t, received, 0)
+	})
+}
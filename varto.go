@@ -1,12 +1,59 @@
 package varto
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // If this is not provided, default options will be used.
 type Options struct {
 	// AllowedTopics is a list of topics that are allowed to be subscribed.
 	// If this list is empty, all topics are allowed.
 	AllowedTopics []string
+
+	// UnsubscribeOnDisallow makes DisallowTopic and SetAllowedTopics unsubscribe
+	// the existing subscribers of the topics that are no longer allowed.
+	UnsubscribeOnDisallow bool
+
+	// SessionExpiry is how long a disconnected session keeps its subscriptions
+	// so that they can be restored with ResumeSession.
+	// If it is zero, sessions are disabled.
+	SessionExpiry time.Duration
+
+	// SessionQueueSize is the maximum number of messages queued for a
+	// disconnected session. If it is zero, no messages are queued.
+	SessionQueueSize int
+
+	// PresenceEvents enables publishing join and leave events of a topic
+	// to the PresenceTopicPrefix + topic topic. Clients can't publish to those topics then.
+	PresenceEvents bool
+
+	// OnPresence is called when a connection joins or leaves a topic.
+	OnPresence func(event PresenceEvent)
+
+	// Tracer traces publishing and delivering messages. If it is nil, nothing is traced.
+	Tracer Tracer
+
+	// OnDeliveryError is called when a message can't be written to a subscriber.
+	// If neither it nor any DeliveryErrorMiddleware is set, delivery errors are printed.
+	OnDeliveryError func(topic string, conn Connection, err error)
+
+	// WildcardSubscriptions lets connections subscribe to topic patterns, where "+" matches
+	// exactly one level and "#" matches any number of remaining levels. Messages are delivered
+	// to the subscribers of their topic and of every matching pattern.
+	// Topics with wildcards can't be published to.
+	WildcardSubscriptions bool
+
+	// SystemEvents enables publishing lifecycle events to the topics
+	// under SystemTopicPrefix, such as SystemTopicConnectionAdded.
+	SystemEvents bool
+
+	// ServeBroadcast lets the connections run by Serve broadcast to all connections
+	// with the broadcast command, through BroadcastToAllFrom. It is disabled by default.
+	ServeBroadcast bool
 }
 
 func getDefaultOptions() *Options {
@@ -17,8 +64,13 @@ func getDefaultOptions() *Options {
 type Varto struct {
 	store             Store
 	opts              *Options
-	allowedTopics     map[string]bool
+	allowedTopics     *allowedTopics
 	middlewareContext *middlewareContext
+	subscriptions     *subscriptionIndex
+	sessions          *sessionManager
+	attributes        *attributeStore
+	tracer            Tracer
+	lastMessageId     atomic.Uint64
 }
 
 // New returns a new Varto instance.
@@ -32,6 +84,8 @@ func NewWithStore(opts *Options, store Store) *Varto {
 	v := &Varto{
 		store:             store,
 		middlewareContext: newMiddlewareContext(),
+		subscriptions:     newSubscriptionIndex(),
+		attributes:        newAttributeStore(),
 	}
 
 	if opts == nil {
@@ -40,23 +94,39 @@ func NewWithStore(opts *Options, store Store) *Varto {
 		v.opts = opts
 	}
 
-	if len(v.opts.AllowedTopics) > 0 {
-		v.allowedTopics = make(map[string]bool)
-		for _, topic := range v.opts.AllowedTopics {
-			v.allowedTopics[topic] = true
-		}
+	v.allowedTopics = newAllowedTopics(v.opts.AllowedTopics)
+
+	v.tracer = v.opts.Tracer
+	if v.tracer == nil {
+		v.tracer = noopTracer{}
+	}
+
+	if v.opts.SessionExpiry > 0 {
+		v.sessions = newSessionManager(v.opts.SessionExpiry, v.opts.SessionQueueSize)
 	}
 
 	return v
 }
 
 // Use adds a middleware to the middleware chain.
-func (v *Varto) Use(middleware Middleware) {
+// The returned handle can be used to remove it again.
+func (v *Varto) Use(middleware Middleware) *MiddlewareHandle {
+	return v.UseWithOptions(middleware, MiddlewareOptions{})
+}
+
+// UseFor adds a middleware that only runs for the topics that match a pattern.
+// "+" matches exactly one level and "#" matches any number of remaining levels.
+func (v *Varto) UseFor(pattern string, middleware Middleware) *MiddlewareHandle {
+	return v.UseWithOptions(middleware, MiddlewareOptions{Topic: pattern})
+}
+
+// UseWithOptions adds a middleware to the middleware chain with the given options.
+func (v *Varto) UseWithOptions(middleware Middleware, opts MiddlewareOptions) *MiddlewareHandle {
 	if middleware == nil {
-		return
+		return nil
 	}
 
-	v.middlewareContext.Add(middleware)
+	return v.middlewareContext.Add(middleware, opts)
 }
 
 func (v *Varto) AddConnection(conn Connection) error {
@@ -64,13 +134,28 @@ func (v *Varto) AddConnection(conn Connection) error {
 		return ErrNilConnection
 	}
 
-	for _, m := range v.middlewareContext.GetAll() {
+	middlewares := v.middlewareContext.GetAll()
+	err := v.addConnection(middlewares, conn)
+	runAfterHooks(middlewares, func(m AfterMiddleware) {
+		m.AfterAddConnection(conn, err)
+	})
+
+	return err
+}
+
+func (v *Varto) addConnection(middlewares []Middleware, conn Connection) error {
+	for _, m := range middlewares {
 		if err := m.OnAddConnection(conn); err != nil {
 			return err
 		}
 	}
 
-	return v.store.AddConnection(conn)
+	if err := v.store.AddConnection(conn); err != nil {
+		return err
+	}
+
+	v.emitConnectionEvent(SystemTopicConnectionAdded, conn)
+	return nil
 }
 
 func (v *Varto) RemoveConnection(conn Connection) error {
@@ -78,13 +163,58 @@ func (v *Varto) RemoveConnection(conn Connection) error {
 		return ErrNilConnection
 	}
 
-	for _, m := range v.middlewareContext.GetAll() {
+	return v.removeConnectionWithHooks(nil, conn)
+}
+
+// RemoveConnectionFrom removes a connection on behalf of another connection, such as an admin client.
+// Unlike RemoveConnection, it lets middleware check whether from may remove the connection.
+func (v *Varto) RemoveConnectionFrom(from Connection, conn Connection) error {
+	if from == nil || conn == nil {
+		return ErrNilConnection
+	}
+
+	return v.removeConnectionWithHooks(from, conn)
+}
+
+func (v *Varto) removeConnectionWithHooks(from Connection, conn Connection) error {
+	middlewares := v.middlewareContext.GetAll()
+	err := v.removeConnection(middlewares, from, conn)
+	runAfterHooks(middlewares, func(m AfterMiddleware) {
+		m.AfterRemoveConnection(conn, err)
+	})
+
+	return err
+}
+
+func (v *Varto) removeConnection(middlewares []Middleware, from Connection, conn Connection) error {
+	for _, m := range middlewares {
+		if rm, ok := m.(RemoveConnectionFromMiddleware); ok && from != nil {
+			if err := rm.OnRemoveConnectionFrom(from, conn); err != nil {
+				return err
+			}
+		}
+
 		if err := m.OnRemoveConnection(conn); err != nil {
 			return err
 		}
 	}
 
-	return v.store.RemoveConnection(conn)
+	if err := v.store.RemoveConnection(conn); err != nil {
+		return err
+	}
+
+	topics := v.subscriptions.RemoveConnection(conn)
+	for _, topic := range topics {
+		v.emitPresence(PresenceLeave, conn, topic)
+	}
+	v.attributes.Remove(conn)
+
+	if v.sessions != nil {
+		v.detachSession(conn, topics)
+	}
+
+	v.emitConnectionEvent(SystemTopicConnectionRemoved, conn)
+	return nil
 }
 
 // Subscribe subscribes a connection to a topic.
@@ -97,31 +227,99 @@ func (v *Varto) Subscribe(conn Connection, topicName string) error {
 		return ErrNilConnection
 	}
 
-	for _, m := range v.middlewareContext.GetAll() {
+	if v.opts.WildcardSubscriptions && !validTopicPattern(topicName) {
+		return ErrInvalidTopicName
+	}
+
+	middlewares := v.middlewareContext.GetForTopic(topicName)
+	err := v.subscribe(middlewares, conn, topicName)
+	runAfterHooks(middlewares, func(m AfterMiddleware) {
+		m.AfterSubscribe(conn, topicName, err)
+	})
+
+	return err
+}
+
+func (v *Varto) subscribe(middlewares []Middleware, conn Connection, topicName string) error {
+	for _, m := range middlewares {
 		if err := m.OnSubscribe(conn, topicName); err != nil {
 			return err
 		}
 	}
 
-	if v.allowedTopics != nil {
-		if _, ok := v.allowedTopics[topicName]; !ok {
-			return ErrTopicIsNotAllowed
+	joined, err := v.subscribeIfAllowed(conn, topicName)
+	if err != nil {
+		return err
+	}
+
+	if joined {
+		v.emitPresence(PresenceJoin, conn, topicName)
+	}
+
+	return nil
+}
+
+// CheckSubscribe reports whether a connection may subscribe to a topic, without subscribing it.
+// It checks the allowed topics and the middleware that implement SubscribeCheckMiddleware,
+// such as an ACL. Other middleware are not called, since their hooks may have side effects.
+func (v *Varto) CheckSubscribe(conn Connection, topicName string) error {
+	if topicName == "" {
+		return ErrInvalidTopicName
+	}
+
+	if conn == nil {
+		return ErrNilConnection
+	}
+
+	if !v.allowedTopics.IsAllowed(topicName) {
+		return ErrTopicIsNotAllowed
+	}
+
+	for _, m := range v.middlewareContext.GetForTopic(topicName) {
+		if cm, ok := m.(SubscribeCheckMiddleware); ok {
+			if err := cm.CheckSubscribe(conn, topicName); err != nil {
+				return err
+			}
 		}
 	}
 
+	return nil
+}
+
+// subscribeIfAllowed checks that the topic is allowed and subscribes the connection to it.
+// It holds the allowed topics lock throughout, so that a topic that is disallowed meanwhile
+// has either rejected the subscription or will see the subscriber when unsubscribing all.
+func (v *Varto) subscribeIfAllowed(conn Connection, topicName string) (bool, error) {
+	v.allowedTopics.RLock()
+	defer v.allowedTopics.RUnlock()
+
+	if !v.allowedTopics.isAllowed(topicName) {
+		return false, ErrTopicIsNotAllowed
+	}
+
+	if _, local := conn.(*localConnection); !local && isReservedConnectionId(conn.GetId()) {
+		return false, ErrReservedConnectionId
+	}
+
 	topic, err := v.store.GetTopic(topicName)
 	if err == ErrTopicNotFound {
 		if t, err := v.store.AddTopic(topicName); err != nil {
-			return err
+			return false, err
 		} else {
 			topic = t
 		}
+
+		if ht, ok := topic.(HookableTopic); ok {
+			ht.SetHooks(v.topicHooks())
+		}
+
+		v.emitTopicCreated(topicName)
 	} else if err != nil {
-		return err
+		return false, err
 	}
 
 	topic.Subscribe(conn)
-	return nil
+	return v.subscriptions.Add(conn, topicName), nil
 }
 
 func (v *Varto) Unsubscribe(conn Connection, topic string) error {
@@ -133,7 +331,17 @@ func (v *Varto) Unsubscribe(conn Connection, topic string) error {
 		return ErrNilConnection
 	}
 
-	for _, m := range v.middlewareContext.GetAll() {
+	middlewares := v.middlewareContext.GetForTopic(topic)
+	err := v.unsubscribeWithMiddleware(middlewares, conn, topic)
+	runAfterHooks(middlewares, func(m AfterMiddleware) {
+		m.AfterUnsubscribe(conn, topic, err)
+	})
+
+	return err
+}
+
+func (v *Varto) unsubscribeWithMiddleware(middlewares []Middleware, conn Connection, topic string) error {
+	for _, m := range middlewares {
 		if err := m.OnUnsubscribe(conn, topic); err != nil {
 			return err
 		}
@@ -144,12 +352,22 @@ func (v *Varto) Unsubscribe(conn Connection, topic string) error {
 		return err
 	}
 
+	return v.unsubscribe(conn, t, topic)
+}
+
+// unsubscribe unsubscribes a connection from a topic and removes the topic if it is left empty.
+func (v *Varto) unsubscribe(conn Connection, t Topic, topicName string) error {
 	t.Unsubscribe(conn)
+	if v.subscriptions.Remove(conn, topicName) {
+		v.emitPresence(PresenceLeave, conn, topicName)
+	}
 
 	if t.IsEmpty() {
-		if err := v.store.RemoveTopic(topic); err != nil {
+		if err := v.store.RemoveTopic(topicName); err != nil {
 			return err
 		}
+
+		v.emitTopicRemoved(topicName)
 	}
 
 	return nil
@@ -157,36 +375,258 @@ func (v *Varto) Unsubscribe(conn Connection, topic string) error {
 
 // Publish publishes data to a topic.
 func (v *Varto) Publish(topic string, data []byte) error {
-	if topic == "" {
+	return v.PublishMessage(Message{Topic: topic, Data: data})
+}
+
+// PublishFrom publishes data to a topic on behalf of a connection.
+// Unlike Publish, it lets middleware check whether the connection may publish to the topic.
+func (v *Varto) PublishFrom(conn Connection, topic string, data []byte) error {
+	return v.PublishMessageFrom(conn, Message{Topic: topic, Data: data})
+}
+
+// PublishMessage publishes a message with headers to its topic.
+func (v *Varto) PublishMessage(msg Message) error {
+	return v.PublishMessageContext(context.Background(), msg)
+}
+
+// PublishMessageFrom publishes a message with headers to its topic on behalf of a connection.
+func (v *Varto) PublishMessageFrom(conn Connection, msg Message) error {
+	return v.PublishMessageFromContext(context.Background(), conn, msg)
+}
+
+// PublishMessageContext publishes a message with headers to its topic.
+// The spans of the publish are children of the span in ctx, if any.
+func (v *Varto) PublishMessageContext(ctx context.Context, msg Message) error {
+	if msg.Topic == "" {
 		return ErrInvalidTopicName
 	}
 
-	for _, m := range v.middlewareContext.GetAll() {
-		if err := m.OnPublish(topic, data); err != nil {
-			return err
-		}
+	if v.isReservedTopic(msg.Topic) {
+		return ErrReservedTopic
 	}
 
-	t, err := v.store.GetTopic(topic)
+	if v.opts.WildcardSubscriptions && isTopicPattern(msg.Topic) {
+		return ErrInvalidTopicName
+	}
+
+	return v.publishWithReport(ctx, nil, msg)
+}
+
+// PublishMessageFromContext publishes a message with headers to its topic on behalf of a connection.
+// The spans of the publish are children of the span in ctx, if any.
+func (v *Varto) PublishMessageFromContext(ctx context.Context, conn Connection, msg Message) error {
+	if msg.Topic == "" {
+		return ErrInvalidTopicName
+	}
+
+	if v.isReservedTopic(msg.Topic) {
+		return ErrReservedTopic
+	}
+
+	if v.opts.WildcardSubscriptions && isTopicPattern(msg.Topic) {
+		return ErrInvalidTopicName
+	}
+
+	if conn == nil {
+		return ErrNilConnection
+	}
+
+	return v.publishWithReport(ctx, conn, msg)
+}
+
+func (v *Varto) publishWithReport(ctx context.Context, conn Connection, msg Message) error {
+	msg.Headers = copyHeaders(msg.Headers)
+
+	ctx, span := v.tracer.Start(ctx, SpanPublish, time.Now())
+	span.SetAttribute("topic", msg.Topic)
+
+	middlewares, recipients, err := v.publish(ctx, conn, &msg)
+	report := PublishReport{
+		Topic:      msg.Topic,
+		Data:       msg.Data,
+		Headers:    msg.Headers,
+		Id:         msg.Id,
+		Connection: conn,
+		Recipients: recipients,
+		Err:        err,
+	}
+
+	runAfterHooks(middlewares, func(m AfterMiddleware) {
+		m.AfterPublish(report)
+	})
+
+	span.SetAttribute("size", len(msg.Data))
+	span.SetAttribute("recipients", recipients)
+	span.End(err)
+
+	return err
+}
+
+// publish runs the message through the middleware chain and hands it to its topic.
+// Every PublishTransformer runs before the OnPublishFrom and OnPublish hooks.
+// It returns the chain of the final topic of the message, whose after-hooks are called.
+func (v *Varto) publish(ctx context.Context, conn Connection, msg *Message) ([]Middleware, int, error) {
+	middlewares, err := v.runPublishMiddleware(ctx, conn, msg)
 	if err != nil {
-		return err
+		return middlewares, 0, err
 	}
 
-	t.Publish(data)
-	return nil
+	if v.opts.Tracer != nil {
+		if msg.Headers == nil {
+			msg.Headers = make(map[string]string)
+		}
+
+		v.opts.Tracer.Inject(ctx, msg.Headers)
+	}
+
+	var patterns []string
+	if v.opts.WildcardSubscriptions {
+		patterns = v.subscriptions.PatternsMatching(msg.Topic)
+	}
+
+	t, err := v.store.GetTopic(msg.Topic)
+	if err != nil && (err != ErrTopicNotFound || len(patterns) == 0) {
+		return middlewares, 0, err
+	}
+
+	msg.Id = v.nextMessageId()
+
+	recipients := 0
+	if err == nil {
+		deliver(t, *msg)
+		recipients += v.subscriptions.Count(msg.Topic)
+	}
+
+	// The subscribers of a pattern get the message with its own topic, not the pattern.
+	for _, pattern := range patterns {
+		if t, err := v.store.GetTopic(pattern); err == nil {
+			deliver(t, *msg)
+			recipients += v.subscriptions.Count(pattern)
+		}
+	}
+
+	return middlewares, recipients, nil
+}
+
+func (v *Varto) nextMessageId() uint64 {
+	return v.lastMessageId.Add(1)
+}
+
+// deliver hands a message to a topic, or only its data if the topic can't deliver whole messages.
+func deliver(t Topic, msg Message) {
+	if mp, ok := t.(MessagePublisher); ok {
+		mp.PublishMessage(msg)
+	} else {
+		t.Publish(msg.Data)
+	}
+}
+
+// runPublishMiddleware transforms the message and runs the hooks that allow or deny it.
+// When a transformer rewrites the topic, the chain of the new topic is used from then on,
+// so the scoped middleware of the new topic apply to it. Each transformer runs once.
+func (v *Varto) runPublishMiddleware(ctx context.Context, conn Connection, msg *Message) (middlewares []Middleware, err error) {
+	_, span := v.tracer.Start(ctx, SpanMiddleware, time.Now())
+	defer func() {
+		span.End(err)
+	}()
+
+	entries := v.middlewareContext.getEntriesForTopic(msg.Topic)
+	transformed := make(map[uint64]bool)
+
+	// The message is transformed first, so that the hooks that allow or deny it
+	// see the topic and data that are delivered.
+	for i := 0; i < len(entries); i++ {
+		tm, ok := entries[i].middleware.(PublishTransformer)
+		if !ok || transformed[entries[i].id] {
+			continue
+		}
+		transformed[entries[i].id] = true
+
+		topic := msg.Topic
+		if err := tm.TransformPublish(msg); err != nil {
+			return middlewaresOf(entries), err
+		}
+
+		if msg.Topic == "" {
+			return middlewaresOf(entries), ErrInvalidTopicName
+		}
+
+		if v.isReservedTopic(msg.Topic) {
+			return middlewaresOf(entries), ErrReservedTopic
+		}
+
+		if v.opts.WildcardSubscriptions && isTopicPattern(msg.Topic) {
+			return middlewaresOf(entries), ErrInvalidTopicName
+		}
+
+		if msg.Topic != topic {
+			entries = v.middlewareContext.getEntriesForTopic(msg.Topic)
+			i = -1
+		}
+	}
+
+	middlewares = middlewaresOf(entries)
+	for _, m := range middlewares {
+		if pm, ok := m.(PublishFromMiddleware); ok && conn != nil {
+			if err := pm.OnPublishFrom(conn, msg.Topic, msg.Data); err != nil {
+				return middlewares, err
+			}
+		}
+
+		if err := m.OnPublish(msg.Topic, msg.Data); err != nil {
+			return middlewares, err
+		}
+	}
+
+	return middlewares, nil
 }
 
 // BroadcastToAll broadcasts data to all connections.
 func (v *Varto) BroadcastToAll(data []byte) error {
-	for _, m := range v.middlewareContext.GetAll() {
+	return v.broadcastWithReport(nil, data)
+}
+
+// BroadcastToAllFrom broadcasts data to all connections on behalf of a connection.
+// Unlike BroadcastToAll, it lets middleware check whether the connection may broadcast.
+func (v *Varto) BroadcastToAllFrom(conn Connection, data []byte) error {
+	if conn == nil {
+		return ErrNilConnection
+	}
+
+	return v.broadcastWithReport(conn, data)
+}
+
+func (v *Varto) broadcastWithReport(conn Connection, data []byte) error {
+	report := PublishReport{
+		Data:       data,
+		Connection: conn,
+	}
+
+	middlewares := v.middlewareContext.GetAll()
+	report.Recipients, report.Err = v.broadcastToAll(middlewares, conn, data)
+	runAfterHooks(middlewares, func(m AfterMiddleware) {
+		m.AfterBroadcastToAll(report)
+	})
+
+	return report.Err
+}
+
+func (v *Varto) broadcastToAll(middlewares []Middleware, from Connection, data []byte) (int, error) {
+	for _, m := range middlewares {
+		if bm, ok := m.(BroadcastFromMiddleware); ok && from != nil {
+			if err := bm.OnBroadcastFrom(from, data); err != nil {
+				return 0, err
+			}
+		}
+
 		if err := m.OnBroadcastToAll(data); err != nil {
-			return err
+			return 0, err
 		}
 	}
 
 	connections, err := v.store.GetAllConnections()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	wg := sync.WaitGroup{}
@@ -210,9 +650,60 @@ func (v *Varto) BroadcastToAll(data []byte) error {
 
 	select {
 	case err := <-chErr:
-		return err
+		return len(connections), err
 	default:
 	}
 
-	return nil
+	return len(connections), nil
+}
+
+// runAfterHooks calls hook for every middleware that implements AfterMiddleware.
+func runAfterHooks(middlewares []Middleware, hook func(m AfterMiddleware)) {
+	for _, m := range middlewares {
+		if am, ok := m.(AfterMiddleware); ok {
+			hook(am)
+		}
+	}
+}
+
+// topicHooks returns the hooks Varto sets on the topics it creates.
+func (v *Varto) topicHooks() TopicHooks {
+	return TopicHooks{
+		OnDeliveryError: v.reportDeliveryError,
+		OnDelivered:     v.reportDelivered,
+		Tracer:          v.opts.Tracer,
+	}
+}
+
+// reportDelivered passes a delivery report to the middleware that implement DeliveryMiddleware.
+func (v *Varto) reportDelivered(report DeliveryReport) {
+	for _, m := range v.middlewareContext.GetForTopic(report.Topic) {
+		if dm, ok := m.(DeliveryMiddleware); ok {
+			dm.OnDelivered(report)
+		}
+	}
+}
+
+// reportDeliveryError passes a delivery error to Options.OnDeliveryError
+// and to the middleware that implement DeliveryErrorMiddleware.
+func (v *Varto) reportDeliveryError(topic string, conn Connection, err error) {
+	handled := false
+
+	if v.opts.OnDeliveryError != nil {
+		v.opts.OnDeliveryError(topic, conn, err)
+		handled = true
+	}
+
+	for _, m := range v.middlewareContext.GetForTopic(topic) {
+		if dm, ok := m.(DeliveryErrorMiddleware); ok {
+			dm.OnDeliveryError(topic, conn, err)
+			handled = true
+		}
+	}
+
+	v.emitDeliveryError(topic, conn, err)
+
+	if !handled {
+		fmt.Println(err)
+	}
 }
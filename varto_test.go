@@ -11,6 +11,24 @@ import (
 	"go.uber.org/mock/gomock"
 )
 
+// valueConnection is a connection that is not a pointer and can't be used as a map key.
+type valueConnection struct {
+	id   string
+	tags map[string]string
+}
+
+func (c valueConnection) GetId() string {
+	return c.id
+}
+
+func (c valueConnection) Read() ([]byte, error) {
+	return nil, nil
+}
+
+func (c valueConnection) Write(data []byte) error {
+	return nil
+}
+
 func TestNew(t *testing.T) {
 	t.Run("TestNew_WhenNoOptionsProvided_ThenReturnInstance", func(t *testing.T) {
 		v := varto.New(nil)
@@ -34,6 +52,27 @@ func TestAddConnection(t *testing.T) {
 		assert.Equal(t, varto.ErrNilConnection, err)
 	})
 
+	t.Run("TestAddConnection_WhenConnectionIsNotHashable_ThenKeyItById", func(t *testing.T) {
+		v := varto.New(&varto.Options{SessionExpiry: time.Minute})
+		conn := valueConnection{id: "id", tags: map[string]string{}}
+
+		assert.NotPanics(t, func() {
+			assert.Nil(t, v.AddConnection(conn))
+			v.ResumeSession(conn, "session")
+			assert.Nil(t, v.Subscribe(conn, "topic"))
+			assert.Nil(t, v.Publish("topic", []byte("data")))
+			assert.Equal(t, []varto.Connection{conn}, v.Subscribers("topic"))
+		})
+	})
+
+	t.Run("TestAddConnection_WhenIdIsReserved_ThenReturnError", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := valueConnection{id: "\x00session:id"}
+
+		assert.Equal(t, varto.ErrReservedConnectionId, v.AddConnection(conn))
+		assert.Equal(t, varto.ErrReservedConnectionId, v.Subscribe(conn, "topic"))
+	})
+
 	t.Run("TestAddConnection_WhenMiddlewareReturnsError_ThenReturnError", func(t *testing.T) {
 		v := varto.New(nil)
 		mockConnection := mock.NewMockConnection(gomock.NewController(t))
@@ -89,7 +128,7 @@ func TestSubscribe(t *testing.T) {
 	t.Run("TestSubscribe_WhenCall_ThenReturnNil", func(t *testing.T) {
 		v := varto.New(nil)
 		mockConnection := mock.NewMockConnection(gomock.NewController(t))
-		mockConnection.EXPECT().GetId().Return("id")
+		mockConnection.EXPECT().GetId().Return("id").AnyTimes()
 
 		err := v.Subscribe(mockConnection, "topic")
 		assert.Nil(t, err)
@@ -0,0 +1,76 @@
+package varto_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestWildcardSubscriptions(t *testing.T) {
+	t.Run("TestWildcardSubscriptions_WhenPatternMatches_ThenDeliverWithOwnTopic", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		single, cancel1, _ := v.SubscribeChan("sensors/+/temperature", 1)
+		defer cancel1()
+		multi, cancel2, _ := v.SubscribeChan("sensors/#", 1)
+		defer cancel2()
+
+		err := v.Publish("sensors/kitchen/temperature", []byte("21"))
+		assert.Nil(t, err)
+
+		assert.Equal(t, varto.Message{Topic: "sensors/kitchen/temperature", Data: []byte("21"), Id: 1}, <-single)
+		assert.Equal(t, varto.Message{Topic: "sensors/kitchen/temperature", Data: []byte("21"), Id: 1}, <-multi)
+	})
+
+	t.Run("TestWildcardSubscriptions_WhenTopicAndPatternHaveSubscribers_ThenCountBoth", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		recorder := &afterRecorder{}
+		v.Use(recorder)
+		mockConnection1 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection1.EXPECT().GetId().Return("id1").AnyTimes()
+		mockConnection1.EXPECT().Write([]byte("data")).Return(nil)
+		mockConnection2 := mock.NewMockConnection(gomock.NewController(t))
+		mockConnection2.EXPECT().GetId().Return("id2").AnyTimes()
+		mockConnection2.EXPECT().Write([]byte("data")).Return(nil)
+
+		v.Subscribe(mockConnection1, "a/b")
+		v.Subscribe(mockConnection2, "a/#")
+		v.Publish("a/b", []byte("data"))
+		time.Sleep(10 * time.Millisecond)
+
+		assert.Equal(t, 2, recorder.publishes[0].Recipients)
+	})
+
+	t.Run("TestWildcardSubscriptions_WhenNothingMatches_ThenReturnTopicNotFound", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		_, cancel, _ := v.SubscribeChan("a/+", 1)
+		defer cancel()
+
+		assert.Equal(t, varto.ErrTopicNotFound, v.Publish("a/b/c", []byte("data")))
+	})
+
+	t.Run("TestWildcardSubscriptions_WhenPatternStartsWithWildcard_ThenSkipDollarTopics", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		all, cancel1, _ := v.SubscribeChan("#", 1)
+		defer cancel1()
+		dollar, cancel2, _ := v.SubscribeChan("$internal/#", 1)
+		defer cancel2()
+
+		v.Publish("$internal/stats", []byte("data"))
+
+		assert.Equal(t, []byte("data"), (<-dollar).Data)
+		assert.Len(t, all, 0)
+	})
+
+	t.Run("TestWildcardSubscriptions_WhenPatternOrTopicIsInvalid_ThenReturnError", func(t *testing.T) {
+		v := varto.New(&varto.Options{WildcardSubscriptions: true})
+		mockConnection := mock.NewMockConnection(gomock.NewController(t))
+
+		assert.Equal(t, varto.ErrInvalidTopicName, v.Subscribe(mockConnection, "a/#/b"))
+		assert.Equal(t, varto.ErrInvalidTopicName, v.Subscribe(mockConnection, "a/b+"))
+		assert.Equal(t, varto.ErrInvalidTopicName, v.Publish("a/+", []byte("data")))
+	})
+}
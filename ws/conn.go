@@ -0,0 +1,219 @@
+// Package ws implements varto connections over RFC 6455 WebSockets.
+package ws
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultMaxMessageSize is the maximum size of a received message if Options.MaxMessageSize is zero.
+const DefaultMaxMessageSize = 1 << 20
+
+// CloseTimeout is how long Close waits for the peer to answer the close frame
+// before it closes the underlying connection.
+const CloseTimeout = 5 * time.Second
+
+// Conn is a WebSocket connection. It implements varto.Connection.
+// Read may be called from one goroutine, while Write, Ping and Close may be called concurrently.
+type Conn struct {
+	id             string
+	conn           net.Conn
+	reader         *bufio.Reader
+	client         bool
+	maxMessageSize int64
+
+	writeMu   sync.Mutex
+	writer    *bufio.Writer
+	closeSent bool
+
+	pongMu      sync.Mutex
+	pongHandler func(data []byte)
+}
+
+func newConn(id string, conn net.Conn, rw *bufio.ReadWriter, client bool, maxMessageSize int64) *Conn {
+	if maxMessageSize == 0 {
+		maxMessageSize = DefaultMaxMessageSize
+	}
+
+	return &Conn{
+		id:             id,
+		conn:           conn,
+		reader:         rw.Reader,
+		writer:         rw.Writer,
+		client:         client,
+		maxMessageSize: maxMessageSize,
+	}
+}
+
+func (c *Conn) GetId() string {
+	return c.id
+}
+
+// Read returns the next text or binary message. Ping frames are answered
+// while reading, and a close frame is answered and returned as io.EOF.
+func (c *Conn) Read() ([]byte, error) {
+	var message []byte
+	var opcode byte
+
+	for {
+		f, err := readFrame(c.reader, !c.client, c.maxMessageSize)
+		if err != nil {
+			return nil, c.fail(err)
+		}
+
+		switch f.opcode {
+		case opPing:
+			// Pings that arrive after a close frame was sent are not answered anymore.
+			if err := c.write(opPong, f.payload); err != nil && err != ErrClosed {
+				return nil, err
+			}
+			continue
+		case opPong:
+			c.pongMu.Lock()
+			handler := c.pongHandler
+			c.pongMu.Unlock()
+
+			if handler != nil {
+				handler(f.payload)
+			}
+			continue
+		case opClose:
+			c.answerClose(f.payload)
+			return nil, io.EOF
+		case opContinuation:
+			if opcode == 0 {
+				return nil, c.fail(ErrProtocol)
+			}
+		default:
+			if opcode != 0 {
+				return nil, c.fail(ErrProtocol)
+			}
+			opcode = f.opcode
+		}
+
+		message = append(message, f.payload...)
+		if int64(len(message)) > c.maxMessageSize {
+			return nil, c.fail(ErrMessageTooBig)
+		}
+
+		if f.fin {
+			if opcode == opText && !utf8.Valid(message) {
+				return nil, c.fail(ErrInvalidPayload)
+			}
+
+			return message, nil
+		}
+	}
+}
+
+// Write sends data as a text message if it is valid UTF-8, and as a binary message otherwise.
+func (c *Conn) Write(data []byte) error {
+	opcode := byte(opBinary)
+	if utf8.Valid(data) {
+		opcode = opText
+	}
+
+	return c.write(opcode, data)
+}
+
+// Ping sends a ping frame. The answering pong is passed to the pong handler.
+func (c *Conn) Ping() error {
+	return c.write(opPing, nil)
+}
+
+// SetPongHandler sets the function that is called with the payload of received pong frames.
+func (c *Conn) SetPongHandler(handler func(data []byte)) {
+	c.pongMu.Lock()
+	defer c.pongMu.Unlock()
+
+	c.pongHandler = handler
+}
+
+// Close starts the close handshake. The underlying connection is closed
+// once the peer answers, or after CloseTimeout.
+func (c *Conn) Close() error {
+	return c.CloseWithStatus(CloseNormal, "")
+}
+
+// CloseWithStatus starts the close handshake with a status code and a reason.
+func (c *Conn) CloseWithStatus(code int, reason string) error {
+	if !c.sendClose(closePayload(code, reason)) {
+		return nil
+	}
+
+	time.AfterFunc(CloseTimeout, func() {
+		c.conn.Close()
+	})
+
+	return nil
+}
+
+// answerClose echoes the status code of a received close frame, unless a close frame
+// was already sent, and closes the underlying connection.
+func (c *Conn) answerClose(payload []byte) {
+	var answer []byte
+	if len(payload) >= 2 {
+		answer = closePayload(int(binary.BigEndian.Uint16(payload)), "")
+	}
+
+	c.sendClose(answer)
+	c.conn.Close()
+}
+
+// fail closes the connection after a read error, telling the peer why if the error is a protocol violation.
+func (c *Conn) fail(err error) error {
+	switch {
+	case errors.Is(err, ErrProtocol):
+		c.sendClose(closePayload(CloseProtocolError, ""))
+	case errors.Is(err, ErrMessageTooBig):
+		c.sendClose(closePayload(CloseMessageTooBig, ""))
+	case errors.Is(err, ErrInvalidPayload):
+		c.sendClose(closePayload(CloseInvalidPayload, ""))
+	}
+
+	c.conn.Close()
+	return err
+}
+
+// sendClose sends a close frame if none was sent yet, and reports whether it did.
+func (c *Conn) sendClose(payload []byte) bool {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return false
+	}
+	c.closeSent = true
+
+	writeFrame(c.writer, opClose, payload, c.mask())
+	return true
+}
+
+func (c *Conn) write(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return ErrClosed
+	}
+
+	return writeFrame(c.writer, opcode, payload, c.mask())
+}
+
+// mask returns a new masking key for the frames of a client, and nil for the frames of a server.
+func (c *Conn) mask() *[4]byte {
+	if !c.client {
+		return nil
+	}
+
+	var key [4]byte
+	rand.Read(key[:])
+	return &key
+}
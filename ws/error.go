@@ -0,0 +1,9 @@
+package ws
+
+import "errors"
+
+var ErrBadHandshake = errors.New("bad websocket handshake")
+var ErrProtocol = errors.New("websocket protocol error")
+var ErrMessageTooBig = errors.New("websocket message too big")
+var ErrInvalidPayload = errors.New("websocket text message is not valid utf-8")
+var ErrClosed = errors.New("websocket connection closed")
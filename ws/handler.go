@@ -0,0 +1,144 @@
+package ws
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/metinorak/varto"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Options configures upgrading HTTP requests to WebSocket connections.
+type Options struct {
+	// CheckOrigin reports whether a request may be upgraded.
+	// If it is nil, requests with an Origin header whose host differs from the Host header are rejected.
+	CheckOrigin func(r *http.Request) bool
+
+	// MaxMessageSize is the maximum size of a received message.
+	// If it is zero, DefaultMaxMessageSize is used.
+	MaxMessageSize int64
+
+	// Id returns the id of the connection of a request. If it is nil, a random id is used.
+	Id func(r *http.Request) string
+
+	// Wrap returns the connection Handler serves in place of a connection, such as Heartbeat.Track.
+	// Received pongs are recorded as activity with varto.Touch.
+	Wrap func(conn varto.Connection) varto.Connection
+}
+
+// Upgrade completes the opening handshake of a WebSocket request and returns its connection.
+// If the handshake fails, an HTTP error is written to w.
+func Upgrade(w http.ResponseWriter, r *http.Request, opts *Options) (*Conn, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, ErrBadHandshake
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid websocket key", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+
+	checkOrigin := opts.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+
+	if !checkOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, ErrBadHandshake
+	}
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	id := varto.NewConnectionId()
+	if opts.Id != nil {
+		id = opts.Id(r)
+	}
+
+	return newConn(id, netConn, rw, false, opts.MaxMessageSize), nil
+}
+
+// Handler returns an http.Handler that upgrades requests to WebSocket connections
+// and serves them with v.Serve until they are closed.
+func Handler(v *varto.Varto, opts *Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, opts)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if opts == nil || opts.Wrap == nil {
+			v.Serve(conn)
+			return
+		}
+
+		wrapped := opts.Wrap(conn)
+		conn.SetPongHandler(func(data []byte) {
+			varto.Touch(wrapped)
+		})
+		v.Serve(wrapped)
+	})
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,182 @@
+package ws_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metinorak/varto"
+	"github.com/metinorak/varto/internal/testutil"
+	"github.com/metinorak/varto/ws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	serve := func(t *testing.T, v *varto.Varto, opts *ws.Options) string {
+		srv := httptest.NewServer(ws.Handler(v, opts))
+		t.Cleanup(srv.Close)
+
+		return "ws" + strings.TrimPrefix(srv.URL, "http")
+	}
+
+	dial := func(t *testing.T, url string) *ws.Conn {
+		conn, err := ws.Dial(url, nil)
+		assert.Nil(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		return conn
+	}
+
+	send := func(t *testing.T, conn *ws.Conn, cmd varto.Command) {
+		data, _ := json.Marshal(cmd)
+		assert.Nil(t, conn.Write(data))
+	}
+
+	subscriptions := func(v *varto.Varto) func() bool {
+		return func() bool {
+			stats, _ := v.Stats()
+			return stats.Subscriptions == 1
+		}
+	}
+
+	t.Run("TestHandler_WhenClientSubscribes_ThenReceivePublishedData", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := dial(t, serve(t, v, nil))
+
+		send(t, conn, varto.Command{Action: varto.ActionSubscribe, Topic: "topic"})
+		testutil.WaitFor(t, subscriptions(v))
+
+		assert.Nil(t, v.Publish("topic", []byte("data")))
+
+		data, err := conn.Read()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("data"), data)
+	})
+
+	t.Run("TestHandler_WhenClientPublishes_ThenOtherClientReceives", func(t *testing.T) {
+		v := varto.New(nil)
+		url := serve(t, v, nil)
+		subscriber := dial(t, url)
+		publisher := dial(t, url)
+
+		send(t, subscriber, varto.Command{Action: varto.ActionSubscribe, Topic: "topic"})
+		testutil.WaitFor(t, subscriptions(v))
+
+		data := strings.Repeat("a", 70000)
+		send(t, publisher, varto.Command{Action: varto.ActionPublish, Topic: "topic", Data: data})
+
+		received, err := subscriber.Read()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(data), received)
+	})
+
+	t.Run("TestHandler_WhenCommandFails_ThenReplyWithError", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := dial(t, serve(t, v, nil))
+
+		send(t, conn, varto.Command{Action: varto.ActionPublish, Topic: "topic", Data: "data"})
+
+		data, err := conn.Read()
+		assert.Nil(t, err)
+
+		var cmdErr varto.CommandError
+		assert.Nil(t, json.Unmarshal(data, &cmdErr))
+		assert.Equal(t, varto.CommandError{Action: varto.ActionPublish, Topic: "topic", Error: varto.ErrTopicNotFound.Error()}, cmdErr)
+	})
+
+	t.Run("TestHandler_WhenClientPings_ThenServerAnswersWithPong", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := dial(t, serve(t, v, nil))
+
+		pongs := make(chan []byte, 1)
+		conn.SetPongHandler(func(data []byte) {
+			pongs <- data
+		})
+		go conn.Read()
+
+		assert.Nil(t, conn.Ping())
+
+		select {
+		case <-pongs:
+		case <-time.After(time.Second):
+			t.Fatal("pong is not received")
+		}
+	})
+
+	t.Run("TestHandler_WhenClientCloses_ThenRemoveConnection", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := dial(t, serve(t, v, nil))
+
+		send(t, conn, varto.Command{Action: varto.ActionSubscribe, Topic: "topic"})
+		testutil.WaitFor(t, subscriptions(v))
+
+		assert.Nil(t, conn.Close())
+
+		_, err := conn.Read()
+		assert.NotNil(t, err)
+		testutil.WaitFor(t, func() bool {
+			stats, _ := v.Stats()
+			return stats.Connections == 0 && stats.Topics == 0
+		})
+	})
+
+	t.Run("TestHandler_WhenOriginIsNotAllowed_ThenRejectHandshake", func(t *testing.T) {
+		v := varto.New(nil)
+
+		_, err := ws.Dial(serve(t, v, nil), http.Header{"Origin": {"http://example.com"}})
+		assert.Equal(t, ws.ErrBadHandshake, err)
+	})
+
+	t.Run("TestHandler_WhenMessageIsTooBig_ThenCloseConnection", func(t *testing.T) {
+		v := varto.New(nil)
+		conn := dial(t, serve(t, v, &ws.Options{MaxMessageSize: 16}))
+
+		send(t, conn, varto.Command{Action: varto.ActionBroadcast, Data: strings.Repeat("a", 16)})
+
+		_, err := conn.Read()
+		assert.NotNil(t, err)
+	})
+
+	t.Run("TestHandler_WhenTrackedClientAnswersPings_ThenKeepConnection", func(t *testing.T) {
+		v := varto.New(nil)
+		h := varto.NewHeartbeat(v, &varto.HeartbeatOptions{Interval: 10 * time.Millisecond, IdleTimeout: 100 * time.Millisecond})
+		defer h.Stop()
+		conn := dial(t, serve(t, v, &ws.Options{Wrap: h.Track}))
+
+		// Reading answers the pings of the heartbeat.
+		go func() {
+			for {
+				if _, err := conn.Read(); err != nil {
+					return
+				}
+			}
+		}()
+		testutil.WaitFor(t, func() bool {
+			stats, _ := v.Stats()
+			return stats.Connections == 1
+		})
+		time.Sleep(300 * time.Millisecond)
+
+		stats, _ := v.Stats()
+		assert.Equal(t, 1, stats.Connections)
+	})
+
+	t.Run("TestHandler_WhenTrackedClientDoesNotAnswerPings_ThenRemoveConnection", func(t *testing.T) {
+		v := varto.New(nil)
+		h := varto.NewHeartbeat(v, &varto.HeartbeatOptions{Interval: 10 * time.Millisecond, IdleTimeout: 100 * time.Millisecond})
+		defer h.Stop()
+		dial(t, serve(t, v, &ws.Options{Wrap: h.Track}))
+
+		testutil.WaitFor(t, func() bool {
+			stats, _ := v.Stats()
+			return stats.Connections == 1
+		})
+		testutil.WaitFor(t, func() bool {
+			stats, _ := v.Stats()
+			return stats.Connections == 0
+		})
+	})
+}